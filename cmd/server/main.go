@@ -2,17 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/config"
 	"github.com/nibble/mock-fps/internal/handlers"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/modulus"
+	"github.com/nibble/mock-fps/internal/payee"
 	"github.com/nibble/mock-fps/internal/store"
 	"github.com/nibble/mock-fps/internal/webhook"
 )
@@ -21,15 +26,115 @@ func main() {
 	cfg := config.Load()
 
 	memStore := store.NewMemoryStore()
+	storeFile := filepath.Join(cfg.DataDir, "store.json")
+	if cfg.DataDir != "" {
+		if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+			log.Fatalf("data dir: %v", err)
+		}
+		if err := memStore.LoadFile(storeFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("load store: %v", err)
+		}
+	}
+
+	if cfg.AccountsFile != "" {
+		n, err := memStore.LoadAccountsFile(cfg.AccountsFile)
+		if err != nil {
+			log.Fatalf("accounts: %v", err)
+		}
+		log.Printf("loaded %d accounts from %s", n, cfg.AccountsFile)
+	}
+
+	// A running virtual clock behaves like wall time until frozen or advanced
+	// through the admin API.
+	clk := clock.NewVirtual()
 
-	dispatcher := webhook.NewDispatcher(memStore, cfg.WebhookBufferSize, cfg.WebhookWorkers)
+	dispatcher := webhook.NewDispatcher(memStore, clk, cfg.WebhookBufferSize, cfg.WebhookWorkers)
+	if err := dispatcher.SetRetryPolicy(webhook.RetryPolicy{
+		MaxAttempts:    cfg.WebhookMaxAttempts,
+		InitialBackoff: time.Duration(cfg.WebhookBackoffMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.WebhookMaxBackoffMs) * time.Millisecond,
+		Multiplier:     cfg.WebhookMultiplier,
+		Jitter:         cfg.WebhookJitter,
+	}); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	dispatcher.SetStatusEventTypes(cfg.WebhookStatusEvents)
+
+	shutdownPolicy, err := lifecycle.ParseShutdownPolicy(cfg.LifecycleShutdown)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
 
-	engine := lifecycle.NewEngine(cfg.LifecycleStepDelayMs, func(resourceType, resourceID, newStatus string) {
-		dispatcher.Notify(resourceType, resourceID, newStatus)
+	engine := lifecycle.NewEngine(context.Background(), cfg.LifecycleStepDelayMs, cfg.LifecycleWorkers, clk, func(resourceType string, path []string, event, status string) {
+		dispatcher.Notify(resourceType, path, event, status)
 	})
+	engine.SetShutdownPolicy(shutdownPolicy)
+	engine.OnClockChange(dispatcher.ClockChanged)
+	memStore.SetTransitionRule(engine.Legal)
+	if cfg.LifecycleSeed != 0 {
+		engine.SetSeed(uint64(cfg.LifecycleSeed))
+		log.Printf("lifecycle random seed %d", cfg.LifecycleSeed)
+	}
+
+	var journal *lifecycle.FileJournal
+	if cfg.DataDir != "" {
+		journal, err = lifecycle.OpenFileJournal(filepath.Join(cfg.DataDir, "lifecycles.jsonl"))
+		if err != nil {
+			log.Fatalf("lifecycle journal: %v", err)
+		}
+		engine.SetJournal(journal)
+	}
+
+	defs := lifecycle.DefaultDefinitions()
+	if cfg.StateMachinesFile != "" {
+		defs, err = lifecycle.LoadDefinitions(cfg.StateMachinesFile)
+		if err != nil {
+			log.Fatalf("state machines: %v", err)
+		}
+		if err := engine.SetDefinitions(defs); err != nil {
+			log.Fatalf("state machines: %v", err)
+		}
+		log.Printf("loaded state machines from %s", cfg.StateMachinesFile)
+	}
+
+	if cfg.ScenarioRulesFile != "" {
+		rules, err := lifecycle.LoadRules(cfg.ScenarioRulesFile, defs)
+		if err != nil {
+			log.Fatalf("scenario rules: %v", err)
+		}
+		engine.SetOutcomeSelector(rules.Select)
+		engine.SetTaskSelector(rules.Tasks)
+		log.Printf("loaded %d scenario rules and %d admission task rules from %s", len(rules.Rules), len(rules.AdmissionTasks), cfg.ScenarioRulesFile)
+	}
+
+	var table *modulus.Table
+	if cfg.ModulusWeightsFile != "" {
+		table, err = modulus.LoadTable(cfg.ModulusWeightsFile, cfg.ModulusSubsFile)
+		if err != nil {
+			log.Fatalf("modulus tables: %v", err)
+		}
+		log.Printf("loaded modulus weights from %s", cfg.ModulusWeightsFile)
+	}
+	validation, err := handlers.NewAccountValidation(cfg.AccountValidation, table)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	matcher := payee.Matcher{Match: cfg.PayeeMatch, CloseMatch: cfg.PayeeCloseMatch}
+	if err := matcher.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
 
 	mux := http.NewServeMux()
-	handlers.RegisterRoutes(mux, memStore, engine)
+	handlers.RegisterRoutes(mux, memStore, engine, handlers.WithAccountValidation(validation), handlers.WithPayeeMatcher(matcher), handlers.WithRedriver(dispatcher), handlers.WithStrictAccounts(cfg.StrictAccounts))
+
+	// Handlers register their updaters above, so pending lifecycles from a
+	// previous run can only be restored now.
+	if n, err := engine.Restore(); err != nil {
+		log.Fatalf("restore lifecycles: %v", err)
+	} else if n > 0 {
+		log.Printf("restored %d pending lifecycles", n)
+	}
 
 	// Apply middleware chain: recovery -> logging -> content-type -> routes
 	handler := handlers.Recovery(handlers.Logging(jsonapi.EnforceContentType(mux)))
@@ -42,8 +147,36 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Graceful shutdown
+	// The journal is written as lifecycles move, so the store is saved as
+	// they go too, or a crash would leave the journal pointing at resources
+	// that were never saved.
+	stopSaving := make(chan struct{})
+	savingStopped := make(chan struct{})
 	go func() {
+		defer close(savingStopped)
+		if cfg.DataDir == "" || cfg.SaveIntervalMs <= 0 {
+			return
+		}
+		ticker := time.NewTicker(time.Duration(cfg.SaveIntervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := memStore.SaveFile(storeFile); err != nil {
+					log.Printf("save store: %v", err)
+				}
+			case <-stopSaving:
+				return
+			}
+		}
+	}()
+
+	// Graceful shutdown: stop taking requests, settle lifecycles, flush
+	// webhooks the lifecycles produced, then save the store with any webhooks
+	// that were dead-lettered on the way.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
@@ -52,15 +185,27 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		dispatcher.Close()
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Printf("shutdown error: %v", err)
 		}
+		if err := engine.Shutdown(ctx); err != nil {
+			log.Printf("lifecycle shutdown error: %v", err)
+		}
+		dispatcher.Close()
+		close(stopSaving)
+		<-savingStopped
+		if cfg.DataDir != "" {
+			if err := memStore.SaveFile(storeFile); err != nil {
+				log.Printf("save store: %v", err)
+			}
+			journal.Close()
+		}
 	}()
 
 	log.Printf("mock-fps server starting on :%s", cfg.Port)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-stopped
 	log.Println("server stopped")
 }
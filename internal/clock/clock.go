@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock reports the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the wall clock.
+type Real struct{}
+
+// Now returns the current UTC time.
+func (Real) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Virtual is a clock that follows wall time until it is frozen, and can be
+// moved forward by arbitrary amounts. The zero value is ready to use.
+type Virtual struct {
+	mu       sync.Mutex
+	offset   time.Duration
+	frozen   bool
+	frozenAt time.Time
+}
+
+// NewVirtual creates a running virtual clock.
+func NewVirtual() *Virtual {
+	return &Virtual{}
+}
+
+// Now returns the virtual time.
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.nowLocked()
+}
+
+func (v *Virtual) nowLocked() time.Time {
+	if v.frozen {
+		return v.frozenAt
+	}
+	return time.Now().UTC().Add(v.offset)
+}
+
+// Freeze stops the clock at its current time.
+func (v *Virtual) Freeze() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.frozen {
+		v.frozenAt = v.nowLocked()
+		v.frozen = true
+	}
+}
+
+// Set freezes the clock at t.
+func (v *Virtual) Set(t time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.frozenAt = t.UTC()
+	v.frozen = true
+}
+
+// Unfreeze lets the clock run again from where it was frozen.
+func (v *Virtual) Unfreeze() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.frozen {
+		v.offset = v.frozenAt.Sub(time.Now().UTC())
+		v.frozen = false
+	}
+}
+
+// Frozen reports whether the clock is frozen.
+func (v *Virtual) Frozen() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frozen
+}
+
+// Advance moves the clock forward by d.
+func (v *Virtual) Advance(d time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.frozen {
+		v.frozenAt = v.frozenAt.Add(d)
+		return
+	}
+	v.offset += d
+}
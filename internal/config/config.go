@@ -8,16 +8,56 @@ import (
 type Config struct {
 	Port                 string
 	LifecycleStepDelayMs int
+	LifecycleWorkers     int
+	LifecycleShutdown    string
+	LifecycleSeed        int
 	WebhookWorkers       int
 	WebhookBufferSize    int
+	WebhookMaxAttempts   int
+	WebhookBackoffMs     int
+	WebhookMaxBackoffMs  int
+	WebhookMultiplier    float64
+	WebhookJitter        float64
+	WebhookStatusEvents  bool
+	ScenarioRulesFile    string
+	StateMachinesFile    string
+	AccountsFile         string
+	StrictAccounts       bool
+	AccountValidation    string
+	ModulusWeightsFile   string
+	ModulusSubsFile      string
+	PayeeMatch           float64
+	PayeeCloseMatch      float64
+	DataDir              string
+	SaveIntervalMs       int
 }
 
 func Load() Config {
 	return Config{
 		Port:                 envOrDefault("PORT", "8080"),
 		LifecycleStepDelayMs: envIntOrDefault("LIFECYCLE_STEP_DELAY_MS", 500),
+		LifecycleWorkers:     envIntOrDefault("LIFECYCLE_WORKERS", 8),
+		LifecycleShutdown:    envOrDefault("LIFECYCLE_SHUTDOWN_POLICY", "abandon"),
+		LifecycleSeed:        envIntOrDefault("LIFECYCLE_SEED", 0),
 		WebhookWorkers:       envIntOrDefault("WEBHOOK_WORKERS", 4),
 		WebhookBufferSize:    envIntOrDefault("WEBHOOK_BUFFER_SIZE", 1000),
+		WebhookMaxAttempts:   envIntOrDefault("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookBackoffMs:     envIntOrDefault("WEBHOOK_BACKOFF_MS", 1000),
+		WebhookMaxBackoffMs:  envIntOrDefault("WEBHOOK_MAX_BACKOFF_MS", 60000),
+		WebhookMultiplier:    envFloatOrDefault("WEBHOOK_BACKOFF_MULTIPLIER", 2),
+		WebhookJitter:        envFloatOrDefault("WEBHOOK_BACKOFF_JITTER", 0.2),
+		WebhookStatusEvents:  envBoolOrDefault("WEBHOOK_STATUS_EVENT_TYPES", false),
+		ScenarioRulesFile:    envOrDefault("SCENARIO_RULES_FILE", ""),
+		StateMachinesFile:    envOrDefault("STATE_MACHINES_FILE", ""),
+		AccountsFile:         envOrDefault("ACCOUNTS_FILE", ""),
+		StrictAccounts:       envBoolOrDefault("STRICT_ACCOUNTS", false),
+		AccountValidation:    envOrDefault("ACCOUNT_VALIDATION", "lenient"),
+		ModulusWeightsFile:   envOrDefault("MODULUS_WEIGHTS_FILE", ""),
+		ModulusSubsFile:      envOrDefault("MODULUS_SUBSTITUTIONS_FILE", ""),
+		PayeeMatch:           envFloatOrDefault("PAYEE_MATCH_THRESHOLD", 1),
+		PayeeCloseMatch:      envFloatOrDefault("PAYEE_CLOSE_MATCH_THRESHOLD", 0.85),
+		DataDir:              envOrDefault("DATA_DIR", ""),
+		SaveIntervalMs:       envIntOrDefault("SAVE_INTERVAL_MS", 5000),
 	}
 }
 
@@ -36,3 +76,21 @@ func envIntOrDefault(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func envFloatOrDefault(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func envBoolOrDefault(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
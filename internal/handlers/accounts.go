@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// Scheme reason codes for payments to accounts that cannot take them.
+const (
+	ReasonIncorrectAccount = "AC01"
+	ReasonClosedAccount    = "AC04"
+	ReasonBlockedAccount   = "AC06"
+	ReasonDeceased         = "MD07"
+)
+
+// accountReasons maps the states of accounts that cannot be paid to the
+// reason given for rejecting a payment. A switched account has moved to
+// another bank, so it is closed here.
+var accountReasons = map[string]string{
+	models.AccountStateClosed:   ReasonClosedAccount,
+	models.AccountStateFrozen:   ReasonBlockedAccount,
+	models.AccountStateDeceased: ReasonDeceased,
+	models.AccountStateSwitched: ReasonClosedAccount,
+}
+
+// AccountHandler manages the mock account registry through the admin API.
+type AccountHandler struct {
+	store store.Store
+}
+
+func NewAccountHandler(s store.Store) *AccountHandler {
+	return &AccountHandler{store: s}
+}
+
+func (h *AccountHandler) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.Account]{Data: h.store.ListAccounts()})
+}
+
+func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
+	sortCode, accountNumber := r.PathValue("sortCode"), r.PathValue("accountNumber")
+	a, err := h.store.GetAccount(sortCode, accountNumber)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "account", sortCode+"/"+accountNumber)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Account]{Data: a})
+}
+
+// Put creates or replaces the account in the path.
+func (h *AccountHandler) Put(w http.ResponseWriter, r *http.Request) {
+	var req jsonapi.DataEnvelope[models.Account]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+	a := req.Data
+	a.SortCode, a.AccountNumber = r.PathValue("sortCode"), r.PathValue("accountNumber")
+	if a.State == "" {
+		a.State = models.AccountStateOpen
+	}
+	if err := h.store.PutAccount(a); err != nil {
+		if errors.Is(err, store.ErrInvalidAccount) {
+			jsonapi.BadRequest(w, err.Error())
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Account]{Data: a})
+}
+
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	sortCode, accountNumber := r.PathValue("sortCode"), r.PathValue("accountNumber")
+	if err := h.store.DeleteAccount(sortCode, accountNumber); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "account", sortCode+"/"+accountNumber)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// outboundOutcome returns how a payment to p's beneficiary fails if the
+// beneficiary is a registered account that cannot be paid. Accounts that are
+// not registered belong to other banks and are paid as normal.
+func outboundOutcome(s store.Store, p models.Payment) (lifecycle.Outcome, bool) {
+	b := p.Attributes.BeneficiaryParty
+	if b == nil {
+		return lifecycle.Outcome{}, false
+	}
+	a, err := s.GetAccount(b.SortCode, b.AccountNumber)
+	if err != nil {
+		return lifecycle.Outcome{}, false
+	}
+	code, ok := accountReasons[a.State]
+	if !ok {
+		return lifecycle.Outcome{}, false
+	}
+	return lifecycle.Outcome{Status: models.StatusDeliveryFailed, SchemeStatusCode: code}, true
+}
+
+// inboundOutcome returns how an admission of p fails if its beneficiary is
+// a registered account that cannot be paid. Unless strict, accounts that are
+// not registered are taken to exist; when strict, payments to them are
+// rejected as to an incorrect account.
+func inboundOutcome(s store.Store, p models.Payment, strict bool) (lifecycle.Outcome, bool) {
+	var unknown lifecycle.Outcome
+	if strict {
+		unknown = lifecycle.Outcome{Status: models.StatusFailed, SchemeStatusCode: ReasonIncorrectAccount}
+	}
+	b := p.Attributes.BeneficiaryParty
+	if b == nil {
+		return unknown, strict
+	}
+	a, err := s.GetAccount(b.SortCode, b.AccountNumber)
+	if err != nil {
+		return unknown, strict
+	}
+	code, ok := accountReasons[a.State]
+	if !ok {
+		return lifecycle.Outcome{}, false
+	}
+	return lifecycle.Outcome{Status: models.StatusFailed, SchemeStatusCode: code}, true
+}
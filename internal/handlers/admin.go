@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/clock"
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// ClockState describes the server clock for the admin API.
+type ClockState struct {
+	Now     time.Time  `json:"now"`
+	Frozen  bool       `json:"frozen"`
+	Pending int        `json:"pending_transitions"`
+	NextDue *time.Time `json:"next_due,omitempty"`
+}
+
+// ClockCommand is the body of the clock freeze and advance admin calls.
+type ClockCommand struct {
+	// At freezes the clock at a specific instant. It may be earlier than the
+	// current time: transitions already scheduled keep their due times and
+	// run once the clock reaches them again.
+	At *time.Time `json:"at,omitempty"`
+	// Duration advances the clock, e.g. "1m30s".
+	Duration string `json:"duration,omitempty"`
+	// ToNext advances the clock to the next pending transition.
+	ToNext bool `json:"to_next,omitempty"`
+}
+
+// StatusCommand is the body of the force-status admin call.
+type StatusCommand struct {
+	Status string `json:"status"`
+}
+
+// ForcedStatus reports the result of forcing a resource's status.
+type ForcedStatus struct {
+	Type           string `json:"type"`
+	ID             string `json:"id"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+type AdminHandler struct {
+	store  store.Store
+	engine *lifecycle.Engine
+}
+
+func NewAdminHandler(s store.Store, e *lifecycle.Engine) *AdminHandler {
+	return &AdminHandler{store: s, engine: e}
+}
+
+func (h *AdminHandler) GetClock(w http.ResponseWriter, r *http.Request) {
+	h.writeClock(w)
+}
+
+func (h *AdminHandler) FreezeClock(w http.ResponseWriter, r *http.Request) {
+	vc, ok := h.virtualClock(w)
+	if !ok {
+		return
+	}
+	cmd, ok := decodeClockCommand(w, r)
+	if !ok {
+		return
+	}
+	if cmd.At != nil {
+		vc.Set(*cmd.At)
+	} else {
+		vc.Freeze()
+	}
+	h.engine.ClockChanged()
+	h.writeClock(w)
+}
+
+func (h *AdminHandler) UnfreezeClock(w http.ResponseWriter, r *http.Request) {
+	vc, ok := h.virtualClock(w)
+	if !ok {
+		return
+	}
+	vc.Unfreeze()
+	h.engine.ClockChanged()
+	h.writeClock(w)
+}
+
+func (h *AdminHandler) AdvanceClock(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.virtualClock(w); !ok {
+		return
+	}
+	cmd, ok := decodeClockCommand(w, r)
+	if !ok {
+		return
+	}
+
+	switch {
+	case cmd.ToNext:
+		if _, err := h.engine.AdvanceToNext(); err != nil {
+			jsonapi.InternalError(w)
+			return
+		}
+	case cmd.Duration != "":
+		d, err := time.ParseDuration(cmd.Duration)
+		if err != nil || d < 0 {
+			jsonapi.BadRequest(w, "duration must be a non-negative Go duration such as 1m30s")
+			return
+		}
+		if err := h.engine.Advance(d); err != nil {
+			jsonapi.InternalError(w)
+			return
+		}
+	default:
+		jsonapi.BadRequest(w, "one of duration or to_next is required")
+		return
+	}
+	h.writeClock(w)
+}
+
+func (h *AdminHandler) LifecycleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[lifecycle.Stats]{Data: h.engine.Stats()})
+}
+
+// ForceStatus moves a submission or admission into the requested status
+// immediately, going through any intermediate statuses on the way.
+func (h *AdminHandler) ForceStatus(w http.ResponseWriter, r *http.Request) {
+	resourceType := r.PathValue("type")
+	id := r.PathValue("id")
+
+	var req jsonapi.DataEnvelope[StatusCommand]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Data.Status == "" {
+		jsonapi.BadRequest(w, "status is required")
+		return
+	}
+
+	key, _, ok := h.findResource(w, resourceType, id)
+	if !ok {
+		return
+	}
+	// The status is read again once the resource's lifecycle is stopped, so
+	// that a transition applied in the meantime is not lost.
+	current, err := h.engine.Force(key, req.Data.Status, func() (string, error) {
+		_, status, err := h.store.FindResource(resourceType, id)
+		return status, err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, lifecycle.ErrIllegalTransition) || errors.Is(err, store.ErrInvalidTransition):
+			jsonapi.Conflict(w, err.Error())
+		case errors.Is(err, store.ErrNotFound):
+			jsonapi.NotFound(w, resourceType, id)
+		default:
+			jsonapi.InternalError(w)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[ForcedStatus]{Data: ForcedStatus{
+		Type:           resourceType,
+		ID:             id,
+		PreviousStatus: current,
+		Status:         req.Data.Status,
+	}})
+}
+
+// ListHolds lists held lifecycles and breakpoints not yet reached.
+func (h *AdminHandler) ListHolds(w http.ResponseWriter, r *http.Request) {
+	holds := h.engine.Holds()
+	if holds == nil {
+		holds = []lifecycle.Hold{}
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[lifecycle.Hold]{Data: holds})
+}
+
+// PauseLifecycle holds a resource's lifecycle at the status in the optional
+// body, or where it is now.
+func (h *AdminHandler) PauseLifecycle(w http.ResponseWriter, r *http.Request) {
+	var req jsonapi.DataEnvelope[StatusCommand]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+	h.holdCommand(w, r, func(key lifecycle.Key) error {
+		return h.engine.Pause(key, req.Data.Status)
+	})
+}
+
+// ResumeLifecycle lets a held lifecycle carry on where it left off.
+func (h *AdminHandler) ResumeLifecycle(w http.ResponseWriter, r *http.Request) {
+	h.holdCommand(w, r, h.engine.Resume)
+}
+
+// ReleaseLifecycle lets a held lifecycle move on immediately.
+func (h *AdminHandler) ReleaseLifecycle(w http.ResponseWriter, r *http.Request) {
+	h.holdCommand(w, r, h.engine.Release)
+}
+
+// holdCommand applies fn to the lifecycle of the resource in the path.
+func (h *AdminHandler) holdCommand(w http.ResponseWriter, r *http.Request, fn func(lifecycle.Key) error) {
+	key, _, ok := h.findResource(w, r.PathValue("type"), r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if err := fn(key); err != nil {
+		switch {
+		case errors.Is(err, lifecycle.ErrNoLifecycle):
+			jsonapi.Conflict(w, key.Type+" "+key.ID()+" has no lifecycle in progress")
+		case errors.Is(err, lifecycle.ErrUnknownStatus):
+			jsonapi.BadRequest(w, err.Error())
+		default:
+			jsonapi.InternalError(w)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findResource looks up a lifecycle resource by type and ID, writing a 404
+// if there is none and a 409 if the ID is used under more than one payment.
+func (h *AdminHandler) findResource(w http.ResponseWriter, resourceType, id string) (lifecycle.Key, string, bool) {
+	path, status, err := h.store.FindResource(resourceType, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, resourceType, id)
+			return lifecycle.Key{}, "", false
+		}
+		if errors.Is(err, store.ErrAmbiguous) {
+			jsonapi.Conflict(w, "more than one "+resourceType+" has ID "+id)
+			return lifecycle.Key{}, "", false
+		}
+		jsonapi.InternalError(w)
+		return lifecycle.Key{}, "", false
+	}
+	return lifecycle.NewKey(resourceType, path...), status, true
+}
+
+func (h *AdminHandler) virtualClock(w http.ResponseWriter) (*clock.Virtual, bool) {
+	vc, ok := h.engine.Clock().(*clock.Virtual)
+	if !ok {
+		jsonapi.Conflict(w, "server clock is not virtual")
+	}
+	return vc, ok
+}
+
+func (h *AdminHandler) writeClock(w http.ResponseWriter) {
+	state := ClockState{
+		Now:     h.engine.Clock().Now(),
+		Pending: h.engine.Stats().Pending,
+	}
+	if vc, ok := h.engine.Clock().(*clock.Virtual); ok {
+		state.Frozen = vc.Frozen()
+	}
+	if due, ok := h.engine.NextDue(); ok {
+		state.NextDue = &due
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[ClockState]{Data: state})
+}
+
+// decodeClockCommand reads an optional ClockCommand body.
+func decodeClockCommand(w http.ResponseWriter, r *http.Request) (ClockCommand, bool) {
+	var req jsonapi.DataEnvelope[ClockCommand]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return ClockCommand{}, false
+	}
+	return req.Data, true
+}
@@ -2,16 +2,19 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/handlers"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
@@ -22,7 +25,7 @@ import (
 func setupBenchServer() *httptest.Server {
 	s := store.NewMemoryStore()
 	// Use large delay so lifecycle goroutines don't interfere with benchmarks
-	engine := lifecycle.NewEngine(999999, nil)
+	engine := lifecycle.NewEngine(context.Background(), 999999, 4, clock.Real{}, nil)
 	mux := http.NewServeMux()
 	handlers.RegisterRoutes(mux, s, engine)
 	return httptest.NewServer(mux)
@@ -227,3 +230,84 @@ func TestLoadTest(t *testing.T) {
 	t.Logf("Max latency: %s", time.Duration(maxNs.Load()))
 	t.Logf("Errors:      %d", totalErrs)
 }
+
+func BenchmarkCreateSubmission(b *testing.B) {
+	srv := setupBenchServer()
+	defer srv.Close()
+	client := srv.Client()
+
+	p := models.Payment{
+		Resource:   models.Resource{ID: "bench-sub"},
+		Attributes: models.PaymentAttributes{Amount: "100.00", Currency: "GBP"},
+	}
+	body, _ := json.Marshal(jsonapi.DataEnvelope[models.Payment]{Data: p})
+	resp, _ := client.Post(srv.URL+"/v1/transaction/payments", jsonapi.ContentType, bytes.NewReader(body))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		sub := models.PaymentSubmission{Resource: models.Resource{ID: fmt.Sprintf("s-%d", i)}}
+		body, _ := json.Marshal(jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub})
+		resp, err := client.Post(srv.URL+"/v1/transaction/payments/bench-sub/submissions", jsonapi.ContentType, bytes.NewReader(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	b.StopTimer()
+	// Every submission has a parked lifecycle; goroutines must not grow with b.N.
+	b.ReportMetric(float64(runtime.NumGoroutine()), "goroutines")
+}
+
+// BenchmarkSubmissionVolume schedules b.N submission lifecycles at once and
+// reports scheduler throughput, goroutine count and heap use.
+// Run with: go test -run '^$' -bench SubmissionVolume -benchtime 100000x ./internal/handlers/
+func BenchmarkSubmissionVolume(b *testing.B) {
+	const workers = 8
+	var applied atomic.Int64
+	engine := lifecycle.NewEngine(context.Background(), 100, workers, clock.Real{}, nil)
+	b.Cleanup(func() { engine.Shutdown(context.Background()) })
+	engine.Handle(models.ResourceTypePaymentSubmission, func(lifecycle.Key, lifecycle.Outcome, string) error {
+		applied.Add(1)
+		return nil
+	})
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	baseGoroutines := runtime.NumGoroutine()
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := range b.N {
+		engine.StartTransition(lifecycle.NewKey(models.ResourceTypePaymentSubmission, "p", fmt.Sprintf("s-%d", i)), lifecycle.OutcomeDelivered)
+	}
+	scheduled := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	peakGoroutines := runtime.NumGoroutine()
+
+	for engine.Stats().Pending > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	want := int64(b.N * (len(lifecycle.PaymentSubmissionChain) - 1))
+	if applied.Load() != want {
+		b.Errorf("expected %d transitions, got %d", want, applied.Load())
+	}
+	if peakGoroutines-baseGoroutines > workers {
+		b.Errorf("expected goroutines to stay bounded, grew by %d", peakGoroutines-baseGoroutines)
+	}
+
+	// HeapAlloc can drop between the two readings if a collection runs.
+	heapGrowth := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	b.ReportMetric(float64(b.N)/scheduled.Seconds(), "scheduled/s")
+	b.ReportMetric(float64(applied.Load())/elapsed.Seconds(), "transitions/s")
+	b.ReportMetric(float64(peakGoroutines-baseGoroutines), "goroutines")
+	b.ReportMetric(float64(heapGrowth)/float64(b.N), "heap-B/lifecycle")
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// Redriver delivers a dead-lettered webhook notification again.
+type Redriver interface {
+	Redrive(id string) error
+}
+
+// DeadLetterHandler lists, discards and redrives webhook notifications that
+// could not be delivered.
+type DeadLetterHandler struct {
+	store    store.Store
+	redriver Redriver // nil if webhooks are not dispatched
+}
+
+func NewDeadLetterHandler(s store.Store, r Redriver) *DeadLetterHandler {
+	return &DeadLetterHandler{store: s, redriver: r}
+}
+
+func (h *DeadLetterHandler) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.DeadLetter]{Data: h.store.ListDeadLetters()})
+}
+
+func (h *DeadLetterHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("deadLetterID")
+	d, err := h.store.GetDeadLetter(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "dead_letter", id)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.DeadLetter]{Data: d})
+}
+
+func (h *DeadLetterHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("deadLetterID")
+	if err := h.store.DeleteDeadLetter(id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "dead_letter", id)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Redrive takes a dead letter off the queue and delivers it again. Delivery
+// is asynchronous; if it fails once more the notification comes back as a
+// new dead letter.
+func (h *DeadLetterHandler) Redrive(w http.ResponseWriter, r *http.Request) {
+	if h.redriver == nil {
+		jsonapi.WriteError(w, http.StatusServiceUnavailable, "Service Unavailable", "webhooks are not being dispatched")
+		return
+	}
+	id := r.PathValue("deadLetterID")
+	if err := h.redriver.Redrive(id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "dead_letter", id)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RedriveAll redrives every dead letter.
+func (h *DeadLetterHandler) RedriveAll(w http.ResponseWriter, r *http.Request) {
+	if h.redriver == nil {
+		jsonapi.WriteError(w, http.StatusServiceUnavailable, "Service Unavailable", "webhooks are not being dispatched")
+		return
+	}
+	for _, d := range h.store.ListDeadLetters() {
+		if err := h.redriver.Redrive(d.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			jsonapi.InternalError(w)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
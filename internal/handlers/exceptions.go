@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// exceptionStatus moves returns, recalls and reversals through their state
+// machines as their submissions and recall decisions progress.
+type exceptionStatus struct {
+	mu     sync.Mutex // serialises moves of the same parent
+	store  store.Store
+	engine *lifecycle.Engine
+}
+
+// newExceptionStatus creates an exceptionStatus that follows the lifecycles
+// of return, recall, recall decision and reversal submissions.
+func newExceptionStatus(s store.Store, e *lifecycle.Engine) *exceptionStatus {
+	es := &exceptionStatus{store: s, engine: e}
+	e.OnTransition(es.childMoved)
+	return es
+}
+
+// submitted moves a return or reversal on once a submission for it has been
+// created.
+func (es *exceptionStatus) submitted(resourceType, paymentID, id string) {
+	es.move(resourceType, paymentID, id, models.StatusSubmitted, lifecycle.OutcomeDelivered)
+}
+
+// childMoved is called for every transition the engine applies. Submissions
+// are keyed by paymentID, parentID, [decisionID,] submissionID.
+func (es *exceptionStatus) childMoved(resourceType string, path []string, t models.StatusTransition) {
+	if resourceType == models.ResourceTypeRecall && t.Trigger == models.TriggerAdmin {
+		// Recalls moved here are followed up as they are moved; ones forced
+		// through the admin API still need to be.
+		es.recallMoved(path[0], path[1], t.To)
+		return
+	}
+	if len(path) < 3 {
+		return
+	}
+	paymentID, parentID := path[0], path[1]
+	switch resourceType {
+	case models.ResourceTypeReturnSubmission:
+		es.settle(models.ResourceTypeReturnPayment, paymentID, parentID, t.To, models.StatusCompleted)
+	case models.ResourceTypeReversalSubmission:
+		es.settle(models.ResourceTypeReversal, paymentID, parentID, t.To, models.StatusCompleted)
+	case models.ResourceTypeRecallSubmission:
+		es.settle(models.ResourceTypeRecall, paymentID, parentID, t.To, models.StatusAwaitingDecision)
+		if t.To == models.StatusDeliveryConfirmed {
+			es.recallMoved(paymentID, parentID, models.StatusAwaitingDecision)
+		}
+	case models.ResourceTypeRecallDecisionSubmission:
+		if t.To != models.StatusDeliveryConfirmed {
+			return
+		}
+		d, err := es.store.GetRecallDecision(paymentID, parentID, path[2])
+		if err != nil {
+			return
+		}
+		es.decided(paymentID, parentID, d)
+	}
+}
+
+// decided closes a recall once a decision on it has been delivered, along
+// with the reason given. A decision delivered while the recall is still
+// pending waits for it to await a decision; see recallMoved.
+func (es *exceptionStatus) decided(paymentID, recallID string, d models.RecallDecision) {
+	status := models.StatusRejected
+	if d.Attributes.Answer == models.RecallAnswerAccepted {
+		status = models.StatusAccepted
+	}
+	outcome := lifecycle.Outcome{Status: status, Reason: d.Attributes.Reason}
+	if es.move(models.ResourceTypeRecall, paymentID, recallID, status, outcome) {
+		es.recallMoved(paymentID, recallID, status)
+	}
+}
+
+// recallMoved follows up a recall that has moved to status. Once it awaits
+// a decision, the first decision already delivered is applied. An accepted
+// recall is paid back through a new return, which is submitted straight
+// away.
+func (es *exceptionStatus) recallMoved(paymentID, recallID, status string) {
+	switch status {
+	case models.StatusAwaitingDecision:
+		for _, d := range es.store.ListRecallDecisions(paymentID, recallID) {
+			for _, sub := range es.store.ListRecallDecisionSubmissions(paymentID, recallID, d.ID) {
+				if sub.Attributes.Status == models.StatusDeliveryConfirmed {
+					es.decided(paymentID, recallID, d)
+					return
+				}
+			}
+		}
+	case models.StatusAccepted:
+		rec, err := es.store.GetRecall(paymentID, recallID)
+		if err == nil {
+			err = es.returnRecall(paymentID, rec)
+		}
+		if err != nil {
+			log.Printf("exceptions: failed to return recall %s: %v", recallID, err)
+		}
+	}
+}
+
+// returnRecall creates and submits a return of the recalled amount.
+func (es *exceptionStatus) returnRecall(paymentID string, rec models.Recall) error {
+	amount, currency := rec.Attributes.Amount, rec.Attributes.Currency
+	if amount == "" {
+		p, err := es.store.GetPayment(paymentID)
+		if err != nil {
+			return err
+		}
+		amount, currency = p.Attributes.Amount, p.Attributes.Currency
+	}
+	now := es.engine.Clock().Now().UTC()
+	ret := models.ReturnPayment{
+		Resource: models.Resource{
+			Type:           models.ResourceTypeReturnPayment,
+			ID:             uuid.New().String(),
+			OrganisationID: rec.OrganisationID,
+			CreatedOn:      now,
+			ModifiedOn:     now,
+		},
+		Attributes: models.ReturnPaymentAttributes{
+			Amount:       amount,
+			Currency:     currency,
+			ReturnReason: rec.Attributes.RecallReason,
+			SchemeStatus: es.engine.InitialStatus(models.ResourceTypeReturnPayment),
+			RecallID:     rec.ID,
+		},
+	}
+	if err := es.store.CreateReturn(paymentID, ret); err != nil {
+		return err
+	}
+	es.engine.Notify(lifecycle.NewKey(models.ResourceTypeReturnPayment, paymentID, ret.ID), models.EventCreated)
+	sub := models.ReturnSubmission{
+		Resource: models.Resource{
+			Type:           models.ResourceTypeReturnSubmission,
+			ID:             uuid.New().String(),
+			OrganisationID: rec.OrganisationID,
+			CreatedOn:      now,
+			ModifiedOn:     now,
+		},
+		Attributes: models.ReturnSubmissionAttributes{
+			Status:         es.engine.InitialStatus(models.ResourceTypeReturnSubmission),
+			SubmissionDate: now.Format(time.DateOnly),
+		},
+	}
+	if err := es.store.CreateReturnSubmission(paymentID, ret.ID, sub); err != nil {
+		return err
+	}
+	es.engine.Notify(lifecycle.NewKey(models.ResourceTypeReturnSubmission, paymentID, ret.ID, sub.ID), models.EventCreated)
+	es.submitted(models.ResourceTypeReturnPayment, paymentID, ret.ID)
+	es.engine.StartTransition(lifecycle.NewKey(models.ResourceTypeReturnSubmission, paymentID, ret.ID, sub.ID), lifecycle.OutcomeDelivered)
+	return nil
+}
+
+// settle moves a parent on to next once a submission for it is delivered, or
+// to failed if the submission fails.
+func (es *exceptionStatus) settle(resourceType, paymentID, id, childStatus, next string) {
+	switch childStatus {
+	case models.StatusDeliveryConfirmed:
+		es.move(resourceType, paymentID, id, next, lifecycle.OutcomeDelivered)
+	case models.StatusFailed, models.StatusDeliveryFailed:
+		es.move(resourceType, paymentID, id, models.StatusFailed, lifecycle.OutcomeDelivered)
+	}
+}
+
+// move applies a transition of the parent if its state machine allows it
+// from where the parent is now, and reports whether it did. A parent that has already moved past status,
+// for instance because a second submission was delivered, is left alone.
+// The outcome is passed on to the parent's updater.
+func (es *exceptionStatus) move(resourceType, paymentID, id, status string, outcome lifecycle.Outcome) bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	current, err := es.status(resourceType, paymentID, id)
+	if err != nil || current == status || !es.engine.Legal(resourceType, current, status) {
+		return false
+	}
+	key := lifecycle.NewKey(resourceType, paymentID, id)
+	if err := es.engine.Apply(key, current, status, outcome); err != nil {
+		log.Printf("exceptions: failed to move %s %s to %s: %v", resourceType, id, status, err)
+		return false
+	}
+	return true
+}
+
+func (es *exceptionStatus) status(resourceType, paymentID, id string) (string, error) {
+	switch resourceType {
+	case models.ResourceTypeReturnPayment:
+		r, err := es.store.GetReturn(paymentID, id)
+		return r.Attributes.SchemeStatus, err
+	case models.ResourceTypeRecall:
+		r, err := es.store.GetRecall(paymentID, id)
+		return r.Attributes.Status, err
+	case models.ResourceTypeReversal:
+		r, err := es.store.GetReversal(paymentID, id)
+		return r.Attributes.Status, err
+	}
+	return "", store.ErrNotFound
+}
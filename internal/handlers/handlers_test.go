@@ -2,22 +2,35 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/handlers"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/ledger"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/modulus"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 func setupServer() *httptest.Server {
+	return setupServerWithEngine(lifecycle.NewEngine(context.Background(), 10, 4, clock.Real{}, nil)) // 10ms steps for fast tests
+}
+
+func setupServerWithEngine(engine *lifecycle.Engine) *httptest.Server {
 	s := store.NewMemoryStore()
-	engine := lifecycle.NewEngine(10, nil) // 10ms steps for fast tests
+	s.SetTransitionRule(engine.Legal)
 	mux := http.NewServeMux()
 	handlers.RegisterRoutes(mux, s, engine)
 	return httptest.NewServer(mux)
@@ -165,6 +178,70 @@ func TestPaymentSubmissionLifecycle(t *testing.T) {
 	}
 }
 
+func TestPaymentSubmissionFailureOutcome(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		notified []string
+	)
+	engine := lifecycle.NewEngine(context.Background(), 10, 4, clock.Real{}, func(resourceType string, path []string, event, status string) {
+		if resourceType != models.ResourceTypePaymentSubmission || status == "" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, status)
+	})
+	engine.SetOutcomeSelector(func(p models.Payment) lifecycle.Outcome {
+		return lifecycle.Outcome{Status: models.StatusFailed, At: models.StatusLimitCheckPending, SchemeStatusCode: "AM04"}
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	payment := models.Payment{
+		Resource:   models.Resource{ID: "p1"},
+		Attributes: models.PaymentAttributes{Amount: "100.00", Currency: "GBP"},
+	}
+	body, _ := json.Marshal(jsonapi.DataEnvelope[models.Payment]{Data: payment})
+	http.Post(srv.URL+"/v1/transaction/payments", jsonapi.ContentType, bytes.NewReader(body))
+
+	sub := models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}
+	body, _ = json.Marshal(jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub})
+	resp, err := http.Post(srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.ContentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST submission: %v", err)
+	}
+	resp.Body.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp2, err := http.Get(srv.URL + "/v1/transaction/payments/p1/submissions/s1")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp2.Body.Close()
+
+	var final jsonapi.DataEnvelope[models.PaymentSubmission]
+	json.NewDecoder(resp2.Body).Decode(&final)
+	if final.Data.Attributes.Status != models.StatusFailed {
+		t.Errorf("expected final status failed, got %s", final.Data.Attributes.Status)
+	}
+	if final.Data.Attributes.SchemeStatusCode != "AM04" {
+		t.Errorf("expected scheme status code AM04, got %q", final.Data.Attributes.SchemeStatusCode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"validation_pending", "limit_check_pending", "failed"}
+	if len(notified) != len(want) {
+		t.Fatalf("expected notifications %v, got %v", want, notified)
+	}
+	for i := range want {
+		if notified[i] != want[i] {
+			t.Errorf("notification %d: expected %s, got %s", i, want[i], notified[i])
+		}
+	}
+}
+
 func TestSubmissionRequiresPayment(t *testing.T) {
 	srv := setupServer()
 	defer srv.Close()
@@ -385,3 +462,1343 @@ func TestPaymentRelationships(t *testing.T) {
 		t.Errorf("expected 1 submission relationship, got %d", len(got.Data.Relationships.PaymentSubmissions.Data))
 	}
 }
+
+// doJSON sends body (if any) as JSON:API and decodes the response into out (if any).
+func doJSON(t *testing.T, method, url string, body, out any) int {
+	t.Helper()
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, rd)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", jsonapi.ContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestFreezeClockEarlier(t *testing.T) {
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, clock.NewVirtual(), nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	start := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	freeze := func(at time.Time) handlers.ClockState {
+		t.Helper()
+		var state jsonapi.DataEnvelope[handlers.ClockState]
+		cmd := jsonapi.DataEnvelope[handlers.ClockCommand]{Data: handlers.ClockCommand{At: &at}}
+		if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/clock/freeze", cmd, &state); code != http.StatusOK {
+			t.Fatalf("freeze at %s: expected 200, got %d", at, code)
+		}
+		return state.Data
+	}
+	freeze(start)
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	sub := models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+
+	// Moving the clock back keeps the pending transition at its due time.
+	earlier := start.Add(-time.Hour)
+	state := freeze(earlier)
+	due := start.Add(time.Second)
+	if !state.Now.Equal(earlier) || state.NextDue == nil || !state.NextDue.Equal(due) {
+		t.Fatalf("expected clock at %s with next due %s, got %+v", earlier, due, state)
+	}
+
+	advance := jsonapi.DataEnvelope[handlers.ClockCommand]{Data: handlers.ClockCommand{Duration: "30m"}}
+	doJSON(t, http.MethodPost, srv.URL+"/__admin/clock/advance", advance, nil)
+	var got jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "accepted" {
+		t.Fatalf("expected accepted before the clock catches up, got %s", got.Data.Attributes.Status)
+	}
+
+	next := jsonapi.DataEnvelope[handlers.ClockCommand]{Data: handlers.ClockCommand{ToNext: true}}
+	doJSON(t, http.MethodPost, srv.URL+"/__admin/clock/advance", next, nil)
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "validation_pending" {
+		t.Errorf("expected validation_pending, got %s", got.Data.Attributes.Status)
+	}
+	if !got.Data.ModifiedOn.Equal(due) {
+		t.Errorf("expected modified_on %s, got %s", due, got.Data.ModifiedOn)
+	}
+}
+
+func TestVirtualClock(t *testing.T) {
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, clock.NewVirtual(), nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	start := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	var state jsonapi.DataEnvelope[handlers.ClockState]
+	cmd := jsonapi.DataEnvelope[handlers.ClockCommand]{Data: handlers.ClockCommand{At: &start}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/clock/freeze", cmd, &state); code != http.StatusOK {
+		t.Fatalf("freeze: expected 200, got %d", code)
+	}
+	if !state.Data.Frozen || !state.Data.Now.Equal(start) {
+		t.Fatalf("expected clock frozen at %s, got %+v", start, state.Data)
+	}
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	var created jsonapi.DataEnvelope[models.Payment]
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, &created)
+	if !created.Data.CreatedOn.Equal(start) {
+		t.Errorf("expected created_on %s, got %s", start, created.Data.CreatedOn)
+	}
+
+	sub := models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+
+	// Nothing moves while frozen.
+	time.Sleep(20 * time.Millisecond)
+	var got jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "accepted" {
+		t.Fatalf("expected accepted while frozen, got %s", got.Data.Attributes.Status)
+	}
+
+	// Step to the next transition via the admin API.
+	next := jsonapi.DataEnvelope[handlers.ClockCommand]{Data: handlers.ClockCommand{ToNext: true}}
+	doJSON(t, http.MethodPost, srv.URL+"/__admin/clock/advance", next, &state)
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "validation_pending" {
+		t.Errorf("expected validation_pending, got %s", got.Data.Attributes.Status)
+	}
+	if want := start.Add(time.Second); !got.Data.ModifiedOn.Equal(want) {
+		t.Errorf("expected modified_on %s, got %s", want, got.Data.ModifiedOn)
+	}
+
+	// Advance past the end of the chain through the Go API.
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "delivery_confirmed" {
+		t.Errorf("expected delivery_confirmed, got %s", got.Data.Attributes.Status)
+	}
+	if want := start.Add(7 * time.Second); !got.Data.ModifiedOn.Equal(want) {
+		t.Errorf("expected modified_on %s, got %s", want, got.Data.ModifiedOn)
+	}
+	if engine.Stats().Pending != 0 {
+		t.Errorf("expected no pending transitions, got %d", engine.Stats().Pending)
+	}
+}
+
+func TestForceStatus(t *testing.T) {
+	var mu sync.Mutex
+	var notified []string
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, func(resourceType string, path []string, event, status string) {
+		if resourceType != models.ResourceTypePaymentSubmission || status == "" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, status)
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	sub := models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+
+	force := func(id, status string) (int, handlers.ForcedStatus) {
+		var out jsonapi.DataEnvelope[handlers.ForcedStatus]
+		cmd := jsonapi.DataEnvelope[handlers.StatusCommand]{Data: handlers.StatusCommand{Status: status}}
+		code := doJSON(t, http.MethodPost, srv.URL+"/__admin/resources/payment_submissions/"+id+"/status", cmd, &out)
+		return code, out.Data
+	}
+
+	code, forced := force("s1", "submitted")
+	if code != http.StatusOK {
+		t.Fatalf("force submitted: expected 200, got %d", code)
+	}
+	if forced.PreviousStatus != "accepted" || forced.Status != "submitted" {
+		t.Errorf("unexpected result %+v", forced)
+	}
+	var got jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "submitted" {
+		t.Errorf("expected submitted, got %s", got.Data.Attributes.Status)
+	}
+	mu.Lock()
+	if len(notified) != 6 || notified[5] != "submitted" {
+		t.Errorf("expected 6 notifications ending in submitted, got %v", notified)
+	}
+	mu.Unlock()
+
+	// Going backwards is not a legal transition.
+	if code, _ := force("s1", "accepted"); code != http.StatusConflict {
+		t.Errorf("force accepted: expected 409, got %d", code)
+	}
+	if code, _ := force("missing", "submitted"); code != http.StatusNotFound {
+		t.Errorf("force unknown submission: expected 404, got %d", code)
+	}
+
+	// A branch the engine never picks at random can still be forced.
+	if code, _ := force("s1", "delivery_failed"); code != http.StatusOK {
+		t.Fatalf("force delivery_failed: expected 200, got %d", code)
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "delivery_failed" {
+		t.Errorf("expected delivery_failed to stick, got %s", got.Data.Attributes.Status)
+	}
+	if engine.Stats().Pending != 0 {
+		t.Errorf("expected no pending transitions, got %d", engine.Stats().Pending)
+	}
+
+	// Submission IDs are only unique within a payment.
+	payment.ID = "p2"
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p2/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+	if code, _ := force("s1", "submitted"); code != http.StatusConflict {
+		t.Errorf("force ambiguous submission: expected 409, got %d", code)
+	}
+}
+
+func TestHoldAtHeader(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+
+	submit := func(id, holdAt string) int {
+		body, _ := json.Marshal(jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: id}}})
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Content-Type", jsonapi.ContentType)
+		req.Header.Set(handlers.HoldAtHeader, holdAt)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST submission: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := submit("bad", "nowhere"); code != http.StatusBadRequest {
+		t.Errorf("unknown hold status: expected 400, got %d", code)
+	}
+	if code := submit("s1", "released_to_gateway"); code != http.StatusCreated {
+		t.Fatalf("create submission: expected 201, got %d", code)
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	var got jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "released_to_gateway" {
+		t.Fatalf("expected to be held at released_to_gateway, got %s", got.Data.Attributes.Status)
+	}
+	var holds jsonapi.ListEnvelope[lifecycle.Hold]
+	doJSON(t, http.MethodGet, srv.URL+"/__admin/holds", nil, &holds)
+	if len(holds.Data) != 1 || holds.Data[0].ID != "s1" || !holds.Data[0].Held {
+		t.Fatalf("expected s1 to be listed as held, got %+v", holds.Data)
+	}
+
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/resources/payment_submissions/s1/release", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("release: expected 204, got %d", code)
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1/submissions/s1", nil, &got)
+	if got.Data.Attributes.Status != "delivery_confirmed" {
+		t.Errorf("expected delivery_confirmed after release, got %s", got.Data.Attributes.Status)
+	}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/resources/payment_submissions/s1/pause", nil, nil); code != http.StatusConflict {
+		t.Errorf("pause finished lifecycle: expected 409, got %d", code)
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	vc := clock.NewVirtual()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	vc.Set(start)
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	engine.SetOutcomeSelector(func(p models.Payment) lifecycle.Outcome {
+		if p.ID == "p-fail" {
+			return lifecycle.Outcome{Status: "failed", At: "limit_check_pending", SchemeStatusCode: "AM04"}
+		}
+		return lifecycle.OutcomeDelivered
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	for _, id := range []string{"p-fail", "p-ok"} {
+		payment := models.Payment{Resource: models.Resource{ID: id}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+		doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+		sub := models.PaymentSubmission{Resource: models.Resource{ID: "s-" + id}}
+		doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/"+id+"/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+	}
+	cmd := jsonapi.DataEnvelope[handlers.StatusCommand]{Data: handlers.StatusCommand{Status: "limit_check_passed"}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/resources/payment_submissions/s-p-ok/status", cmd, nil); code != http.StatusOK {
+		t.Fatalf("force: expected 200, got %d", code)
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	var history jsonapi.ListEnvelope[models.StatusTransition]
+	if code := doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p-fail/submissions/s-p-fail/history", nil, &history); code != http.StatusOK {
+		t.Fatalf("history: expected 200, got %d", code)
+	}
+	want := []models.StatusTransition{
+		{From: "accepted", To: "validation_pending", At: start.Add(time.Second), Trigger: models.TriggerEngine},
+		{From: "validation_pending", To: "limit_check_pending", At: start.Add(2 * time.Second), Trigger: models.TriggerEngine},
+		{From: "limit_check_pending", To: "failed", At: start.Add(3 * time.Second), Trigger: models.TriggerRule},
+	}
+	if len(history.Data) != len(want) {
+		t.Fatalf("expected %d transitions, got %+v", len(want), history.Data)
+	}
+	for i, tr := range history.Data {
+		if tr.From != want[i].From || tr.To != want[i].To || !tr.At.Equal(want[i].At) || tr.Trigger != want[i].Trigger {
+			t.Errorf("transition %d: expected %+v, got %+v", i, want[i], tr)
+		}
+	}
+
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p-ok/submissions/s-p-ok/history", nil, &history)
+	if len(history.Data) != 7 {
+		t.Fatalf("expected 7 transitions, got %+v", history.Data)
+	}
+	for i, tr := range history.Data {
+		trigger := models.TriggerEngine
+		if i < 3 {
+			trigger = models.TriggerAdmin
+		}
+		if tr.Trigger != trigger {
+			t.Errorf("transition %d to %s: expected trigger %s, got %s", i, tr.To, trigger, tr.Trigger)
+		}
+	}
+
+	if code := doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p-ok/submissions/missing/history", nil, nil); code != http.StatusNotFound {
+		t.Errorf("history of unknown submission: expected 404, got %d", code)
+	}
+}
+
+func TestPaymentAggregateStatus(t *testing.T) {
+	var mu sync.Mutex
+	var updates []string
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, func(resourceType string, path []string, event, status string) {
+		if resourceType == models.ResourceTypePayment && event == models.EventUpdated {
+			mu.Lock()
+			defer mu.Unlock()
+			updates = append(updates, path[0]+":"+event)
+		}
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	paymentStatus := func() models.Payment {
+		var got jsonapi.DataEnvelope[models.Payment]
+		doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1", nil, &got)
+		return got.Data
+	}
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	if p := paymentStatus(); p.Attributes.Status != models.PaymentStatusPending || p.Version != 0 {
+		t.Fatalf("expected pending at version 0, got %s at %d", p.Attributes.Status, p.Version)
+	}
+
+	sub := models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: sub}, nil)
+	if p := paymentStatus(); p.Attributes.Status != models.PaymentStatusSubmitted || p.Version != 1 {
+		t.Errorf("expected submitted at version 1, got %s at %d", p.Attributes.Status, p.Version)
+	}
+
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if p := paymentStatus(); p.Attributes.Status != models.PaymentStatusDelivered || p.Version != 2 {
+		t.Errorf("expected delivered at version 2, got %s at %d", p.Attributes.Status, p.Version)
+	}
+
+	ret := models.ReturnPayment{Resource: models.Resource{ID: "r1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/returns", jsonapi.DataEnvelope[models.ReturnPayment]{Data: ret}, nil)
+	retSub := models.ReturnSubmission{Resource: models.Resource{ID: "rs1"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/returns/r1/submissions", jsonapi.DataEnvelope[models.ReturnSubmission]{Data: retSub}, nil)
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if p := paymentStatus(); p.Attributes.Status != models.PaymentStatusReturned || p.Version != 3 {
+		t.Errorf("expected returned at version 3, got %s at %d", p.Attributes.Status, p.Version)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 3 || updates[0] != "p1:updated" {
+		t.Errorf("expected 3 payment updated notifications, got %v", updates)
+	}
+}
+
+func TestRejectedRecallPaymentStatus(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	base := srv.URL + "/v1/transaction/payments/p1"
+	paymentStatus := func() string {
+		var got jsonapi.DataEnvelope[models.Payment]
+		doJSON(t, http.MethodGet, base, nil, &got)
+		return got.Data.Attributes.Status
+	}
+	advance := func() {
+		if err := engine.Advance(time.Minute); err != nil {
+			t.Fatalf("Advance: %v", err)
+		}
+	}
+
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	doJSON(t, http.MethodPost, base+"/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}}, nil)
+	advance()
+
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec1"}}}, nil)
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/submissions", jsonapi.DataEnvelope[models.RecallSubmission]{Data: models.RecallSubmission{Resource: models.Resource{ID: "rcs1"}}}, nil)
+	advance()
+	if s := paymentStatus(); s != models.PaymentStatusDelivered {
+		t.Errorf("recall awaiting a decision: expected delivered, got %s", s)
+	}
+
+	decision := models.RecallDecision{Resource: models.Resource{ID: "dec1"}, Attributes: models.RecallDecisionAttributes{Answer: models.RecallAnswerRejected}}
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: decision}, nil)
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions/dec1/submissions", jsonapi.DataEnvelope[models.RecallDecisionSubmission]{Data: models.RecallDecisionSubmission{Resource: models.Resource{ID: "ds1"}}}, nil)
+	advance()
+
+	var rec jsonapi.DataEnvelope[models.Recall]
+	doJSON(t, http.MethodGet, base+"/recalls/rec1", nil, &rec)
+	if rec.Data.Attributes.Status != models.StatusRejected {
+		t.Fatalf("expected a rejected recall, got %s", rec.Data.Attributes.Status)
+	}
+	if s := paymentStatus(); s != models.PaymentStatusDelivered {
+		t.Errorf("rejected recall: expected delivered, got %s", s)
+	}
+}
+
+func TestExceptionLifecycles(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	base := srv.URL + "/v1/transaction/payments/p1"
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+
+	returnStatus := func() string {
+		var got jsonapi.DataEnvelope[models.ReturnPayment]
+		doJSON(t, http.MethodGet, base+"/returns/r1", nil, &got)
+		return got.Data.Attributes.SchemeStatus
+	}
+	recallStatus := func() string {
+		var got jsonapi.DataEnvelope[models.Recall]
+		doJSON(t, http.MethodGet, base+"/recalls/rec1", nil, &got)
+		return got.Data.Attributes.Status
+	}
+
+	doJSON(t, http.MethodPost, base+"/returns", jsonapi.DataEnvelope[models.ReturnPayment]{Data: models.ReturnPayment{Resource: models.Resource{ID: "r1"}}}, nil)
+	if s := returnStatus(); s != models.StatusPending {
+		t.Errorf("new return: expected pending, got %s", s)
+	}
+	doJSON(t, http.MethodPost, base+"/returns/r1/submissions", jsonapi.DataEnvelope[models.ReturnSubmission]{Data: models.ReturnSubmission{Resource: models.Resource{ID: "rs1"}}}, nil)
+	if s := returnStatus(); s != models.StatusSubmitted {
+		t.Errorf("submitted return: expected submitted, got %s", s)
+	}
+
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec1"}}}, nil)
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/submissions", jsonapi.DataEnvelope[models.RecallSubmission]{Data: models.RecallSubmission{Resource: models.Resource{ID: "rcs1"}}}, nil)
+	if s := recallStatus(); s != models.StatusPending {
+		t.Errorf("submitted recall: expected pending, got %s", s)
+	}
+
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if s := returnStatus(); s != models.StatusCompleted {
+		t.Errorf("delivered return: expected completed, got %s", s)
+	}
+	if s := recallStatus(); s != models.StatusAwaitingDecision {
+		t.Errorf("delivered recall: expected awaiting_decision, got %s", s)
+	}
+
+	decision := models.RecallDecision{Resource: models.Resource{ID: "dec1"}, Attributes: models.RecallDecisionAttributes{Answer: models.RecallAnswerRejected}}
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: decision}, nil)
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions/dec1/submissions", jsonapi.DataEnvelope[models.RecallDecisionSubmission]{Data: models.RecallDecisionSubmission{Resource: models.Resource{ID: "ds1"}}}, nil)
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if s := recallStatus(); s != models.StatusRejected {
+		t.Errorf("decided recall: expected rejected, got %s", s)
+	}
+
+	var history jsonapi.ListEnvelope[models.StatusTransition]
+	if code := doJSON(t, http.MethodGet, base+"/recalls/rec1/history", nil, &history); code != http.StatusOK {
+		t.Fatalf("history: expected 200, got %d", code)
+	}
+	if len(history.Data) != 2 || history.Data[0].To != models.StatusAwaitingDecision || history.Data[1].To != models.StatusRejected {
+		t.Errorf("unexpected recall history: %+v", history.Data)
+	}
+}
+
+func TestRecallDecisionFollowUps(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	base := srv.URL + "/v1/transaction/payments/p1"
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "25.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+
+	bad := models.RecallDecision{Attributes: models.RecallDecisionAttributes{Answer: "maybe"}}
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec0"}}}, nil)
+	if code := doJSON(t, http.MethodPost, base+"/recalls/rec0/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: bad}, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown answer: expected 400, got %d", code)
+	}
+
+	decide := func(recallID, answer, reason string) {
+		doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: recallID}}}, nil)
+		doJSON(t, http.MethodPost, base+"/recalls/"+recallID+"/submissions", jsonapi.DataEnvelope[models.RecallSubmission]{Data: models.RecallSubmission{}}, nil)
+		if err := engine.Advance(time.Minute); err != nil {
+			t.Fatalf("Advance: %v", err)
+		}
+		d := models.RecallDecision{Resource: models.Resource{ID: "d-" + recallID}, Attributes: models.RecallDecisionAttributes{Answer: answer, Reason: reason}}
+		doJSON(t, http.MethodPost, base+"/recalls/"+recallID+"/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: d}, nil)
+		doJSON(t, http.MethodPost, base+"/recalls/"+recallID+"/decisions/d-"+recallID+"/submissions", jsonapi.DataEnvelope[models.RecallDecisionSubmission]{Data: models.RecallDecisionSubmission{}}, nil)
+		if err := engine.Advance(time.Minute); err != nil {
+			t.Fatalf("Advance: %v", err)
+		}
+	}
+	decide("rec1", models.RecallAnswerRejected, "funds already withdrawn")
+	decide("rec2", models.RecallAnswerAccepted, "")
+
+	var rec jsonapi.DataEnvelope[models.Recall]
+	doJSON(t, http.MethodGet, base+"/recalls/rec1", nil, &rec)
+	if rec.Data.Attributes.Status != models.StatusRejected || rec.Data.Attributes.DecisionReason != "funds already withdrawn" {
+		t.Errorf("rejected recall: got status %s, reason %q", rec.Data.Attributes.Status, rec.Data.Attributes.DecisionReason)
+	}
+
+	var returns jsonapi.ListEnvelope[models.ReturnPayment]
+	doJSON(t, http.MethodGet, base+"/returns", nil, &returns)
+	if len(returns.Data) != 1 {
+		t.Fatalf("expected 1 return, got %d", len(returns.Data))
+	}
+	ret := returns.Data[0]
+	if ret.Attributes.RecallID != "rec2" || ret.Attributes.Amount != "25.00" || ret.Attributes.Currency != "GBP" {
+		t.Errorf("unexpected return: %+v", ret.Attributes)
+	}
+	// The return's submission was delivered within the same Advance.
+	if ret.Attributes.SchemeStatus != models.StatusCompleted {
+		t.Errorf("delivered return: expected completed, got %s", ret.Attributes.SchemeStatus)
+	}
+	var history jsonapi.ListEnvelope[models.StatusTransition]
+	doJSON(t, http.MethodGet, base+"/returns/"+ret.ID+"/history", nil, &history)
+	if len(history.Data) != 2 || history.Data[0].To != models.StatusSubmitted {
+		t.Errorf("unexpected return history: %+v", history.Data)
+	}
+	var p jsonapi.DataEnvelope[models.Payment]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p1", nil, &p)
+	if p.Data.Attributes.Status != models.PaymentStatusReturned {
+		t.Errorf("expected payment returned, got %s", p.Data.Attributes.Status)
+	}
+
+	late := models.RecallDecision{Attributes: models.RecallDecisionAttributes{Answer: models.RecallAnswerAccepted}}
+	if code := doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: late}, nil); code != http.StatusConflict {
+		t.Errorf("decided recall: expected 409, got %d", code)
+	}
+
+	// A decision delivered while the recall is pending waits for it.
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec3"}}}, nil)
+	early := models.RecallDecision{Resource: models.Resource{ID: "d-rec3"}, Attributes: models.RecallDecisionAttributes{Answer: models.RecallAnswerRejected, Reason: "account closed"}}
+	if code := doJSON(t, http.MethodPost, base+"/recalls/rec3/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: early}, nil); code != http.StatusCreated {
+		t.Fatalf("pending recall: expected 201, got %d", code)
+	}
+	doJSON(t, http.MethodPost, base+"/recalls/rec3/decisions/d-rec3/submissions", jsonapi.DataEnvelope[models.RecallDecisionSubmission]{Data: models.RecallDecisionSubmission{}}, nil)
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	doJSON(t, http.MethodGet, base+"/recalls/rec3", nil, &rec)
+	if rec.Data.Attributes.Status != models.StatusPending {
+		t.Errorf("early decision: expected the recall to stay pending, got %s", rec.Data.Attributes.Status)
+	}
+	doJSON(t, http.MethodPost, base+"/recalls/rec3/submissions", jsonapi.DataEnvelope[models.RecallSubmission]{Data: models.RecallSubmission{}}, nil)
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	doJSON(t, http.MethodGet, base+"/recalls/rec3", nil, &rec)
+	if rec.Data.Attributes.Status != models.StatusRejected || rec.Data.Attributes.DecisionReason != "account closed" {
+		t.Errorf("early decision: got status %s, reason %q", rec.Data.Attributes.Status, rec.Data.Attributes.DecisionReason)
+	}
+
+	// A recall forced to accepted is paid back like a decided one.
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec4"}}}, nil)
+	force := jsonapi.DataEnvelope[handlers.StatusCommand]{Data: handlers.StatusCommand{Status: models.StatusAccepted}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/resources/"+models.ResourceTypeRecall+"/rec4/status", force, nil); code != http.StatusOK {
+		t.Fatalf("force: expected 200, got %d", code)
+	}
+	doJSON(t, http.MethodGet, base+"/returns", nil, &returns)
+	if len(returns.Data) != 2 {
+		t.Fatalf("forced recall: expected 2 returns, got %d", len(returns.Data))
+	}
+}
+
+func TestAdmissionTasks(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	engine.SetTaskSelector(func(p models.Payment) []string {
+		if p.Attributes.Amount == "5000.00" {
+			return []string{"manual_review", "name_mismatch"}
+		}
+		return nil
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	for _, id := range []string{"p-big", "p-small"} {
+		amount := "5000.00"
+		if id == "p-small" {
+			amount = "1.00"
+		}
+		payment := models.Payment{Resource: models.Resource{ID: id}, Attributes: models.PaymentAttributes{Amount: amount, Currency: "GBP"}}
+		doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	}
+	admit := func(paymentID, admissionID string) string {
+		url := srv.URL + "/v1/transaction/payments/" + paymentID + "/admissions"
+		doJSON(t, http.MethodPost, url, jsonapi.DataEnvelope[models.PaymentAdmission]{Data: models.PaymentAdmission{Resource: models.Resource{ID: admissionID}}}, nil)
+		return url + "/" + admissionID
+	}
+	status := func(url string) string {
+		var got jsonapi.DataEnvelope[models.PaymentAdmission]
+		doJSON(t, http.MethodGet, url, nil, &got)
+		return got.Data.Attributes.Status
+	}
+	tasks := func(url string) []models.AdmissionTask {
+		var got jsonapi.ListEnvelope[models.AdmissionTask]
+		if code := doJSON(t, http.MethodGet, url+"/tasks", nil, &got); code != http.StatusOK {
+			t.Fatalf("list tasks: expected 200, got %d", code)
+		}
+		return got.Data
+	}
+	complete := func(url, taskID, outcome string) {
+		patch := models.AdmissionTask{Attributes: models.AdmissionTaskAttributes{Status: models.StatusCompleted, Outcome: outcome}}
+		if code := doJSON(t, http.MethodPatch, url+"/tasks/"+taskID, jsonapi.DataEnvelope[models.AdmissionTask]{Data: patch}, nil); code != http.StatusOK {
+			t.Fatalf("patch task: expected 200, got %d", code)
+		}
+	}
+
+	small := admit("p-small", "a-small")
+	failing := admit("p-big", "a-fail")
+	early := admit("p-big", "a-early")
+	if n := len(tasks(small)); n != 0 {
+		t.Errorf("expected no tasks, got %d", n)
+	}
+	for _, task := range tasks(early) {
+		complete(early, task.ID, "")
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if s := status(small); s != models.StatusConfirmed {
+		t.Errorf("admission without tasks: expected confirmed, got %s", s)
+	}
+	if s := status(early); s != models.StatusConfirmed {
+		t.Errorf("admission with tasks done early: expected confirmed, got %s", s)
+	}
+
+	pending := tasks(failing)
+	if len(pending) != 2 || pending[0].Attributes.Status != models.StatusPending {
+		t.Fatalf("expected 2 pending tasks, got %+v", pending)
+	}
+	if s := status(failing); s != models.StatusPendingTasks {
+		t.Fatalf("expected pending_tasks, got %s", s)
+	}
+	complete(failing, pending[0].ID, models.TaskOutcomeFailed)
+	if s := status(failing); s != models.StatusPendingTasks {
+		t.Errorf("one task left: expected pending_tasks, got %s", s)
+	}
+	complete(failing, pending[1].ID, models.TaskOutcomePassed)
+	if s := status(failing); s != models.StatusFailed {
+		t.Errorf("failed task: expected failed, got %s", s)
+	}
+
+	bad := models.AdmissionTask{Attributes: models.AdmissionTaskAttributes{Status: "done"}}
+	if code := doJSON(t, http.MethodPatch, failing+"/tasks/"+pending[0].ID, jsonapi.DataEnvelope[models.AdmissionTask]{Data: bad}, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown task status: expected 400, got %d", code)
+	}
+}
+
+func TestInboundCredit(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, func(resourceType string, path []string, event, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, resourceType+":"+event)
+	})
+	s := store.NewMemoryStore()
+	s.SetTransitionRule(engine.Legal)
+	mux := http.NewServeMux()
+	sim := handlers.RegisterRoutes(mux, s, engine)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	credit := handlers.InboundCredit{
+		PaymentID:        "in-1",
+		Amount:           "42.00",
+		Reference:        "rent",
+		DebtorParty:      &models.AccountParty{AccountName: "A Payer", SortCode: "040004", AccountNumber: "12345678"},
+		BeneficiaryParty: &models.AccountParty{SortCode: "400300", AccountNumber: "87654321"},
+	}
+	var got jsonapi.DataEnvelope[handlers.InboundPayment]
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/inbound-payments", jsonapi.DataEnvelope[handlers.InboundCredit]{Data: credit}, &got); code != http.StatusCreated {
+		t.Fatalf("inbound credit: expected 201, got %d", code)
+	}
+	if got.Data.Payment.ID != "in-1" || got.Data.Payment.Attributes.Currency != "GBP" || got.Data.Admission.Attributes.Status != models.StatusPending {
+		t.Errorf("unexpected inbound payment: %+v", got.Data)
+	}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/inbound-payments", jsonapi.DataEnvelope[handlers.InboundCredit]{Data: handlers.InboundCredit{Amount: "1.00"}}, nil); code != http.StatusBadRequest {
+		t.Errorf("missing beneficiary: expected 400, got %d", code)
+	}
+	for _, amount := range []string{"ten", "1.005", "-5.00", "0.00"} {
+		bad := credit
+		bad.PaymentID, bad.Amount = "in-bad", amount
+		if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/inbound-payments", jsonapi.DataEnvelope[handlers.InboundCredit]{Data: bad}, nil); code != http.StatusBadRequest {
+			t.Errorf("amount %q: expected 400, got %d", amount, code)
+		}
+	}
+
+	// The Go API does the same.
+	credit.PaymentID = "in-2"
+	if _, err := sim.Receive(credit); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if _, err := sim.Receive(credit); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("duplicate payment: expected ErrConflict, got %v", err)
+	}
+
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	var adm jsonapi.DataEnvelope[models.PaymentAdmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/in-1/admissions/"+got.Data.Admission.ID, nil, &adm)
+	if adm.Data.Attributes.Status != models.StatusConfirmed {
+		t.Errorf("expected confirmed admission, got %s", adm.Data.Attributes.Status)
+	}
+	var p jsonapi.DataEnvelope[models.Payment]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/in-1", nil, &p)
+	if p.Data.Attributes.Status != models.PaymentStatusReceived {
+		t.Errorf("expected received payment, got %s", p.Data.Attributes.Status)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"payments:created", "payment_admissions:created"}
+	if len(events) < 2 || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("expected created notifications first, got %v", events)
+	}
+	if !slices.Contains(events, "payments:updated") {
+		t.Errorf("expected a payment updated notification, got %v", events)
+	}
+}
+
+func TestAccountRegistry(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	s := store.NewMemoryStore()
+	s.SetTransitionRule(engine.Legal)
+	mux := http.NewServeMux()
+	sim := handlers.RegisterRoutes(mux, s, engine, handlers.WithStrictAccounts(true))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	accounts := srv.URL + "/__admin/accounts/"
+	put := func(sortCode, accountNumber, state string) int {
+		a := models.Account{AccountName: "Test", State: state}
+		return doJSON(t, http.MethodPut, accounts+sortCode+"/"+accountNumber, jsonapi.DataEnvelope[models.Account]{Data: a}, nil)
+	}
+	if code := put("400300", "11111111", ""); code != http.StatusOK {
+		t.Fatalf("put open account: expected 200, got %d", code)
+	}
+	put("400300", "22222222", models.AccountStateClosed)
+	put("400300", "33333333", models.AccountStateDeceased)
+	if code := put("400300", "44444444", "dormant"); code != http.StatusBadRequest {
+		t.Errorf("unknown state: expected 400, got %d", code)
+	}
+	var list jsonapi.ListEnvelope[models.Account]
+	doJSON(t, http.MethodGet, srv.URL+"/__admin/accounts", nil, &list)
+	if len(list.Data) != 3 || list.Data[0].State != models.AccountStateOpen {
+		t.Errorf("unexpected accounts: %+v", list.Data)
+	}
+
+	// Outbound to a closed account fails with the closed account reason.
+	payment := models.Payment{
+		Resource:   models.Resource{ID: "out-1"},
+		Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP", BeneficiaryParty: &models.AccountParty{SortCode: "400300", AccountNumber: "22222222"}},
+	}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/out-1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: "sub-1"}}}, nil)
+
+	// Inbound to open, deceased and unknown accounts.
+	admissions := map[string]string{}
+	for id, number := range map[string]string{"in-open": "11111111", "in-deceased": "33333333", "in-unknown": "99999999"} {
+		in, err := sim.Receive(handlers.InboundCredit{PaymentID: id, Amount: "5.00", BeneficiaryParty: &models.AccountParty{SortCode: "400300", AccountNumber: number}})
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		admissions[id] = in.Admission.ID
+	}
+
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	var sub jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/out-1/submissions/sub-1", nil, &sub)
+	if sub.Data.Attributes.Status != models.StatusDeliveryFailed || sub.Data.Attributes.SchemeStatusCode != handlers.ReasonClosedAccount {
+		t.Errorf("closed account: got %s (%s)", sub.Data.Attributes.Status, sub.Data.Attributes.SchemeStatusCode)
+	}
+	for id, want := range map[string][2]string{
+		"in-open":     {models.StatusConfirmed, ""},
+		"in-deceased": {models.StatusFailed, handlers.ReasonDeceased},
+		"in-unknown":  {models.StatusFailed, handlers.ReasonIncorrectAccount},
+	} {
+		var adm jsonapi.DataEnvelope[models.PaymentAdmission]
+		doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/"+id+"/admissions/"+admissions[id], nil, &adm)
+		if got := [2]string{adm.Data.Attributes.Status, adm.Data.Attributes.SchemeStatusCode}; got != want {
+			t.Errorf("%s: expected %v, got %v", id, want, got)
+		}
+	}
+
+	if code := doJSON(t, http.MethodDelete, accounts+"400300/22222222", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, accounts+"400300/22222222", nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleted account: expected 404, got %d", code)
+	}
+}
+
+func TestUnregisteredAccountsAcceptedUnlessStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		vc := clock.NewVirtual()
+		vc.Freeze()
+		engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+		s := store.NewMemoryStore()
+		s.SetTransitionRule(engine.Legal)
+		sim := handlers.RegisterRoutes(http.NewServeMux(), s, engine, handlers.WithStrictAccounts(strict))
+
+		// Registering one account does not make every other one unknown.
+		if err := s.PutAccount(models.Account{SortCode: "400300", AccountNumber: "11111111", AccountName: "Debtor", State: models.AccountStateOpen}); err != nil {
+			t.Fatalf("PutAccount: %v", err)
+		}
+		in, err := sim.Receive(handlers.InboundCredit{PaymentID: "in-1", Amount: "5.00", BeneficiaryParty: &models.AccountParty{SortCode: "400300", AccountNumber: "99999999"}})
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		if err := engine.Advance(time.Minute); err != nil {
+			t.Fatalf("Advance: %v", err)
+		}
+		a, err := s.GetPaymentAdmission("in-1", in.Admission.ID)
+		if err != nil {
+			t.Fatalf("GetPaymentAdmission: %v", err)
+		}
+		want := models.StatusConfirmed
+		if strict {
+			want = models.StatusFailed
+		}
+		if a.Attributes.Status != want {
+			t.Errorf("strict %t: expected %s, got %s", strict, want, a.Attributes.Status)
+		}
+	}
+}
+
+func TestLedger(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	s := store.NewMemoryStore()
+	s.SetTransitionRule(engine.Legal)
+	mux := http.NewServeMux()
+	sim := handlers.RegisterRoutes(mux, s, engine)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	doJSON(t, http.MethodPut, srv.URL+"/__admin/accounts/400300/11111111", jsonapi.DataEnvelope[models.Account]{Data: models.Account{AccountName: "Debtor"}}, nil)
+	var funded jsonapi.DataEnvelope[ledger.Balance]
+	adjust := jsonapi.DataEnvelope[handlers.Adjustment]{Data: handlers.Adjustment{Amount: "10.00", Currency: "GBP"}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/__admin/ledger/accounts/400300/11111111/adjustments", adjust, &funded); code != http.StatusCreated {
+		t.Fatalf("adjust: expected 201, got %d", code)
+	}
+	if funded.Data.Available != "10.00" {
+		t.Fatalf("expected 10.00 available, got %+v", funded.Data)
+	}
+
+	doJSON(t, http.MethodPut, srv.URL+"/__admin/accounts/200000/33333333", jsonapi.DataEnvelope[models.Account]{Data: models.Account{AccountName: "Closed", State: models.AccountStateClosed}}, nil)
+
+	debtor := &models.AccountParty{SortCode: "400300", AccountNumber: "11111111"}
+	pay := func(id, amount, beneficiary string) {
+		payment := models.Payment{
+			Resource:   models.Resource{ID: id},
+			Attributes: models.PaymentAttributes{Amount: amount, Currency: "GBP", DebtorParty: debtor, BeneficiaryParty: &models.AccountParty{SortCode: "200000", AccountNumber: beneficiary}},
+		}
+		doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+		doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/"+id+"/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: id + "-sub"}}}, nil)
+	}
+	pay("p1", "6.00", "22222222")
+	pay("p2", "6.00", "22222222") // only 4.00 is left once p1 is reserved
+	// Rejected by the closed beneficiary after release, so it needs the
+	// funds all the same.
+	pay("p3", "20.00", "33333333")
+	if _, err := sim.Receive(handlers.InboundCredit{PaymentID: "in-1", Amount: "2.50", BeneficiaryParty: debtor}); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	var sub jsonapi.DataEnvelope[models.PaymentSubmission]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p2/submissions/p2-sub", nil, &sub)
+	if sub.Data.Attributes.Status != models.StatusFailed || sub.Data.Attributes.SchemeStatusCode != handlers.ReasonInsufficientFunds {
+		t.Errorf("p2: expected failed (AM04), got %s (%s)", sub.Data.Attributes.Status, sub.Data.Attributes.SchemeStatusCode)
+	}
+	var hist jsonapi.ListEnvelope[models.StatusTransition]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p2/submissions/p2-sub/history", nil, &hist)
+	if n := len(hist.Data); n == 0 || hist.Data[n-1].From != models.StatusLimitCheckPending {
+		t.Errorf("p2: expected to fail at the limit check, got %+v", hist.Data)
+	}
+	doJSON(t, http.MethodGet, srv.URL+"/v1/transaction/payments/p3/submissions/p3-sub", nil, &sub)
+	if sub.Data.Attributes.Status != models.StatusFailed || sub.Data.Attributes.SchemeStatusCode != handlers.ReasonInsufficientFunds {
+		t.Errorf("p3: expected failed (AM04), got %s (%s)", sub.Data.Attributes.Status, sub.Data.Attributes.SchemeStatusCode)
+	}
+
+	var balances jsonapi.ListEnvelope[ledger.Balance]
+	doJSON(t, http.MethodGet, srv.URL+"/__admin/ledger/balances", nil, &balances)
+	got := map[string]ledger.Balance{}
+	for _, b := range balances.Data {
+		got[b.Account] = b
+	}
+	// 10.00 funded, 6.00 paid, 2.50 received.
+	if b := got["400300/11111111"]; b.Balance != "6.50" || b.Reserved != "0.00" {
+		t.Errorf("debtor: unexpected balance %+v", b)
+	}
+	if b := got[ledger.SettlementAccount]; b.Balance != "3.50" {
+		t.Errorf("settlement: unexpected balance %+v", b)
+	}
+
+	var postings jsonapi.ListEnvelope[ledger.Posting]
+	doJSON(t, http.MethodGet, srv.URL+"/__admin/ledger/postings?account=400300/11111111", nil, &postings)
+	var kinds []string
+	for _, p := range postings.Data {
+		kinds = append(kinds, p.Kind+" "+p.Amount)
+	}
+	slices.Sort(kinds)
+	if want := []string{"adjustment 10.00", "admission 2.50", "payment -6.00"}; !slices.Equal(kinds, want) {
+		t.Errorf("expected postings %v, got %v", want, kinds)
+	}
+}
+
+func TestReservationReleasedWhenLifecycleDropped(t *testing.T) {
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, nil)
+	s := store.NewMemoryStore()
+	s.SetTransitionRule(engine.Legal)
+	mux := http.NewServeMux()
+	handlers.RegisterRoutes(mux, s, engine)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if err := s.PutAccount(models.Account{SortCode: "400300", AccountNumber: "11111111", AccountName: "Debtor", State: models.AccountStateOpen}); err != nil {
+		t.Fatalf("PutAccount: %v", err)
+	}
+	payment := models.Payment{
+		Resource:   models.Resource{ID: "p1"},
+		Attributes: models.PaymentAttributes{Amount: "6.00", Currency: "GBP", DebtorParty: &models.AccountParty{SortCode: "400300", AccountNumber: "11111111"}},
+	}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil); code != http.StatusCreated {
+		t.Fatalf("create payment: expected 201, got %d", code)
+	}
+	adjust := jsonapi.DataEnvelope[handlers.Adjustment]{Data: handlers.Adjustment{Amount: "10.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/__admin/ledger/accounts/400300/11111111/adjustments", adjust, nil)
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments/p1/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}}, nil); code != http.StatusCreated {
+		t.Fatalf("create submission: expected 201, got %d", code)
+	}
+	if b := s.Ledger().Balance("400300/11111111"); b.Reserved != "6.00" {
+		t.Fatalf("expected 6.00 reserved, got %+v", b)
+	}
+
+	// Abandoned with no journal to resume it from.
+	if err := engine.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if b := s.Ledger().Balance("400300/11111111"); b.Reserved != "0.00" {
+		t.Errorf("expected the reservation to be released, got %+v", b)
+	}
+}
+
+func TestAccountValidation(t *testing.T) {
+	rows, err := modulus.ParseWeights(strings.NewReader("100000 100099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1\n"))
+	if err != nil {
+		t.Fatalf("ParseWeights: %v", err)
+	}
+	table, err := modulus.NewTable(rows, nil)
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	create := func(mode, id string, debtor, beneficiary *models.AccountParty) (int, jsonapi.ErrorResponse) {
+		v, err := handlers.NewAccountValidation(mode, table)
+		if err != nil {
+			t.Fatalf("NewAccountValidation: %v", err)
+		}
+		engine := lifecycle.NewEngine(context.Background(), 10, 1, clock.Real{}, nil)
+		mux := http.NewServeMux()
+		handlers.RegisterRoutes(mux, store.NewMemoryStore(), engine, handlers.WithAccountValidation(v))
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		payment := models.Payment{
+			Resource:   models.Resource{ID: id},
+			Attributes: models.PaymentAttributes{Amount: "1.00", DebtorParty: debtor, BeneficiaryParty: beneficiary},
+		}
+		var errs jsonapi.ErrorResponse
+		code := doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, &errs)
+		return code, errs
+	}
+
+	good := &models.AccountParty{SortCode: "100010", AccountNumber: "18034063"}
+	if code, _ := create(handlers.ValidationStrict, "p1", good, good); code != http.StatusCreated {
+		t.Errorf("valid parties: expected 201, got %d", code)
+	}
+
+	code, errs := create(handlers.ValidationStrict, "p2",
+		&models.AccountParty{SortCode: "10-00-10", AccountNumber: "18034063"},
+		&models.AccountParty{SortCode: "100010", AccountNumber: "87455328"})
+	if code != http.StatusBadRequest {
+		t.Fatalf("invalid parties: expected 400, got %d", code)
+	}
+	var pointers []string
+	for _, e := range errs.Errors {
+		if e.Source != nil {
+			pointers = append(pointers, e.Source.Pointer)
+		}
+	}
+	want := []string{"/data/attributes/beneficiary_party/account_number", "/data/attributes/debtor_party/sort_code"}
+	if !slices.Equal(pointers, want) {
+		t.Errorf("expected errors at %v, got %+v", want, errs.Errors)
+	}
+
+	if code, _ := create(handlers.ValidationLenient, "p3", nil, &models.AccountParty{SortCode: "100010", AccountNumber: "87455328"}); code != http.StatusCreated {
+		t.Errorf("lenient: expected 201, got %d", code)
+	}
+	if _, err := handlers.NewAccountValidation("pedantic", nil); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestConfirmationOfPayee(t *testing.T) {
+	srv := setupServer()
+	defer srv.Close()
+
+	doJSON(t, http.MethodPut, srv.URL+"/__admin/accounts/400300/11111111", jsonapi.DataEnvelope[models.Account]{Data: models.Account{AccountName: "Jonathan Smith"}}, nil)
+	doJSON(t, http.MethodPut, srv.URL+"/__admin/accounts/400300/44444444", jsonapi.DataEnvelope[models.Account]{Data: models.Account{AccountName: "Jane Doe", State: models.AccountStateClosed}}, nil)
+	payment := models.Payment{
+		Resource:   models.Resource{ID: "p1"},
+		Attributes: models.PaymentAttributes{Amount: "1.00", BeneficiaryParty: &models.AccountParty{SortCode: "200000", AccountNumber: "22222222", AccountName: "Acme Widgets Ltd"}},
+	}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+
+	confirm := func(sortCode, accountNumber, name string) models.PayeeConfirmationAttributes {
+		t.Helper()
+		req := models.PayeeConfirmation{Attributes: models.PayeeConfirmationAttributes{SortCode: sortCode, AccountNumber: accountNumber, AccountName: name}}
+		var resp jsonapi.DataEnvelope[models.PayeeConfirmation]
+		if code := doJSON(t, http.MethodPost, srv.URL+"/v1/confirmation-of-payee", jsonapi.DataEnvelope[models.PayeeConfirmation]{Data: req}, &resp); code != http.StatusOK {
+			t.Fatalf("confirm %s: expected 200, got %d", name, code)
+		}
+		if resp.Data.Type != models.ResourceTypePayeeConfirmation || resp.Data.ID == "" {
+			t.Errorf("unexpected resource %s %q", resp.Data.Type, resp.Data.ID)
+		}
+		return resp.Data.Attributes
+	}
+
+	for _, tc := range []struct {
+		sortCode, accountNumber, name string
+		result, reason, suggested     string
+	}{
+		{"400300", "11111111", "Mr Jonathan Smith", models.PayeeMatch, "", ""},
+		{"400300", "11111111", "Jonathon Smith", models.PayeeCloseMatch, handlers.ReasonPayeeCloseMatch, "Jonathan Smith"},
+		{"400300", "11111111", "Peter Parker", models.PayeeNoMatch, handlers.ReasonPayeeNoMatch, ""},
+		{"200000", "22222222", "ACME WIDGETS LTD", models.PayeeMatch, "", ""},
+		{"200000", "33333333", "Acme Widgets Ltd", models.PayeeAccountNotFound, handlers.ReasonIncorrectAccount, ""},
+		{"400300", "44444444", "Jane Doe", models.PayeeAccountNotFound, handlers.ReasonIncorrectAccount, ""},
+	} {
+		got := confirm(tc.sortCode, tc.accountNumber, tc.name)
+		if got.Result != tc.result || got.ReasonCode != tc.reason || got.SuggestedName != tc.suggested {
+			t.Errorf("%s: expected %s/%s/%q, got %s/%s/%q", tc.name, tc.result, tc.reason, tc.suggested, got.Result, got.ReasonCode, got.SuggestedName)
+		}
+	}
+
+	var errs jsonapi.ErrorResponse
+	bad := models.PayeeConfirmation{Attributes: models.PayeeConfirmationAttributes{SortCode: "400300"}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/confirmation-of-payee", jsonapi.DataEnvelope[models.PayeeConfirmation]{Data: bad}, &errs); code != http.StatusBadRequest || len(errs.Errors) != 2 {
+		t.Errorf("missing attributes: expected 400 with 2 errors, got %d %+v", code, errs.Errors)
+	}
+}
+
+// redriver records the dead letters it is asked to redrive.
+type redriver struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *redriver) Redrive(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, id)
+	return nil
+}
+
+func TestDeadLetters(t *testing.T) {
+	engine := lifecycle.NewEngine(context.Background(), 10, 1, clock.Real{}, nil)
+	s := store.NewMemoryStore()
+	rd := &redriver{}
+	mux := http.NewServeMux()
+	handlers.RegisterRoutes(mux, s, engine, handlers.WithRedriver(rd))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for i, id := range []string{"dl-1", "dl-2"} {
+		s.CreateDeadLetter(models.DeadLetter{
+			Resource:   models.Resource{Type: models.ResourceTypeDeadLetter, ID: id, CreatedOn: time.Unix(int64(i), 0)},
+			Attributes: models.DeadLetterAttributes{SubscriptionID: "sub-1", Attempts: 5, LastError: "unexpected status 503"},
+		})
+	}
+	base := srv.URL + "/__admin/dead-letters"
+	var list jsonapi.ListEnvelope[models.DeadLetter]
+	doJSON(t, http.MethodGet, base, nil, &list)
+	if len(list.Data) != 2 || list.Data[0].ID != "dl-1" {
+		t.Fatalf("unexpected dead letters %+v", list.Data)
+	}
+	if code := doJSON(t, http.MethodPost, base+"/dl-1/redrive", nil, nil); code != http.StatusAccepted {
+		t.Errorf("redrive: expected 202, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, base+"/dl-2", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, base+"/dl-2", nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleted: expected 404, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, base+"/redrive", nil, nil); code != http.StatusAccepted {
+		t.Errorf("redrive all: expected 202, got %d", code)
+	}
+	if want := []string{"dl-1", "dl-1"}; !slices.Equal(rd.ids, want) {
+		t.Errorf("expected redrives of %v, got %v", want, rd.ids)
+	}
+}
+
+func TestSubscriptionSigningKeys(t *testing.T) {
+	srv := setupServer()
+	defer srv.Close()
+
+	sub := models.Subscription{
+		Resource: models.Resource{ID: "sub-signed"},
+		Attributes: models.SubscriptionAttributes{
+			CallbackURI: "http://example.com/webhook",
+			RecordType:  "payments",
+			EventType:   "created",
+			SigningKeys: []models.SigningKey{{KeyID: "k1", Algorithm: models.SigningHMACSHA256}},
+		},
+	}
+	var created jsonapi.DataEnvelope[models.Subscription]
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/notification/subscriptions", jsonapi.DataEnvelope[models.Subscription]{Data: sub}, &created); code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", code)
+	}
+	if keys := created.Data.Attributes.SigningKeys; len(keys) != 1 || keys[0].Secret == "" {
+		t.Fatalf("expected a generated secret, got %+v", keys)
+	}
+
+	rotation := handlers.KeyRotation{Key: models.SigningKey{KeyID: "k2", Algorithm: models.SigningEd25519}, OverlapSeconds: 3600}
+	var rotated jsonapi.DataEnvelope[models.Subscription]
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/notification/subscriptions/sub-signed/signing-keys/rotate", jsonapi.DataEnvelope[handlers.KeyRotation]{Data: rotation}, &rotated); code != http.StatusOK {
+		t.Fatalf("rotate: expected 200, got %d", code)
+	}
+	keys := rotated.Data.Attributes.SigningKeys
+	if len(keys) != 2 || keys[0].NotAfter == nil || keys[1].NotBefore == nil || keys[1].PublicKey == "" {
+		t.Fatalf("unexpected keys after rotation %+v", keys)
+	}
+	if overlap := keys[0].NotAfter.Sub(*keys[1].NotBefore); overlap != time.Hour {
+		t.Errorf("expected an hour's overlap, got %s", overlap)
+	}
+	if keys[0].Secret != "" || keys[1].PrivateKey == "" {
+		t.Errorf("expected only the new key's material after rotation, got %+v", keys)
+	}
+
+	// Reads never return key material.
+	var got jsonapi.DataEnvelope[models.Subscription]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/notification/subscriptions/sub-signed", nil, &got)
+	var list jsonapi.ListEnvelope[models.Subscription]
+	doJSON(t, http.MethodGet, srv.URL+"/v1/notification/subscriptions", nil, &list)
+	if len(list.Data) != 1 {
+		t.Fatalf("expected one subscription, got %d", len(list.Data))
+	}
+	for _, keys := range [][]models.SigningKey{got.Data.Attributes.SigningKeys, list.Data[0].Attributes.SigningKeys} {
+		if len(keys) != 2 || keys[0].KeyID != "k1" || keys[0].Secret != "" || keys[1].PrivateKey != "" || keys[1].PublicKey == "" {
+			t.Errorf("expected redacted keys, got %+v", keys)
+		}
+	}
+
+	bad := jsonapi.DataEnvelope[models.Subscription]{Data: models.Subscription{Attributes: models.SubscriptionAttributes{
+		CallbackURI: "http://example.com/webhook",
+		SigningKeys: []models.SigningKey{{KeyID: "k1", Algorithm: models.SigningEd25519, PrivateKey: "not-a-key"}},
+	}}}
+	if code := doJSON(t, http.MethodPost, srv.URL+"/v1/notification/subscriptions", bad, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid key: expected 400, got %d", code)
+	}
+}
+
+func TestNotificationEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	engine := lifecycle.NewEngine(context.Background(), 1000, 4, vc, func(resourceType string, path []string, event, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if event == models.EventUpdated && status == "" {
+			t.Errorf("%s %v: updated without a status", resourceType, path)
+		}
+		events = append(events, resourceType+":"+strings.Join(path, "/")+":"+event)
+	})
+	srv := setupServerWithEngine(engine)
+	defer srv.Close()
+
+	base := srv.URL + "/v1/transaction/payments/p1"
+	payment := models.Payment{Resource: models.Resource{ID: "p1"}, Attributes: models.PaymentAttributes{Amount: "1.00", Currency: "GBP"}}
+	doJSON(t, http.MethodPost, srv.URL+"/v1/transaction/payments", jsonapi.DataEnvelope[models.Payment]{Data: payment}, nil)
+	doJSON(t, http.MethodPost, base+"/submissions", jsonapi.DataEnvelope[models.PaymentSubmission]{Data: models.PaymentSubmission{Resource: models.Resource{ID: "s1"}}}, nil)
+	doJSON(t, http.MethodPost, base+"/returns", jsonapi.DataEnvelope[models.ReturnPayment]{Data: models.ReturnPayment{Resource: models.Resource{ID: "r1"}}}, nil)
+	doJSON(t, http.MethodPost, base+"/recalls", jsonapi.DataEnvelope[models.Recall]{Data: models.Recall{Resource: models.Resource{ID: "rec1"}}}, nil)
+	decision := models.RecallDecision{Resource: models.Resource{ID: "dec1"}, Attributes: models.RecallDecisionAttributes{Answer: models.RecallAnswerRejected}}
+	doJSON(t, http.MethodPost, base+"/recalls/rec1/decisions", jsonapi.DataEnvelope[models.RecallDecision]{Data: decision}, nil)
+	if err := engine.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{
+		"payments:p1:created",
+		"payment_submissions:p1/s1:created",
+		"return_payments:p1/r1:created",
+		"recalls:p1/rec1:created",
+		"recall_decisions:p1/rec1/dec1:created",
+		"payment_submissions:p1/s1:updated",
+		"payments:p1:updated",
+	} {
+		if !slices.Contains(events, want) {
+			t.Errorf("expected %s, got %v", want, events)
+		}
+	}
+	if events[0] != "payments:p1:created" || events[1] != "payment_submissions:p1/s1:created" {
+		t.Errorf("expected created notifications first, got %v", events)
+	}
+}
+
+func TestSubscriptionDeliveries(t *testing.T) {
+	engine := lifecycle.NewEngine(context.Background(), 10, 1, clock.Real{}, nil)
+	s := store.NewMemoryStore()
+	mux := http.NewServeMux()
+	handlers.RegisterRoutes(mux, s, engine)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s.CreateSubscription(models.Subscription{Resource: models.Resource{ID: "sub-1"}})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, a := range []struct{ id, outcome string }{
+		{"a1", models.DeliveryFailed},
+		{"a2", models.DeliveryFailed},
+		{"a3", models.DeliverySucceeded},
+	} {
+		s.RecordDeliveryAttempt(models.DeliveryAttempt{
+			Resource: models.Resource{Type: models.ResourceTypeDeliveryAttempt, ID: a.id},
+			Attributes: models.DeliveryAttemptAttributes{
+				NotificationID: "n1",
+				SubscriptionID: "sub-1",
+				Attempt:        i + 1,
+				Outcome:        a.outcome,
+				AttemptedOn:    start.Add(time.Duration(i) * time.Minute),
+			},
+		})
+	}
+
+	base := srv.URL + "/v1/notification/subscriptions/sub-1/deliveries"
+	ids := func(query string) []string {
+		t.Helper()
+		var list jsonapi.ListEnvelope[models.DeliveryAttempt]
+		if code := doJSON(t, http.MethodGet, base+query, nil, &list); code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", query, code)
+		}
+		var out []string
+		for _, a := range list.Data {
+			out = append(out, a.ID)
+		}
+		return out
+	}
+	for query, want := range map[string][]string{
+		"":                            {"a1", "a2", "a3"},
+		"?outcome=failed":             {"a1", "a2"},
+		"?outcome=succeeded":          {"a3"},
+		"?since=2026-01-01T12:01:00Z": {"a2", "a3"},
+		"?until=2026-01-01T12:01:00Z": {"a1"},
+		"?outcome=failed&since=2026-01-01T12:01:00Z": {"a2"},
+	} {
+		if got := ids(query); !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	if code := doJSON(t, http.MethodGet, base+"?outcome=lost", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("bad outcome: expected 400, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, base+"?since=yesterday", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("bad since: expected 400, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, srv.URL+"/v1/notification/subscriptions/nope/deliveries", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown subscription: expected 404, got %d", code)
+	}
+}
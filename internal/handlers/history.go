@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// writeHistory writes a status history as a JSON:API list.
+func writeHistory(w http.ResponseWriter, history []models.StatusTransition) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.StatusTransition]{Data: history})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+)
+
+// HoldAtHeader asks for a new resource's lifecycle to be held once it
+// reaches the named status, until it is resumed or released through the
+// admin API.
+const HoldAtHeader = "X-Hold-At"
+
+// holdAtHeader returns the status requested in HoldAtHeader, if any. It
+// writes a 400 and reports false if the resource type has no such status.
+func holdAtHeader(w http.ResponseWriter, r *http.Request, e *lifecycle.Engine, resourceType string) (string, bool) {
+	holdAt := r.Header.Get(HoldAtHeader)
+	if holdAt != "" && !e.HasStatus(resourceType, holdAt) {
+		jsonapi.BadRequest(w, HoldAtHeader+": "+resourceType+" has no status "+holdAt)
+		return "", false
+	}
+	return holdAt, true
+}
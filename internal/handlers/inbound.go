@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/ledger"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// ErrInvalidCredit is returned for an inbound credit that is missing
+// required details or has an invalid amount.
+var ErrInvalidCredit = errors.New("invalid inbound credit")
+
+// InboundCredit describes a payment received from the scheme.
+type InboundCredit struct {
+	// PaymentID is the ID of the payment to create; one is generated if empty.
+	PaymentID         string               `json:"payment_id,omitempty"`
+	OrganisationID    string               `json:"organisation_id,omitempty"`
+	Amount            string               `json:"amount"`
+	Currency          string               `json:"currency,omitempty"`
+	Reference         string               `json:"reference,omitempty"`
+	EndToEndReference string               `json:"end_to_end_reference,omitempty"`
+	DebtorParty       *models.AccountParty `json:"debtor_party,omitempty"`
+	BeneficiaryParty  *models.AccountParty `json:"beneficiary_party"`
+}
+
+// InboundPayment is the result of receiving an inbound credit.
+type InboundPayment struct {
+	Payment   models.Payment          `json:"payment"`
+	Admission models.PaymentAdmission `json:"admission"`
+}
+
+// Simulator makes the mock receive payments as if they came from the scheme.
+type Simulator struct {
+	store      store.Store
+	engine     *lifecycle.Engine
+	admissions *PaymentAdmissionHandler
+}
+
+func newSimulator(s store.Store, e *lifecycle.Engine, admissions *PaymentAdmissionHandler) *Simulator {
+	return &Simulator{store: s, engine: e, admissions: admissions}
+}
+
+// Receive creates the payment for an inbound credit and an admission of it,
+// and starts the admission's lifecycle. Both are announced as created; the
+// admission's progress and the payment's status follow as updates.
+func (sim *Simulator) Receive(c InboundCredit) (InboundPayment, error) {
+	if c.Amount == "" {
+		return InboundPayment{}, fmt.Errorf("%w: amount is required", ErrInvalidCredit)
+	}
+	if n, err := ledger.ParseAmount(c.Amount); err != nil || n <= 0 {
+		return InboundPayment{}, fmt.Errorf("%w: amount must be a positive decimal with at most two places", ErrInvalidCredit)
+	}
+	if c.BeneficiaryParty == nil || c.BeneficiaryParty.SortCode == "" || c.BeneficiaryParty.AccountNumber == "" {
+		return InboundPayment{}, fmt.Errorf("%w: beneficiary sort code and account number are required", ErrInvalidCredit)
+	}
+	if c.Currency == "" {
+		c.Currency = "GBP"
+	}
+	if c.PaymentID == "" {
+		c.PaymentID = uuid.New().String()
+	}
+
+	now := sim.engine.Clock().Now().UTC()
+	p := models.Payment{
+		Resource: models.Resource{
+			Type:           models.ResourceTypePayment,
+			ID:             c.PaymentID,
+			OrganisationID: c.OrganisationID,
+			CreatedOn:      now,
+			ModifiedOn:     now,
+		},
+		Attributes: models.PaymentAttributes{
+			Amount:            c.Amount,
+			Currency:          c.Currency,
+			EndToEndReference: c.EndToEndReference,
+			PaymentScheme:     "FPS",
+			ProcessingDate:    now.Format(time.DateOnly),
+			Reference:         c.Reference,
+			BeneficiaryParty:  c.BeneficiaryParty,
+			DebtorParty:       c.DebtorParty,
+			Status:            models.PaymentStatusPending,
+		},
+	}
+	if err := sim.store.CreatePayment(p); err != nil {
+		return InboundPayment{}, err
+	}
+	sim.engine.Notify(lifecycle.NewKey(models.ResourceTypePayment, p.ID), models.EventCreated)
+
+	a := models.PaymentAdmission{Resource: models.Resource{OrganisationID: c.OrganisationID}}
+	a, err := sim.admissions.admit(p, a, "")
+	if err != nil {
+		return InboundPayment{}, err
+	}
+	return InboundPayment{Payment: p, Admission: a}, nil
+}
+
+// InboundCredit receives an inbound credit posted to the admin API.
+func (sim *Simulator) InboundCredit(w http.ResponseWriter, r *http.Request) {
+	var req jsonapi.DataEnvelope[InboundCredit]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+
+	in, err := sim.Receive(req.Data)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredit):
+			jsonapi.BadRequest(w, err.Error())
+		case errors.Is(err, store.ErrConflict):
+			jsonapi.Conflict(w, "payment already exists")
+		default:
+			jsonapi.InternalError(w)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[InboundPayment]{Data: in})
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/ledger"
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// ReasonInsufficientFunds is the scheme reason code for a payment its debtor
+// cannot cover.
+const ReasonInsufficientFunds = "AM04"
+
+// ledgerPostings posts to the ledger as payments, admissions, returns and
+// reversals progress:
+//
+//   - a payment submission released to the gateway debits the debtor;
+//   - a payment submission that fails delivery afterwards credits it back;
+//   - a confirmed admission credits the beneficiary;
+//   - a completed return credits the debtor of an outbound payment, or
+//     debits the beneficiary of an inbound one;
+//   - a completed reversal credits the debtor with what is still debited.
+//
+// The other side of each entry is the settlement account. Funds reserved
+// for a payment submission are released once it is released to the gateway
+// or fails, or if the engine drops its lifecycle.
+type ledgerPostings struct {
+	store  store.Store
+	engine *lifecycle.Engine
+}
+
+// newLedgerPostings creates a ledgerPostings that follows the engine's
+// transitions.
+func newLedgerPostings(s store.Store, e *lifecycle.Engine) *ledgerPostings {
+	lp := &ledgerPostings{store: s, engine: e}
+	e.OnTransition(lp.moved)
+	e.OnDrop(lp.dropped)
+	return lp
+}
+
+// dropped releases the funds reserved for a payment submission whose
+// lifecycle will not reach a status that releases them.
+func (lp *ledgerPostings) dropped(key lifecycle.Key) {
+	if key.Type == models.ResourceTypePaymentSubmission {
+		lp.store.Ledger().Release(key.Type + "/" + key.ID())
+	}
+}
+
+func (lp *ledgerPostings) moved(resourceType string, path []string, t models.StatusTransition) {
+	if len(path) < 2 {
+		return
+	}
+	paymentID, id := path[0], path[1]
+	switch resourceType {
+	case models.ResourceTypePaymentSubmission:
+		ref := resourceType + "/" + id
+		switch t.To {
+		case models.StatusReleasedToGateway:
+			lp.post(paymentID, ref, ledger.KindPayment, t, func(p models.Payment) (string, int64, bool) {
+				return debtorAccount(p), 0, true
+			})
+			lp.store.Ledger().Release(ref)
+		case models.StatusDeliveryFailed:
+			lp.refund(paymentID, ref, "", t)
+			lp.store.Ledger().Release(ref)
+		case models.StatusFailed:
+			lp.store.Ledger().Release(ref)
+		}
+	case models.ResourceTypePaymentAdmission:
+		if t.To != models.StatusConfirmed {
+			return
+		}
+		lp.post(paymentID, resourceType+"/"+id, ledger.KindAdmission, t, func(p models.Payment) (string, int64, bool) {
+			return beneficiaryAccount(p), 0, false
+		})
+	case models.ResourceTypeReturnPayment:
+		if t.To != models.StatusCompleted {
+			return
+		}
+		ret, err := lp.store.GetReturn(paymentID, id)
+		if err != nil {
+			return
+		}
+		lp.post(paymentID, resourceType+"/"+id, ledger.KindReturn, t, func(p models.Payment) (string, int64, bool) {
+			amount, _ := ledger.ParseAmount(ret.Attributes.Amount)
+			if len(lp.store.ListPaymentAdmissions(paymentID)) > 0 {
+				return beneficiaryAccount(p), amount, true
+			}
+			return debtorAccount(p), amount, false
+		})
+	case models.ResourceTypeReversal:
+		if t.To != models.StatusCompleted {
+			return
+		}
+		rev, err := lp.store.GetReversal(paymentID, id)
+		if err != nil {
+			return
+		}
+		lp.refund(paymentID, resourceType+"/"+id, rev.Attributes.Amount, t)
+	}
+}
+
+// post enters a payment against the settlement account. account works out
+// which account the entry is for, the amount if it is not the payment's, and
+// whether the account is debited rather than credited.
+func (lp *ledgerPostings) post(paymentID, ref, kind string, t models.StatusTransition, account func(models.Payment) (string, int64, bool)) {
+	p, err := lp.store.GetPayment(paymentID)
+	if err != nil {
+		return
+	}
+	id, amount, debit := account(p)
+	if id == "" {
+		return
+	}
+	if amount <= 0 {
+		if amount, err = ledger.ParseAmount(p.Attributes.Amount); err != nil {
+			log.Printf("ledger: payment %s: %v", paymentID, err)
+			return
+		}
+	}
+	e := ledger.Entry{
+		Debit:     ledger.SettlementAccount,
+		Credit:    id,
+		Amount:    amount,
+		Currency:  p.Attributes.Currency,
+		Kind:      kind,
+		PaymentID: paymentID,
+		Reference: ref,
+		At:        t.At,
+	}
+	if debit {
+		e.Debit, e.Credit = id, ledger.SettlementAccount
+	}
+	if err := lp.store.Ledger().Post(e); err != nil {
+		log.Printf("ledger: failed to post %s: %v", ref, err)
+	}
+}
+
+// refund credits the debtor of an outbound payment with what is still
+// debited for it, or with limit if that is less.
+func (lp *ledgerPostings) refund(paymentID, ref, limit string, t models.StatusTransition) {
+	lp.post(paymentID, ref, ledger.KindReversal, t, func(p models.Payment) (string, int64, bool) {
+		account := debtorAccount(p)
+		outstanding := lp.store.Ledger().Outstanding(account, paymentID)
+		if outstanding <= 0 {
+			return "", 0, false
+		}
+		if n, err := ledger.ParseAmount(limit); err == nil && n > 0 && n < outstanding {
+			outstanding = n
+		}
+		return account, outstanding, false
+	})
+}
+
+// reserveFunds sets aside the amount of payment p on its debtor's account
+// for submission id. Only debtors in the account registry have their balance
+// checked; a submission from one who cannot cover it fails at the limit
+// check.
+func reserveFunds(s store.Store, p models.Payment, id string) (lifecycle.Outcome, bool) {
+	d := p.Attributes.DebtorParty
+	if d == nil {
+		return lifecycle.Outcome{}, false
+	}
+	if _, err := s.GetAccount(d.SortCode, d.AccountNumber); err != nil {
+		return lifecycle.Outcome{}, false
+	}
+	amount, err := ledger.ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return lifecycle.Outcome{}, false
+	}
+	ref := models.ResourceTypePaymentSubmission + "/" + id
+	if err := s.Ledger().Reserve(ref, debtorAccount(p), amount); err != nil {
+		return lifecycle.Outcome{Status: models.StatusFailed, At: models.StatusLimitCheckPending, SchemeStatusCode: ReasonInsufficientFunds}, true
+	}
+	return lifecycle.Outcome{}, false
+}
+
+func debtorAccount(p models.Payment) string {
+	return partyAccount(p.Attributes.DebtorParty)
+}
+
+func beneficiaryAccount(p models.Payment) string {
+	return partyAccount(p.Attributes.BeneficiaryParty)
+}
+
+func partyAccount(a *models.AccountParty) string {
+	if a == nil || a.SortCode == "" || a.AccountNumber == "" {
+		return ""
+	}
+	return ledger.AccountID(a.SortCode, a.AccountNumber)
+}
+
+// Adjustment funds or charges an account through the admin API. A positive
+// amount credits the account.
+type Adjustment struct {
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency,omitempty"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// LedgerHandler exposes the ledger through the admin API.
+type LedgerHandler struct {
+	store  store.Store
+	engine *lifecycle.Engine
+}
+
+func NewLedgerHandler(s store.Store, e *lifecycle.Engine) *LedgerHandler {
+	return &LedgerHandler{store: s, engine: e}
+}
+
+func (h *LedgerHandler) Balances(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[ledger.Balance]{Data: h.store.Ledger().Balances()})
+}
+
+// Postings lists postings, oldest first, optionally filtered to the account
+// in the account query parameter.
+func (h *LedgerHandler) Postings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[ledger.Posting]{Data: h.store.Ledger().Postings(r.URL.Query().Get("account"))})
+}
+
+// Adjust posts an adjustment to the account in the path and returns its new
+// balance.
+func (h *LedgerHandler) Adjust(w http.ResponseWriter, r *http.Request) {
+	var req jsonapi.DataEnvelope[Adjustment]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+	amount, err := ledger.ParseAmount(req.Data.Amount)
+	if err != nil || amount == 0 {
+		jsonapi.BadRequest(w, "amount must be a non-zero decimal with at most two places")
+		return
+	}
+	account := ledger.AccountID(r.PathValue("sortCode"), r.PathValue("accountNumber"))
+	e := ledger.Entry{
+		Debit:     ledger.AdjustmentsAccount,
+		Credit:    account,
+		Amount:    amount,
+		Currency:  req.Data.Currency,
+		Kind:      ledger.KindAdjustment,
+		Reference: req.Data.Reference,
+		At:        h.engine.Clock().Now().UTC(),
+	}
+	if amount < 0 {
+		e.Debit, e.Credit, e.Amount = account, ledger.AdjustmentsAccount, -amount
+	}
+	if err := h.store.Ledger().Post(e); err != nil {
+		jsonapi.InternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[ledger.Balance]{Data: h.store.Ledger().Balance(account)})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
+	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/payee"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// Pay.UK reason codes for Confirmation of Payee results other than a match.
+// An unknown account is reported as ReasonIncorrectAccount.
+const (
+	ReasonPayeeCloseMatch = "MBAM"
+	ReasonPayeeNoMatch    = "ANNM"
+)
+
+// PayeeConfirmationHandler answers Confirmation of Payee requests. A name is
+// checked against the account registry, or for accounts that are not
+// registered, the beneficiary names of stored payments to the account.
+type PayeeConfirmationHandler struct {
+	store   store.Store
+	clock   clock.Clock
+	matcher payee.Matcher
+}
+
+func NewPayeeConfirmationHandler(s store.Store, c clock.Clock, m payee.Matcher) *PayeeConfirmationHandler {
+	return &PayeeConfirmationHandler{store: s, clock: c, matcher: m}
+}
+
+func (h *PayeeConfirmationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req jsonapi.DataEnvelope[models.PayeeConfirmation]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+
+	c := req.Data
+	problems := make(map[string]string)
+	for attr, v := range map[string]string{
+		"sort_code":      c.Attributes.SortCode,
+		"account_number": c.Attributes.AccountNumber,
+		"account_name":   c.Attributes.AccountName,
+	} {
+		if v == "" {
+			problems["/data/attributes/"+attr] = attr + " is required"
+		}
+	}
+	if len(problems) > 0 {
+		jsonapi.InvalidAttributes(w, problems)
+		return
+	}
+
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	c.Type = models.ResourceTypePayeeConfirmation
+	now := h.clock.Now().UTC()
+	c.CreatedOn = now
+	c.ModifiedOn = now
+
+	a := &c.Attributes
+	names, found := h.accountNames(a.SortCode, a.AccountNumber)
+	a.Result, a.ReasonCode, a.SuggestedName = "", "", ""
+	if !found {
+		a.Result, a.ReasonCode = models.PayeeAccountNotFound, ReasonIncorrectAccount
+	} else {
+		result, name := h.matcher.Compare(a.AccountName, names)
+		a.Result = result
+		switch result {
+		case models.PayeeCloseMatch:
+			a.ReasonCode, a.SuggestedName = ReasonPayeeCloseMatch, name
+		case models.PayeeNoMatch:
+			a.ReasonCode = ReasonPayeeNoMatch
+		}
+	}
+
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.PayeeConfirmation]{Data: c})
+}
+
+// accountNames returns the names an account is known by and whether the
+// account is known at all. A closed account in the registry is not known.
+func (h *PayeeConfirmationHandler) accountNames(sortCode, accountNumber string) ([]string, bool) {
+	if a, err := h.store.GetAccount(sortCode, accountNumber); err == nil {
+		if a.State == models.AccountStateClosed {
+			return nil, false
+		}
+		if a.AccountName == "" {
+			return nil, true
+		}
+		return []string{a.AccountName}, true
+	}
+	var names []string
+	found := false
+	seen := make(map[string]bool)
+	for _, p := range h.store.ListPayments() {
+		b := p.Attributes.BeneficiaryParty
+		if b == nil || b.SortCode != sortCode || b.AccountNumber != accountNumber {
+			continue
+		}
+		found = true
+		if b.AccountName != "" && !seen[b.AccountName] {
+			seen[b.AccountName] = true
+			names = append(names, b.AccountName)
+		}
+	}
+	return names, found
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -16,16 +19,29 @@ import (
 type PaymentAdmissionHandler struct {
 	store  store.Store
 	engine *lifecycle.Engine
+	clock  clock.Clock
+	mu     sync.Mutex // serialises settling an admission's tasks
+	// strictAccounts rejects admissions to accounts not in the registry.
+	strictAccounts bool
 }
 
 func NewPaymentAdmissionHandler(s store.Store, e *lifecycle.Engine) *PaymentAdmissionHandler {
-	return &PaymentAdmissionHandler{store: s, engine: e}
+	h := &PaymentAdmissionHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypePaymentAdmission, h.updateStatus)
+	e.OnTransition(func(resourceType string, path []string, t models.StatusTransition) {
+		// Tasks may all have been done before the admission got here.
+		if resourceType == models.ResourceTypePaymentAdmission && t.To == models.StatusPendingTasks {
+			h.settleTasks(path[0], path[1])
+		}
+	})
+	return h
 }
 
 func (h *PaymentAdmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	paymentID := r.PathValue("paymentID")
 
-	if _, err := h.store.GetPayment(paymentID); err != nil {
+	payment, err := h.store.GetPayment(paymentID)
+	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			jsonapi.NotFound(w, "payment", paymentID)
 			return
@@ -40,18 +56,13 @@ func (h *PaymentAdmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	a := req.Data
-	if a.ID == "" {
-		a.ID = uuid.New().String()
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypePaymentAdmission)
+	if !ok {
+		return
 	}
-	a.Type = models.ResourceTypePaymentAdmission
-	now := time.Now().UTC()
-	a.CreatedOn = now
-	a.ModifiedOn = now
-	a.Attributes.Status = lifecycle.AdmissionChain[0]
-	a.Attributes.AdmissionDate = now.Format(time.DateOnly)
 
-	if err := h.store.CreatePaymentAdmission(paymentID, a); err != nil {
+	a, err := h.admit(payment, req.Data, holdAt)
+	if err != nil {
 		if errors.Is(err, store.ErrConflict) {
 			jsonapi.Conflict(w, "admission already exists")
 			return
@@ -60,18 +71,6 @@ func (h *PaymentAdmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Start async lifecycle
-	admissionID := a.ID
-	h.engine.StartTransition(models.ResourceTypePaymentAdmission, admissionID, lifecycle.AdmissionChain, func(newStatus string) error {
-		adm, err := h.store.GetPaymentAdmission(paymentID, admissionID)
-		if err != nil {
-			return err
-		}
-		adm.Attributes.Status = newStatus
-		adm.ModifiedOn = time.Now().UTC()
-		return h.store.UpdatePaymentAdmission(paymentID, adm)
-	})
-
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.PaymentAdmission]{Data: a})
@@ -100,6 +99,15 @@ func (h *PaymentAdmissionHandler) PatchTask(w http.ResponseWriter, r *http.Reque
 	admissionID := r.PathValue("admissionID")
 	taskID := r.PathValue("taskID")
 
+	if _, err := h.store.GetPaymentAdmission(paymentID, admissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "payment_admission", admissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
 	// Get existing task or create if first access
 	t, err := h.store.GetAdmissionTask(paymentID, admissionID, taskID)
 	if err != nil {
@@ -107,11 +115,12 @@ func (h *PaymentAdmissionHandler) PatchTask(w http.ResponseWriter, r *http.Reque
 			// Auto-create the task
 			t = models.AdmissionTask{
 				Resource: models.Resource{
-					Type:      "admission_tasks",
-					ID:        taskID,
-					CreatedOn: time.Now().UTC(),
-					ModifiedOn: time.Now().UTC(),
+					Type:       models.ResourceTypeAdmissionTask,
+					ID:         taskID,
+					CreatedOn:  h.clock.Now().UTC(),
+					ModifiedOn: h.clock.Now().UTC(),
 				},
+				Attributes: models.AdmissionTaskAttributes{Status: models.StatusPending},
 			}
 			if createErr := h.store.CreateAdmissionTask(paymentID, admissionID, t); createErr != nil {
 				if !errors.Is(createErr, store.ErrConflict) {
@@ -124,6 +133,8 @@ func (h *PaymentAdmissionHandler) PatchTask(w http.ResponseWriter, r *http.Reque
 					jsonapi.InternalError(w)
 					return
 				}
+			} else {
+				h.engine.Notify(lifecycle.NewKey(models.ResourceTypeAdmissionTask, paymentID, admissionID, taskID), models.EventCreated)
 			}
 		} else {
 			jsonapi.InternalError(w)
@@ -138,6 +149,19 @@ func (h *PaymentAdmissionHandler) PatchTask(w http.ResponseWriter, r *http.Reque
 	}
 
 	patch := req.Data
+	switch patch.Attributes.Status {
+	case "", models.StatusPending, models.StatusCompleted:
+	default:
+		jsonapi.BadRequest(w, "status must be pending or completed")
+		return
+	}
+	switch patch.Attributes.Outcome {
+	case "", models.TaskOutcomePassed, models.TaskOutcomeFailed:
+	default:
+		jsonapi.BadRequest(w, "outcome must be passed or failed")
+		return
+	}
+	previous := t.Attributes.Status
 	if patch.Attributes.Status != "" {
 		t.Attributes.Status = patch.Attributes.Status
 	}
@@ -147,13 +171,147 @@ func (h *PaymentAdmissionHandler) PatchTask(w http.ResponseWriter, r *http.Reque
 	if patch.Attributes.Name != "" {
 		t.Attributes.Name = patch.Attributes.Name
 	}
-	t.ModifiedOn = time.Now().UTC()
+	if patch.Attributes.Outcome != "" {
+		t.Attributes.Outcome = patch.Attributes.Outcome
+	}
+	t.ModifiedOn = h.clock.Now().UTC()
 
 	if err := h.store.UpdateAdmissionTask(paymentID, admissionID, t); err != nil {
 		jsonapi.InternalError(w)
 		return
 	}
+	if t.Attributes.Status != previous {
+		h.engine.NotifyStatus(lifecycle.NewKey(models.ResourceTypeAdmissionTask, paymentID, admissionID, taskID), t.Attributes.Status)
+	} else {
+		h.engine.Notify(lifecycle.NewKey(models.ResourceTypeAdmissionTask, paymentID, admissionID, taskID), models.EventUpdated)
+	}
+	h.settleTasks(paymentID, admissionID)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.AdmissionTask]{Data: t})
 }
+
+// admit stores a new admission of payment, along with any tasks it must
+// wait for, and starts its lifecycle.
+func (h *PaymentAdmissionHandler) admit(payment models.Payment, a models.PaymentAdmission, holdAt string) (models.PaymentAdmission, error) {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	a.Type = models.ResourceTypePaymentAdmission
+	now := h.clock.Now().UTC()
+	a.CreatedOn = now
+	a.ModifiedOn = now
+	a.Attributes.Status = h.engine.InitialStatus(models.ResourceTypePaymentAdmission)
+	a.Attributes.AdmissionDate = now.Format(time.DateOnly)
+
+	if err := h.store.CreatePaymentAdmission(payment.ID, a); err != nil {
+		return a, err
+	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypePaymentAdmission, payment.ID, a.ID), models.EventCreated)
+
+	// Payments to accounts that cannot take them are rejected; admissions
+	// with tasks stop at pending_tasks rather than being confirmed.
+	outcome, rejected := inboundOutcome(h.store, payment, h.strictAccounts)
+	if tasks := h.engine.AdmissionTasks(payment); !rejected && len(tasks) > 0 && h.engine.HasStatus(models.ResourceTypePaymentAdmission, models.StatusPendingTasks) {
+		for _, name := range tasks {
+			t := models.AdmissionTask{
+				Resource: models.Resource{
+					Type:           models.ResourceTypeAdmissionTask,
+					ID:             uuid.New().String(),
+					OrganisationID: a.OrganisationID,
+					CreatedOn:      now,
+					ModifiedOn:     now,
+				},
+				Attributes: models.AdmissionTaskAttributes{Status: models.StatusPending, Name: name},
+			}
+			if err := h.store.CreateAdmissionTask(payment.ID, a.ID, t); err != nil {
+				return a, err
+			}
+			h.engine.Notify(lifecycle.NewKey(models.ResourceTypeAdmissionTask, payment.ID, a.ID, t.ID), models.EventCreated)
+		}
+		outcome = lifecycle.Outcome{Status: models.StatusPendingTasks}
+	}
+
+	// Start async lifecycle
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypePaymentAdmission, payment.ID, a.ID), outcome, holdAt)
+	return a, nil
+}
+
+// ListTasks lists the tasks of a payment admission.
+func (h *PaymentAdmissionHandler) ListTasks(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	admissionID := r.PathValue("admissionID")
+
+	if _, err := h.store.GetPaymentAdmission(paymentID, admissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "payment_admission", admissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	tasks := h.store.ListAdmissionTasks(paymentID, admissionID)
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.AdmissionTask]{Data: tasks})
+}
+
+// settleTasks ends an admission waiting in pending_tasks once all of its
+// tasks are completed: failed if any task failed, confirmed otherwise.
+func (h *PaymentAdmissionHandler) settleTasks(paymentID, admissionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	adm, err := h.store.GetPaymentAdmission(paymentID, admissionID)
+	if err != nil || adm.Attributes.Status != models.StatusPendingTasks {
+		return
+	}
+	tasks := h.store.ListAdmissionTasks(paymentID, admissionID)
+	if len(tasks) == 0 {
+		return
+	}
+	status := models.StatusConfirmed
+	for _, t := range tasks {
+		if t.Attributes.Status != models.StatusCompleted {
+			return
+		}
+		if t.Attributes.Outcome == models.TaskOutcomeFailed {
+			status = models.StatusFailed
+		}
+	}
+	key := lifecycle.NewKey(models.ResourceTypePaymentAdmission, paymentID, admissionID)
+	if err := h.engine.Apply(key, models.StatusPendingTasks, status, lifecycle.OutcomeDelivered); err != nil {
+		log.Printf("admissions: failed to settle %s: %v", admissionID, err)
+	}
+}
+
+// History lists the status transitions of a payment admission, oldest first.
+func (h *PaymentAdmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	admissionID := r.PathValue("admissionID")
+
+	if _, err := h.store.GetPaymentAdmission(paymentID, admissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "payment_admission", admissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypePaymentAdmission, []string{paymentID, admissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a payment admission.
+func (h *PaymentAdmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, admissionID := key.Path[0], key.Path[1]
+	adm, err := h.store.GetPaymentAdmission(paymentID, admissionID)
+	if err != nil {
+		return err
+	}
+	adm.Attributes.Status = newStatus
+	if newStatus == outcome.Status && outcome.IsFailure() {
+		adm.Attributes.SchemeStatusCode = outcome.SchemeStatusCode
+	}
+	adm.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdatePaymentAdmission(paymentID, adm)
+}
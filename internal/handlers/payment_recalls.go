@@ -4,20 +4,25 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 type PaymentRecallHandler struct {
-	store store.Store
+	store  store.Store
+	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
-func NewPaymentRecallHandler(s store.Store) *PaymentRecallHandler {
-	return &PaymentRecallHandler{store: s}
+func NewPaymentRecallHandler(s store.Store, e *lifecycle.Engine) *PaymentRecallHandler {
+	h := &PaymentRecallHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypeRecall, h.updateStatus)
+	return h
 }
 
 func (h *PaymentRecallHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +48,10 @@ func (h *PaymentRecallHandler) Create(w http.ResponseWriter, r *http.Request) {
 		rec.ID = uuid.New().String()
 	}
 	rec.Type = models.ResourceTypeRecall
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	rec.CreatedOn = now
 	rec.ModifiedOn = now
+	rec.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeRecall)
 
 	if err := h.store.CreateRecall(paymentID, rec); err != nil {
 		if errors.Is(err, store.ErrConflict) {
@@ -55,6 +61,7 @@ func (h *PaymentRecallHandler) Create(w http.ResponseWriter, r *http.Request) {
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeRecall, paymentID, rec.ID), models.EventCreated)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -85,3 +92,35 @@ func (h *PaymentRecallHandler) List(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.Recall]{Data: recalls})
 }
+
+// History lists the status transitions of a recall, oldest first.
+func (h *PaymentRecallHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	recallID := r.PathValue("recallID")
+
+	if _, err := h.store.GetRecall(paymentID, recallID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "recall", recallID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeRecall, []string{paymentID, recallID}))
+}
+
+// updateStatus persists a lifecycle transition of a recall.
+func (h *PaymentRecallHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, recallID := key.Path[0], key.Path[1]
+	rec, err := h.store.GetRecall(paymentID, recallID)
+	if err != nil {
+		return err
+	}
+	rec.Attributes.Status = newStatus
+	if newStatus == outcome.Status && outcome.Reason != "" {
+		rec.Attributes.DecisionReason = outcome.Reason
+	}
+	rec.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateRecall(paymentID, rec)
+}
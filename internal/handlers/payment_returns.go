@@ -4,20 +4,25 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 type PaymentReturnHandler struct {
-	store store.Store
+	store  store.Store
+	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
-func NewPaymentReturnHandler(s store.Store) *PaymentReturnHandler {
-	return &PaymentReturnHandler{store: s}
+func NewPaymentReturnHandler(s store.Store, e *lifecycle.Engine) *PaymentReturnHandler {
+	h := &PaymentReturnHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypeReturnPayment, h.updateStatus)
+	return h
 }
 
 func (h *PaymentReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +48,10 @@ func (h *PaymentReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
 		ret.ID = uuid.New().String()
 	}
 	ret.Type = models.ResourceTypeReturnPayment
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	ret.CreatedOn = now
 	ret.ModifiedOn = now
+	ret.Attributes.SchemeStatus = h.engine.InitialStatus(models.ResourceTypeReturnPayment)
 
 	if err := h.store.CreateReturn(paymentID, ret); err != nil {
 		if errors.Is(err, store.ErrConflict) {
@@ -55,6 +61,7 @@ func (h *PaymentReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeReturnPayment, paymentID, ret.ID), models.EventCreated)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -85,3 +92,32 @@ func (h *PaymentReturnHandler) List(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.ReturnPayment]{Data: returns})
 }
+
+// History lists the status transitions of a return, oldest first.
+func (h *PaymentReturnHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	returnID := r.PathValue("returnID")
+
+	if _, err := h.store.GetReturn(paymentID, returnID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "return_payment", returnID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeReturnPayment, []string{paymentID, returnID}))
+}
+
+// updateStatus persists a lifecycle transition of a return.
+func (h *PaymentReturnHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, returnID := key.Path[0], key.Path[1]
+	ret, err := h.store.GetReturn(paymentID, returnID)
+	if err != nil {
+		return err
+	}
+	ret.Attributes.SchemeStatus = newStatus
+	ret.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateReturn(paymentID, ret)
+}
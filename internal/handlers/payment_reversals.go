@@ -4,20 +4,25 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 type PaymentReversalHandler struct {
-	store store.Store
+	store  store.Store
+	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
-func NewPaymentReversalHandler(s store.Store) *PaymentReversalHandler {
-	return &PaymentReversalHandler{store: s}
+func NewPaymentReversalHandler(s store.Store, e *lifecycle.Engine) *PaymentReversalHandler {
+	h := &PaymentReversalHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypeReversal, h.updateStatus)
+	return h
 }
 
 func (h *PaymentReversalHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +48,10 @@ func (h *PaymentReversalHandler) Create(w http.ResponseWriter, r *http.Request)
 		rev.ID = uuid.New().String()
 	}
 	rev.Type = models.ResourceTypeReversal
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	rev.CreatedOn = now
 	rev.ModifiedOn = now
+	rev.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeReversal)
 
 	if err := h.store.CreateReversal(paymentID, rev); err != nil {
 		if errors.Is(err, store.ErrConflict) {
@@ -55,6 +61,7 @@ func (h *PaymentReversalHandler) Create(w http.ResponseWriter, r *http.Request)
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeReversal, paymentID, rev.ID), models.EventCreated)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -85,3 +92,32 @@ func (h *PaymentReversalHandler) List(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.Reversal]{Data: reversals})
 }
+
+// History lists the status transitions of a reversal, oldest first.
+func (h *PaymentReversalHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	reversalID := r.PathValue("reversalID")
+
+	if _, err := h.store.GetReversal(paymentID, reversalID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "reversal", reversalID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeReversal, []string{paymentID, reversalID}))
+}
+
+// updateStatus persists a lifecycle transition of a reversal.
+func (h *PaymentReversalHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, reversalID := key.Path[0], key.Path[1]
+	rev, err := h.store.GetReversal(paymentID, reversalID)
+	if err != nil {
+		return err
+	}
+	rev.Attributes.Status = newStatus
+	rev.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateReversal(paymentID, rev)
+}
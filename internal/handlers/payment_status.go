@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// paymentStatus keeps each payment's aggregate status in line with its
+// submissions, returns, recalls and reversals.
+type paymentStatus struct {
+	mu     sync.Mutex // serialises updates so versions are not lost
+	store  store.Store
+	engine *lifecycle.Engine
+}
+
+// newPaymentStatus creates a paymentStatus that refreshes a payment whenever
+// the engine moves one of its children on.
+func newPaymentStatus(s store.Store, e *lifecycle.Engine) *paymentStatus {
+	ps := &paymentStatus{store: s, engine: e}
+	e.OnTransition(func(resourceType string, path []string, _ models.StatusTransition) {
+		// Every lifecycle resource is keyed by its payment first.
+		if len(path) > 0 {
+			ps.refresh(path[0])
+		}
+	})
+	return ps
+}
+
+// refresh recomputes a payment's status. If it changed, the payment's
+// version is bumped and an updated notification sent with the new status.
+func (ps *paymentStatus) refresh(paymentID string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, err := ps.store.GetPayment(paymentID)
+	if err != nil {
+		return
+	}
+	status := derivePaymentStatus(ps.store, paymentID)
+	if status == p.Attributes.Status {
+		return
+	}
+	p.Attributes.Status = status
+	p.Version++
+	p.ModifiedOn = ps.engine.Clock().Now().UTC()
+	if err := ps.store.UpdatePayment(p); err != nil {
+		log.Printf("payment status: failed to update %s: %v", paymentID, err)
+		return
+	}
+	ps.engine.NotifyStatus(lifecycle.NewKey(models.ResourceTypePayment, paymentID), status)
+}
+
+// derivePaymentStatus works out a payment's status from its children. A
+// delivered reversal or return, or an accepted recall, outranks the
+// submissions; otherwise any delivered submission means the payment was
+// delivered, and a failed latest submission means it failed. Payments
+// without submissions are inbound, and follow their admissions instead.
+func derivePaymentStatus(s store.Store, paymentID string) string {
+	for _, r := range s.ListReversals(paymentID) {
+		for _, sub := range s.ListReversalSubmissions(paymentID, r.ID) {
+			if sub.Attributes.Status == models.StatusDeliveryConfirmed {
+				return models.PaymentStatusReversed
+			}
+		}
+	}
+	for _, r := range s.ListReturns(paymentID) {
+		for _, sub := range s.ListReturnSubmissions(paymentID, r.ID) {
+			if sub.Attributes.Status == models.StatusDeliveryConfirmed {
+				return models.PaymentStatusReturned
+			}
+		}
+	}
+	for _, r := range s.ListRecalls(paymentID) {
+		if r.Attributes.Status == models.StatusAccepted {
+			return models.PaymentStatusRecalled
+		}
+	}
+
+	subs := s.ListPaymentSubmissions(paymentID)
+	if len(subs) == 0 {
+		return admittedStatus(s.ListPaymentAdmissions(paymentID))
+	}
+	for _, sub := range subs {
+		if sub.Attributes.Status == models.StatusDeliveryConfirmed {
+			return models.PaymentStatusDelivered
+		}
+	}
+	latest := slices.MaxFunc(subs, func(a, b models.PaymentSubmission) int {
+		return a.CreatedOn.Compare(b.CreatedOn)
+	})
+	switch latest.Attributes.Status {
+	case models.StatusFailed, models.StatusDeliveryFailed:
+		return models.PaymentStatusFailed
+	}
+	return models.PaymentStatusSubmitted
+}
+
+// admittedStatus works out an inbound payment's status from its admissions:
+// a confirmed admission means it was received, and a failed latest admission
+// means it failed.
+func admittedStatus(admissions []models.PaymentAdmission) string {
+	if len(admissions) == 0 {
+		return models.PaymentStatusPending
+	}
+	for _, a := range admissions {
+		if a.Attributes.Status == models.StatusConfirmed {
+			return models.PaymentStatusReceived
+		}
+	}
+	latest := slices.MaxFunc(admissions, func(a, b models.PaymentAdmission) int {
+		return a.CreatedOn.Compare(b.CreatedOn)
+	})
+	if latest.Attributes.Status == models.StatusFailed {
+		return models.PaymentStatusFailed
+	}
+	return models.PaymentStatusPending
+}
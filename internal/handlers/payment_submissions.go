@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -14,19 +15,24 @@ import (
 )
 
 type PaymentSubmissionHandler struct {
-	store  store.Store
-	engine *lifecycle.Engine
+	store    store.Store
+	engine   *lifecycle.Engine
+	clock    clock.Clock
+	payments *paymentStatus
 }
 
-func NewPaymentSubmissionHandler(s store.Store, e *lifecycle.Engine) *PaymentSubmissionHandler {
-	return &PaymentSubmissionHandler{store: s, engine: e}
+func NewPaymentSubmissionHandler(s store.Store, e *lifecycle.Engine, ps *paymentStatus) *PaymentSubmissionHandler {
+	h := &PaymentSubmissionHandler{store: s, engine: e, clock: e.Clock(), payments: ps}
+	e.Handle(models.ResourceTypePaymentSubmission, h.updateStatus)
+	return h
 }
 
 func (h *PaymentSubmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	paymentID := r.PathValue("paymentID")
 
 	// Verify payment exists
-	if _, err := h.store.GetPayment(paymentID); err != nil {
+	payment, err := h.store.GetPayment(paymentID)
+	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			jsonapi.NotFound(w, "payment", paymentID)
 			return
@@ -41,15 +47,20 @@ func (h *PaymentSubmissionHandler) Create(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypePaymentSubmission)
+	if !ok {
+		return
+	}
+
 	s := req.Data
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypePaymentSubmission
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
-	s.Attributes.Status = lifecycle.PaymentSubmissionChain[0]
+	s.Attributes.Status = h.engine.InitialStatus(models.ResourceTypePaymentSubmission)
 	s.Attributes.SubmissionDate = now.Format(time.DateOnly)
 
 	if err := h.store.CreatePaymentSubmission(paymentID, s); err != nil {
@@ -60,18 +71,24 @@ func (h *PaymentSubmissionHandler) Create(w http.ResponseWriter, r *http.Request
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypePaymentSubmission, paymentID, s.ID), models.EventCreated)
 
 	// Start async lifecycle
-	submissionID := s.ID
-	h.engine.StartTransition(models.ResourceTypePaymentSubmission, submissionID, lifecycle.PaymentSubmissionChain, func(newStatus string) error {
-		sub, err := h.store.GetPaymentSubmission(paymentID, submissionID)
-		if err != nil {
-			return err
+	outcome := h.engine.SubmissionOutcome(payment)
+	if outcome == lifecycle.OutcomeDelivered {
+		if o, rejected := outboundOutcome(h.store, payment); rejected {
+			outcome = o
 		}
-		sub.Attributes.Status = newStatus
-		sub.ModifiedOn = time.Now().UTC()
-		return h.store.UpdatePaymentSubmission(paymentID, sub)
-	})
+	}
+	// Any outcome but an early failure debits the debtor once released to
+	// the gateway, so the funds are checked for all of them.
+	if outcome.Status != models.StatusFailed {
+		if o, short := reserveFunds(h.store, payment, s.ID); short {
+			outcome = o
+		}
+	}
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypePaymentSubmission, paymentID, s.ID), outcome, holdAt)
+	h.payments.refresh(paymentID)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -95,3 +112,35 @@ func (h *PaymentSubmissionHandler) Get(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.PaymentSubmission]{Data: s})
 }
+
+// History lists the status transitions of a payment submission, oldest first.
+func (h *PaymentSubmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	submissionID := r.PathValue("submissionID")
+
+	if _, err := h.store.GetPaymentSubmission(paymentID, submissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "payment_submission", submissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypePaymentSubmission, []string{paymentID, submissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a payment submission.
+func (h *PaymentSubmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, submissionID := key.Path[0], key.Path[1]
+	sub, err := h.store.GetPaymentSubmission(paymentID, submissionID)
+	if err != nil {
+		return err
+	}
+	sub.Attributes.Status = newStatus
+	if newStatus == outcome.Status && outcome.IsFailure() {
+		sub.Attributes.SchemeStatusCode = outcome.SchemeStatusCode
+	}
+	sub.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdatePaymentSubmission(paymentID, sub)
+}
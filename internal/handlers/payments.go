@@ -4,20 +4,24 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 type PaymentHandler struct {
-	store store.Store
+	store      store.Store
+	engine     *lifecycle.Engine
+	clock      clock.Clock
+	validation *AccountValidation // nil accepts any party details
 }
 
-func NewPaymentHandler(s store.Store) *PaymentHandler {
-	return &PaymentHandler{store: s}
+func NewPaymentHandler(s store.Store, e *lifecycle.Engine) *PaymentHandler {
+	return &PaymentHandler{store: s, engine: e, clock: e.Clock()}
 }
 
 func (h *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -31,10 +35,17 @@ func (h *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if p.ID == "" {
 		p.ID = uuid.New().String()
 	}
+	if h.validation != nil {
+		if problems := h.validation.problems(p); h.validation.reject(p, problems) {
+			jsonapi.InvalidAttributes(w, problems)
+			return
+		}
+	}
 	p.Type = models.ResourceTypePayment
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	p.CreatedOn = now
 	p.ModifiedOn = now
+	p.Attributes.Status = models.PaymentStatusPending
 
 	if err := h.store.CreatePayment(p); err != nil {
 		if errors.Is(err, store.ErrConflict) {
@@ -44,6 +55,7 @@ func (h *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypePayment, p.ID), models.EventCreated)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
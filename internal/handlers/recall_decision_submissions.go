@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -16,10 +17,13 @@ import (
 type RecallDecisionSubmissionHandler struct {
 	store  store.Store
 	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
 func NewRecallDecisionSubmissionHandler(s store.Store, e *lifecycle.Engine) *RecallDecisionSubmissionHandler {
-	return &RecallDecisionSubmissionHandler{store: s, engine: e}
+	h := &RecallDecisionSubmissionHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypeRecallDecisionSubmission, h.updateStatus)
+	return h
 }
 
 func (h *RecallDecisionSubmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -42,15 +46,20 @@ func (h *RecallDecisionSubmissionHandler) Create(w http.ResponseWriter, r *http.
 		return
 	}
 
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypeRecallDecisionSubmission)
+	if !ok {
+		return
+	}
+
 	s := req.Data
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypeRecallDecisionSubmission
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
-	s.Attributes.Status = lifecycle.SimpleSubmissionChain[0]
+	s.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeRecallDecisionSubmission)
 	s.Attributes.SubmissionDate = now.Format(time.DateOnly)
 
 	if err := h.store.CreateRecallDecisionSubmission(paymentID, recallID, decisionID, s); err != nil {
@@ -61,17 +70,9 @@ func (h *RecallDecisionSubmissionHandler) Create(w http.ResponseWriter, r *http.
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeRecallDecisionSubmission, paymentID, recallID, decisionID, s.ID), models.EventCreated)
 
-	submissionID := s.ID
-	h.engine.StartTransition(models.ResourceTypeRecallDecisionSubmission, submissionID, lifecycle.SimpleSubmissionChain, func(newStatus string) error {
-		sub, err := h.store.GetRecallDecisionSubmission(paymentID, recallID, decisionID, submissionID)
-		if err != nil {
-			return err
-		}
-		sub.Attributes.Status = newStatus
-		sub.ModifiedOn = time.Now().UTC()
-		return h.store.UpdateRecallDecisionSubmission(paymentID, recallID, decisionID, sub)
-	})
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypeRecallDecisionSubmission, paymentID, recallID, decisionID, s.ID), lifecycle.OutcomeDelivered, holdAt)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -97,3 +98,34 @@ func (h *RecallDecisionSubmissionHandler) Get(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.RecallDecisionSubmission]{Data: s})
 }
+
+// History lists the status transitions of a recall decision submission, oldest first.
+func (h *RecallDecisionSubmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	recallID := r.PathValue("recallID")
+	decisionID := r.PathValue("decisionID")
+	submissionID := r.PathValue("submissionID")
+
+	if _, err := h.store.GetRecallDecisionSubmission(paymentID, recallID, decisionID, submissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "recall_decision_submission", submissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeRecallDecisionSubmission, []string{paymentID, recallID, decisionID, submissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a recall decision submission.
+func (h *RecallDecisionSubmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, recallID, decisionID, submissionID := key.Path[0], key.Path[1], key.Path[2], key.Path[3]
+	sub, err := h.store.GetRecallDecisionSubmission(paymentID, recallID, decisionID, submissionID)
+	if err != nil {
+		return err
+	}
+	sub.Attributes.Status = newStatus
+	sub.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateRecallDecisionSubmission(paymentID, recallID, decisionID, sub)
+}
@@ -4,27 +4,31 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
+	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 type RecallDecisionHandler struct {
-	store store.Store
+	store  store.Store
+	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
-func NewRecallDecisionHandler(s store.Store) *RecallDecisionHandler {
-	return &RecallDecisionHandler{store: s}
+func NewRecallDecisionHandler(s store.Store, e *lifecycle.Engine) *RecallDecisionHandler {
+	return &RecallDecisionHandler{store: s, engine: e, clock: e.Clock()}
 }
 
 func (h *RecallDecisionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	paymentID := r.PathValue("paymentID")
 	recallID := r.PathValue("recallID")
 
-	if _, err := h.store.GetRecall(paymentID, recallID); err != nil {
+	rec, err := h.store.GetRecall(paymentID, recallID)
+	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			jsonapi.NotFound(w, "recall", recallID)
 			return
@@ -32,6 +36,14 @@ func (h *RecallDecisionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		jsonapi.InternalError(w)
 		return
 	}
+	// Decisions on a pending recall wait for it to await one; a recall that
+	// has been decided or has failed takes no more.
+	switch rec.Attributes.Status {
+	case models.StatusPending, models.StatusAwaitingDecision:
+	default:
+		jsonapi.Conflict(w, "recall is "+rec.Attributes.Status+" and cannot be decided")
+		return
+	}
 
 	var req jsonapi.DataEnvelope[models.RecallDecision]
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -40,11 +52,17 @@ func (h *RecallDecisionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	d := req.Data
+	switch d.Attributes.Answer {
+	case models.RecallAnswerAccepted, models.RecallAnswerRejected:
+	default:
+		jsonapi.BadRequest(w, "answer must be accepted or rejected")
+		return
+	}
 	if d.ID == "" {
 		d.ID = uuid.New().String()
 	}
 	d.Type = models.ResourceTypeRecallDecision
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	d.CreatedOn = now
 	d.ModifiedOn = now
 
@@ -56,6 +74,7 @@ func (h *RecallDecisionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeRecallDecision, paymentID, recallID, d.ID), models.EventCreated)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -16,10 +17,13 @@ import (
 type RecallSubmissionHandler struct {
 	store  store.Store
 	engine *lifecycle.Engine
+	clock  clock.Clock
 }
 
 func NewRecallSubmissionHandler(s store.Store, e *lifecycle.Engine) *RecallSubmissionHandler {
-	return &RecallSubmissionHandler{store: s, engine: e}
+	h := &RecallSubmissionHandler{store: s, engine: e, clock: e.Clock()}
+	e.Handle(models.ResourceTypeRecallSubmission, h.updateStatus)
+	return h
 }
 
 func (h *RecallSubmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -41,15 +45,20 @@ func (h *RecallSubmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypeRecallSubmission)
+	if !ok {
+		return
+	}
+
 	s := req.Data
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypeRecallSubmission
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
-	s.Attributes.Status = lifecycle.SimpleSubmissionChain[0]
+	s.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeRecallSubmission)
 	s.Attributes.SubmissionDate = now.Format(time.DateOnly)
 
 	if err := h.store.CreateRecallSubmission(paymentID, recallID, s); err != nil {
@@ -60,17 +69,9 @@ func (h *RecallSubmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeRecallSubmission, paymentID, recallID, s.ID), models.EventCreated)
 
-	submissionID := s.ID
-	h.engine.StartTransition(models.ResourceTypeRecallSubmission, submissionID, lifecycle.SimpleSubmissionChain, func(newStatus string) error {
-		sub, err := h.store.GetRecallSubmission(paymentID, recallID, submissionID)
-		if err != nil {
-			return err
-		}
-		sub.Attributes.Status = newStatus
-		sub.ModifiedOn = time.Now().UTC()
-		return h.store.UpdateRecallSubmission(paymentID, recallID, sub)
-	})
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypeRecallSubmission, paymentID, recallID, s.ID), lifecycle.OutcomeDelivered, holdAt)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -95,3 +96,33 @@ func (h *RecallSubmissionHandler) Get(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.RecallSubmission]{Data: s})
 }
+
+// History lists the status transitions of a recall submission, oldest first.
+func (h *RecallSubmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	recallID := r.PathValue("recallID")
+	submissionID := r.PathValue("submissionID")
+
+	if _, err := h.store.GetRecallSubmission(paymentID, recallID, submissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "recall_submission", submissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeRecallSubmission, []string{paymentID, recallID, submissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a recall submission.
+func (h *RecallSubmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, recallID, submissionID := key.Path[0], key.Path[1], key.Path[2]
+	sub, err := h.store.GetRecallSubmission(paymentID, recallID, submissionID)
+	if err != nil {
+		return err
+	}
+	sub.Attributes.Status = newStatus
+	sub.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateRecallSubmission(paymentID, recallID, sub)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -16,10 +17,14 @@ import (
 type ReturnSubmissionHandler struct {
 	store  store.Store
 	engine *lifecycle.Engine
+	clock  clock.Clock
+	parent *exceptionStatus
 }
 
-func NewReturnSubmissionHandler(s store.Store, e *lifecycle.Engine) *ReturnSubmissionHandler {
-	return &ReturnSubmissionHandler{store: s, engine: e}
+func NewReturnSubmissionHandler(s store.Store, e *lifecycle.Engine, es *exceptionStatus) *ReturnSubmissionHandler {
+	h := &ReturnSubmissionHandler{store: s, engine: e, clock: e.Clock(), parent: es}
+	e.Handle(models.ResourceTypeReturnSubmission, h.updateStatus)
+	return h
 }
 
 func (h *ReturnSubmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -41,15 +46,20 @@ func (h *ReturnSubmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypeReturnSubmission)
+	if !ok {
+		return
+	}
+
 	s := req.Data
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypeReturnSubmission
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
-	s.Attributes.Status = lifecycle.SimpleSubmissionChain[0]
+	s.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeReturnSubmission)
 	s.Attributes.SubmissionDate = now.Format(time.DateOnly)
 
 	if err := h.store.CreateReturnSubmission(paymentID, returnID, s); err != nil {
@@ -60,17 +70,10 @@ func (h *ReturnSubmissionHandler) Create(w http.ResponseWriter, r *http.Request)
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeReturnSubmission, paymentID, returnID, s.ID), models.EventCreated)
 
-	submissionID := s.ID
-	h.engine.StartTransition(models.ResourceTypeReturnSubmission, submissionID, lifecycle.SimpleSubmissionChain, func(newStatus string) error {
-		sub, err := h.store.GetReturnSubmission(paymentID, returnID, submissionID)
-		if err != nil {
-			return err
-		}
-		sub.Attributes.Status = newStatus
-		sub.ModifiedOn = time.Now().UTC()
-		return h.store.UpdateReturnSubmission(paymentID, returnID, sub)
-	})
+	h.parent.submitted(models.ResourceTypeReturnPayment, paymentID, returnID)
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypeReturnSubmission, paymentID, returnID, s.ID), lifecycle.OutcomeDelivered, holdAt)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -95,3 +98,33 @@ func (h *ReturnSubmissionHandler) Get(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.ReturnSubmission]{Data: s})
 }
+
+// History lists the status transitions of a return submission, oldest first.
+func (h *ReturnSubmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	returnID := r.PathValue("returnID")
+	submissionID := r.PathValue("submissionID")
+
+	if _, err := h.store.GetReturnSubmission(paymentID, returnID, submissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "return_submission", submissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeReturnSubmission, []string{paymentID, returnID, submissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a return submission.
+func (h *ReturnSubmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, returnID, submissionID := key.Path[0], key.Path[1], key.Path[2]
+	sub, err := h.store.GetReturnSubmission(paymentID, returnID, submissionID)
+	if err != nil {
+		return err
+	}
+	sub.Attributes.Status = newStatus
+	sub.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateReturnSubmission(paymentID, returnID, sub)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/lifecycle"
 	"github.com/nibble/mock-fps/internal/models"
@@ -16,10 +17,14 @@ import (
 type ReversalSubmissionHandler struct {
 	store  store.Store
 	engine *lifecycle.Engine
+	clock  clock.Clock
+	parent *exceptionStatus
 }
 
-func NewReversalSubmissionHandler(s store.Store, e *lifecycle.Engine) *ReversalSubmissionHandler {
-	return &ReversalSubmissionHandler{store: s, engine: e}
+func NewReversalSubmissionHandler(s store.Store, e *lifecycle.Engine, es *exceptionStatus) *ReversalSubmissionHandler {
+	h := &ReversalSubmissionHandler{store: s, engine: e, clock: e.Clock(), parent: es}
+	e.Handle(models.ResourceTypeReversalSubmission, h.updateStatus)
+	return h
 }
 
 func (h *ReversalSubmissionHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -41,15 +46,20 @@ func (h *ReversalSubmissionHandler) Create(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	holdAt, ok := holdAtHeader(w, r, h.engine, models.ResourceTypeReversalSubmission)
+	if !ok {
+		return
+	}
+
 	s := req.Data
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypeReversalSubmission
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
-	s.Attributes.Status = lifecycle.SimpleSubmissionChain[0]
+	s.Attributes.Status = h.engine.InitialStatus(models.ResourceTypeReversalSubmission)
 	s.Attributes.SubmissionDate = now.Format(time.DateOnly)
 
 	if err := h.store.CreateReversalSubmission(paymentID, reversalID, s); err != nil {
@@ -60,17 +70,10 @@ func (h *ReversalSubmissionHandler) Create(w http.ResponseWriter, r *http.Reques
 		jsonapi.InternalError(w)
 		return
 	}
+	h.engine.Notify(lifecycle.NewKey(models.ResourceTypeReversalSubmission, paymentID, reversalID, s.ID), models.EventCreated)
 
-	submissionID := s.ID
-	h.engine.StartTransition(models.ResourceTypeReversalSubmission, submissionID, lifecycle.SimpleSubmissionChain, func(newStatus string) error {
-		sub, err := h.store.GetReversalSubmission(paymentID, reversalID, submissionID)
-		if err != nil {
-			return err
-		}
-		sub.Attributes.Status = newStatus
-		sub.ModifiedOn = time.Now().UTC()
-		return h.store.UpdateReversalSubmission(paymentID, reversalID, sub)
-	})
+	h.parent.submitted(models.ResourceTypeReversal, paymentID, reversalID)
+	h.engine.StartTransitionHeld(lifecycle.NewKey(models.ResourceTypeReversalSubmission, paymentID, reversalID, s.ID), lifecycle.OutcomeDelivered, holdAt)
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	w.WriteHeader(http.StatusCreated)
@@ -95,3 +98,33 @@ func (h *ReversalSubmissionHandler) Get(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.ReversalSubmission]{Data: s})
 }
+
+// History lists the status transitions of a reversal submission, oldest first.
+func (h *ReversalSubmissionHandler) History(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("paymentID")
+	reversalID := r.PathValue("reversalID")
+	submissionID := r.PathValue("submissionID")
+
+	if _, err := h.store.GetReversalSubmission(paymentID, reversalID, submissionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "reversal_submission", submissionID)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	writeHistory(w, h.store.ListTransitions(models.ResourceTypeReversalSubmission, []string{paymentID, reversalID, submissionID}))
+}
+
+// updateStatus persists a lifecycle transition of a reversal submission.
+func (h *ReversalSubmissionHandler) updateStatus(key lifecycle.Key, outcome lifecycle.Outcome, newStatus string) error {
+	paymentID, reversalID, submissionID := key.Path[0], key.Path[1], key.Path[2]
+	sub, err := h.store.GetReversalSubmission(paymentID, reversalID, submissionID)
+	if err != nil {
+		return err
+	}
+	sub.Attributes.Status = newStatus
+	sub.ModifiedOn = h.clock.Now().UTC()
+	return h.store.UpdateReversalSubmission(paymentID, reversalID, sub)
+}
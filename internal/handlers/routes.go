@@ -4,26 +4,85 @@ import (
 	"net/http"
 
 	"github.com/nibble/mock-fps/internal/lifecycle"
+	"github.com/nibble/mock-fps/internal/payee"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
 const basePath = "/v1/transaction/payments"
 const subsPath = "/v1/notification/subscriptions"
+const adminPath = "/__admin"
+const copPath = "/v1/confirmation-of-payee"
+
+// RouteOption configures optional behaviour of the routes RegisterRoutes
+// sets up.
+type RouteOption func(*routeOptions)
+
+type routeOptions struct {
+	validation     *AccountValidation
+	matcher        payee.Matcher
+	redriver       Redriver
+	strictAccounts bool
+}
+
+// WithAccountValidation validates the parties of payments on create.
+func WithAccountValidation(v *AccountValidation) RouteOption {
+	return func(o *routeOptions) { o.validation = v }
+}
+
+// WithPayeeMatcher sets the thresholds Confirmation of Payee names are
+// matched with, in place of payee.DefaultMatcher.
+func WithPayeeMatcher(m payee.Matcher) RouteOption {
+	return func(o *routeOptions) { o.matcher = m }
+}
+
+// WithRedriver lets dead-lettered webhook notifications be redriven through
+// the admin API.
+func WithRedriver(r Redriver) RouteOption {
+	return func(o *routeOptions) { o.redriver = r }
+}
+
+// WithStrictAccounts rejects inbound payments to accounts that are not in
+// the account registry, rather than taking them to belong to the bank.
+func WithStrictAccounts(strict bool) RouteOption {
+	return func(o *routeOptions) { o.strictAccounts = strict }
+}
 
-// RegisterRoutes registers all API routes on the given mux.
-func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine) {
-	payments := NewPaymentHandler(s)
-	submissions := NewPaymentSubmissionHandler(s, engine)
+// RegisterRoutes registers all API routes on the given mux. It returns the
+// simulator behind the inbound payment admin route, for use from Go.
+func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine, opts ...RouteOption) *Simulator {
+	o := routeOptions{matcher: payee.DefaultMatcher}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	clk := engine.Clock()
+	engine.OnTransition(s.RecordTransition)
+	engine.SetStatusReader(func(key lifecycle.Key) (string, error) {
+		return s.ResourceStatus(key.Type, key.Path)
+	})
+	paymentStatus := newPaymentStatus(s, engine)
+	exceptions := newExceptionStatus(s, engine)
+	newLedgerPostings(s, engine)
+
+	payments := NewPaymentHandler(s, engine)
+	payments.validation = o.validation
+	submissions := NewPaymentSubmissionHandler(s, engine, paymentStatus)
 	admissions := NewPaymentAdmissionHandler(s, engine)
-	returns := NewPaymentReturnHandler(s)
-	returnSubs := NewReturnSubmissionHandler(s, engine)
-	recalls := NewPaymentRecallHandler(s)
+	admissions.strictAccounts = o.strictAccounts
+	returns := NewPaymentReturnHandler(s, engine)
+	returnSubs := NewReturnSubmissionHandler(s, engine, exceptions)
+	recalls := NewPaymentRecallHandler(s, engine)
 	recallSubs := NewRecallSubmissionHandler(s, engine)
-	decisions := NewRecallDecisionHandler(s)
+	decisions := NewRecallDecisionHandler(s, engine)
 	decisionSubs := NewRecallDecisionSubmissionHandler(s, engine)
-	reversals := NewPaymentReversalHandler(s)
-	reversalSubs := NewReversalSubmissionHandler(s, engine)
-	subscriptions := NewSubscriptionHandler(s)
+	reversals := NewPaymentReversalHandler(s, engine)
+	reversalSubs := NewReversalSubmissionHandler(s, engine, exceptions)
+	subscriptions := NewSubscriptionHandler(s, clk)
+	admin := NewAdminHandler(s, engine)
+	simulator := newSimulator(s, engine, admissions)
+	accounts := NewAccountHandler(s)
+	ledgers := NewLedgerHandler(s, engine)
+	confirmations := NewPayeeConfirmationHandler(s, clk, o.matcher)
+	deadLetters := NewDeadLetterHandler(s, o.redriver)
 
 	// Payments
 	mux.HandleFunc("POST "+basePath, payments.Create)
@@ -33,29 +92,36 @@ func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine)
 	// Payment Submissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/submissions", submissions.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/submissions/{submissionID}", submissions.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/submissions/{submissionID}/history", submissions.History)
 
 	// Payment Admissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/admissions", admissions.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/admissions/{admissionID}", admissions.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/admissions/{admissionID}/history", admissions.History)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/admissions/{admissionID}/tasks", admissions.ListTasks)
 	mux.HandleFunc("PATCH "+basePath+"/{paymentID}/admissions/{admissionID}/tasks/{taskID}", admissions.PatchTask)
 
 	// Returns
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/returns", returns.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/returns", returns.List)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/returns/{returnID}", returns.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/returns/{returnID}/history", returns.History)
 
 	// Return Submissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/returns/{returnID}/submissions", returnSubs.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/returns/{returnID}/submissions/{submissionID}", returnSubs.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/returns/{returnID}/submissions/{submissionID}/history", returnSubs.History)
 
 	// Recalls
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/recalls", recalls.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls", recalls.List)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}", recalls.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}/history", recalls.History)
 
 	// Recall Submissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/recalls/{recallID}/submissions", recallSubs.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}/submissions/{submissionID}", recallSubs.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}/submissions/{submissionID}/history", recallSubs.History)
 
 	// Recall Decisions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/recalls/{recallID}/decisions", decisions.Create)
@@ -65,15 +131,21 @@ func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine)
 	// Recall Decision Submissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/recalls/{recallID}/decisions/{decisionID}/submissions", decisionSubs.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}/decisions/{decisionID}/submissions/{submissionID}", decisionSubs.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/recalls/{recallID}/decisions/{decisionID}/submissions/{submissionID}/history", decisionSubs.History)
 
 	// Reversals
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/reversals", reversals.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/reversals", reversals.List)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/reversals/{reversalID}", reversals.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/reversals/{reversalID}/history", reversals.History)
 
 	// Reversal Submissions
 	mux.HandleFunc("POST "+basePath+"/{paymentID}/reversals/{reversalID}/submissions", reversalSubs.Create)
 	mux.HandleFunc("GET "+basePath+"/{paymentID}/reversals/{reversalID}/submissions/{submissionID}", reversalSubs.Get)
+	mux.HandleFunc("GET "+basePath+"/{paymentID}/reversals/{reversalID}/submissions/{submissionID}/history", reversalSubs.History)
+
+	// Confirmation of Payee
+	mux.HandleFunc("POST "+copPath, confirmations.Create)
 
 	// Subscriptions
 	mux.HandleFunc("POST "+subsPath, subscriptions.Create)
@@ -81,6 +153,47 @@ func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine)
 	mux.HandleFunc("GET "+subsPath+"/{subscriptionID}", subscriptions.Get)
 	mux.HandleFunc("PATCH "+subsPath+"/{subscriptionID}", subscriptions.Patch)
 	mux.HandleFunc("DELETE "+subsPath+"/{subscriptionID}", subscriptions.Delete)
+	mux.HandleFunc("POST "+subsPath+"/{subscriptionID}/signing-keys/rotate", subscriptions.RotateKey)
+	mux.HandleFunc("GET "+subsPath+"/{subscriptionID}/deliveries", subscriptions.Deliveries)
+
+	// Admin: virtual clock
+	mux.HandleFunc("GET "+adminPath+"/clock", admin.GetClock)
+	mux.HandleFunc("POST "+adminPath+"/clock/freeze", admin.FreezeClock)
+	mux.HandleFunc("POST "+adminPath+"/clock/unfreeze", admin.UnfreezeClock)
+	mux.HandleFunc("POST "+adminPath+"/clock/advance", admin.AdvanceClock)
+
+	// Admin: lifecycle scheduler
+	mux.HandleFunc("GET "+adminPath+"/lifecycle/stats", admin.LifecycleStats)
+
+	// Admin: force a resource's status
+	mux.HandleFunc("POST "+adminPath+"/resources/{type}/{id}/status", admin.ForceStatus)
+
+	// Admin: lifecycle breakpoints
+	mux.HandleFunc("GET "+adminPath+"/holds", admin.ListHolds)
+	mux.HandleFunc("POST "+adminPath+"/resources/{type}/{id}/pause", admin.PauseLifecycle)
+	mux.HandleFunc("POST "+adminPath+"/resources/{type}/{id}/resume", admin.ResumeLifecycle)
+	mux.HandleFunc("POST "+adminPath+"/resources/{type}/{id}/release", admin.ReleaseLifecycle)
+
+	// Admin: mock account registry
+	mux.HandleFunc("GET "+adminPath+"/accounts", accounts.List)
+	mux.HandleFunc("GET "+adminPath+"/accounts/{sortCode}/{accountNumber}", accounts.Get)
+	mux.HandleFunc("PUT "+adminPath+"/accounts/{sortCode}/{accountNumber}", accounts.Put)
+	mux.HandleFunc("DELETE "+adminPath+"/accounts/{sortCode}/{accountNumber}", accounts.Delete)
+
+	// Admin: ledger
+	mux.HandleFunc("GET "+adminPath+"/ledger/balances", ledgers.Balances)
+	mux.HandleFunc("GET "+adminPath+"/ledger/postings", ledgers.Postings)
+	mux.HandleFunc("POST "+adminPath+"/ledger/accounts/{sortCode}/{accountNumber}/adjustments", ledgers.Adjust)
+
+	// Admin: webhook dead letters
+	mux.HandleFunc("GET "+adminPath+"/dead-letters", deadLetters.List)
+	mux.HandleFunc("POST "+adminPath+"/dead-letters/redrive", deadLetters.RedriveAll)
+	mux.HandleFunc("GET "+adminPath+"/dead-letters/{deadLetterID}", deadLetters.Get)
+	mux.HandleFunc("DELETE "+adminPath+"/dead-letters/{deadLetterID}", deadLetters.Delete)
+	mux.HandleFunc("POST "+adminPath+"/dead-letters/{deadLetterID}/redrive", deadLetters.Redrive)
+
+	// Admin: inbound payment simulator
+	mux.HandleFunc("POST "+adminPath+"/inbound-payments", simulator.InboundCredit)
 
 	// Health check
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
@@ -88,4 +201,5 @@ func RegisterRoutes(mux *http.ServeMux, s store.Store, engine *lifecycle.Engine)
 		w.Write([]byte(`{"status":"ok"}`))
 	})
 
+	return simulator
 }
@@ -7,17 +7,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/jsonapi"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
+	"github.com/nibble/mock-fps/internal/webhook"
 )
 
 type SubscriptionHandler struct {
 	store store.Store
+	clock clock.Clock
 }
 
-func NewSubscriptionHandler(s store.Store) *SubscriptionHandler {
-	return &SubscriptionHandler{store: s}
+func NewSubscriptionHandler(s store.Store, c clock.Clock) *SubscriptionHandler {
+	return &SubscriptionHandler{store: s, clock: c}
 }
 
 func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -32,12 +35,22 @@ func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		s.ID = uuid.New().String()
 	}
 	s.Type = models.ResourceTypeSubscription
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	s.CreatedOn = now
 	s.ModifiedOn = now
 	if !s.Attributes.IsActive {
 		s.Attributes.IsActive = true
 	}
+	keys, err := webhook.PrepareKeys(s.Attributes.SigningKeys)
+	if err != nil {
+		jsonapi.InvalidAttributes(w, map[string]string{"/data/attributes/signing_keys": err.Error()})
+		return
+	}
+	s.Attributes.SigningKeys = keys
+	if !validPayload(s.Attributes.Payload) {
+		jsonapi.InvalidAttributes(w, map[string]string{"/data/attributes/payload": "payload must be thin or full"})
+		return
+	}
 
 	if err := h.store.CreateSubscription(s); err != nil {
 		if errors.Is(err, store.ErrConflict) {
@@ -67,11 +80,14 @@ func (h *SubscriptionHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
-	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Subscription]{Data: s})
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Subscription]{Data: redactKeys(s, "")})
 }
 
 func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
 	subs := h.store.ListSubscriptions()
+	for i := range subs {
+		subs[i] = redactKeys(subs[i], "")
+	}
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.Subscription]{Data: subs})
 }
@@ -105,20 +121,167 @@ func (h *SubscriptionHandler) Patch(w http.ResponseWriter, r *http.Request) {
 	if patch.Attributes.RecordType != "" {
 		existing.Attributes.RecordType = patch.Attributes.RecordType
 	}
+	// include_previous is only taken together with payload.
+	if patch.Attributes.Payload != "" {
+		if !validPayload(patch.Attributes.Payload) {
+			jsonapi.InvalidAttributes(w, map[string]string{"/data/attributes/payload": "payload must be thin or full"})
+			return
+		}
+		existing.Attributes.Payload = patch.Attributes.Payload
+		existing.Attributes.IncludePrevious = patch.Attributes.IncludePrevious
+	}
+	if patch.Attributes.SigningKeys != nil {
+		keys, err := webhook.PrepareKeys(patch.Attributes.SigningKeys)
+		if err != nil {
+			jsonapi.InvalidAttributes(w, map[string]string{"/data/attributes/signing_keys": err.Error()})
+			return
+		}
+		existing.Attributes.SigningKeys = keys
+	}
 	// Allow setting is_active to false explicitly via the raw JSON
 	existing.Attributes.IsActive = patch.Attributes.IsActive
-	existing.ModifiedOn = time.Now().UTC()
+	existing.ModifiedOn = h.clock.Now().UTC()
 	existing.Version++
 
 	if err := h.store.UpdateSubscription(existing); err != nil {
 		jsonapi.InternalError(w)
 		return
 	}
+	if patch.Attributes.SigningKeys == nil {
+		existing = redactKeys(existing, "")
+	}
 
 	w.Header().Set("Content-Type", jsonapi.ContentType)
 	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Subscription]{Data: existing})
 }
 
+func validPayload(p string) bool {
+	return p == "" || p == models.PayloadThin || p == models.PayloadFull
+}
+
+// redactKeys returns s without the secrets and private keys of its signing
+// keys, except for the key with ID keep. Key material is only ever returned
+// in the response to the request that set it.
+func redactKeys(s models.Subscription, keep string) models.Subscription {
+	if s.Attributes.SigningKeys == nil {
+		return s
+	}
+	keys := make([]models.SigningKey, len(s.Attributes.SigningKeys))
+	for i, k := range s.Attributes.SigningKeys {
+		if k.KeyID != keep {
+			k.Secret, k.PrivateKey = "", ""
+		}
+		keys[i] = k
+	}
+	s.Attributes.SigningKeys = keys
+	return s
+}
+
+// KeyRotation adds a signing key to a subscription. The keys signing now go
+// on signing alongside the new one for OverlapSeconds, then expire.
+type KeyRotation struct {
+	Key            models.SigningKey `json:"key"`
+	OverlapSeconds int               `json:"overlap_seconds"`
+}
+
+// RotateKey rotates a subscription's signing keys and returns the
+// subscription, with the key material of the new key only.
+func (h *SubscriptionHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("subscriptionID")
+
+	existing, err := h.store.GetSubscription(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "subscription", id)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	var req jsonapi.DataEnvelope[KeyRotation]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonapi.BadRequest(w, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Data.OverlapSeconds < 0 {
+		jsonapi.InvalidAttributes(w, map[string]string{"/data/overlap_seconds": "overlap_seconds must not be negative"})
+		return
+	}
+
+	now := h.clock.Now().UTC()
+	overlap := time.Duration(req.Data.OverlapSeconds) * time.Second
+	keys, err := webhook.RotateKeys(existing.Attributes.SigningKeys, req.Data.Key, now, overlap)
+	if err != nil {
+		jsonapi.InvalidAttributes(w, map[string]string{"/data/key": err.Error()})
+		return
+	}
+	existing.Attributes.SigningKeys = keys
+	existing.ModifiedOn = now
+	existing.Version++
+
+	if err := h.store.UpdateSubscription(existing); err != nil {
+		jsonapi.InternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.DataEnvelope[models.Subscription]{Data: redactKeys(existing, keys[len(keys)-1].KeyID)})
+}
+
+// Deliveries lists the attempts made to deliver notifications to a
+// subscription, oldest first. The outcome query parameter keeps only
+// succeeded or failed attempts; since and until, as RFC 3339 times, keep
+// attempts made at or after and before them.
+func (h *SubscriptionHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("subscriptionID")
+
+	if _, err := h.store.GetSubscription(id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			jsonapi.NotFound(w, "subscription", id)
+			return
+		}
+		jsonapi.InternalError(w)
+		return
+	}
+
+	q := r.URL.Query()
+	outcome := q.Get("outcome")
+	switch outcome {
+	case "", models.DeliverySucceeded, models.DeliveryFailed:
+	default:
+		jsonapi.BadRequest(w, "outcome must be succeeded or failed")
+		return
+	}
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			jsonapi.BadRequest(w, name+" must be an RFC 3339 time")
+			return
+		}
+		*t = parsed
+	}
+
+	attempts := make([]models.DeliveryAttempt, 0)
+	for _, a := range h.store.ListDeliveryAttempts(id) {
+		at := a.Attributes.AttemptedOn
+		if outcome != "" && a.Attributes.Outcome != outcome ||
+			!since.IsZero() && at.Before(since) ||
+			!until.IsZero() && !at.Before(until) {
+			continue
+		}
+		attempts = append(attempts, a)
+	}
+
+	w.Header().Set("Content-Type", jsonapi.ContentType)
+	json.NewEncoder(w).Encode(jsonapi.ListEnvelope[models.DeliveryAttempt]{Data: attempts})
+}
+
 func (h *SubscriptionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("subscriptionID")
 
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/modulus"
+)
+
+// Account validation modes. Lenient mode logs invalid payment parties and
+// accepts the payment anyway; strict mode rejects it.
+const (
+	ValidationLenient = "lenient"
+	ValidationStrict  = "strict"
+)
+
+// AccountValidation checks the sort codes and account numbers of payments
+// being created.
+type AccountValidation struct {
+	strict bool
+	table  *modulus.Table
+}
+
+// NewAccountValidation creates an AccountValidation in the given mode. A nil
+// table checks formats only.
+func NewAccountValidation(mode string, table *modulus.Table) (*AccountValidation, error) {
+	if table == nil {
+		table = &modulus.Table{}
+	}
+	switch mode {
+	case ValidationLenient, "":
+		return &AccountValidation{table: table}, nil
+	case ValidationStrict:
+		return &AccountValidation{strict: true, table: table}, nil
+	}
+	return nil, fmt.Errorf("unknown account validation mode %q", mode)
+}
+
+// problems returns what is wrong with p's parties, keyed by JSON pointer.
+func (v *AccountValidation) problems(p models.Payment) map[string]string {
+	out := make(map[string]string)
+	for name, party := range map[string]*models.AccountParty{
+		"debtor_party":      p.Attributes.DebtorParty,
+		"beneficiary_party": p.Attributes.BeneficiaryParty,
+	} {
+		if party == nil {
+			continue
+		}
+		pointer := "/data/attributes/" + name + "/"
+		switch err := v.table.Check(party.SortCode, party.AccountNumber); {
+		case errors.Is(err, modulus.ErrSortCode):
+			out[pointer+"sort_code"] = err.Error()
+		case err != nil:
+			out[pointer+"account_number"] = err.Error()
+		}
+	}
+	return out
+}
+
+// reject reports whether p must be rejected for the problems found, logging
+// them if it is accepted regardless.
+func (v *AccountValidation) reject(p models.Payment, problems map[string]string) bool {
+	if len(problems) == 0 {
+		return false
+	}
+	if v.strict {
+		return true
+	}
+	for pointer, detail := range problems {
+		log.Printf("payment %s: %s: %s", p.ID, pointer, detail)
+	}
+	return false
+}
@@ -17,7 +17,13 @@ type ErrorResponse struct {
 
 // Error is a single JSON:API error object.
 type Error struct {
-	Status string `json:"status"`
-	Title  string `json:"title"`
-	Detail string `json:"detail,omitempty"`
+	Status string       `json:"status"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail,omitempty"`
+	Source *ErrorSource `json:"source,omitempty"`
+}
+
+// ErrorSource points at the part of the request an error is about.
+type ErrorSource struct {
+	Pointer string `json:"pointer,omitempty"`
 }
@@ -3,6 +3,7 @@ package jsonapi
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
 )
 
@@ -20,6 +21,28 @@ func WriteError(w http.ResponseWriter, status int, title, detail string) {
 	})
 }
 
+// InvalidAttributes writes a 400 response with one error per entry of
+// details, keyed by JSON pointer into the request document.
+func InvalidAttributes(w http.ResponseWriter, details map[string]string) {
+	pointers := make([]string, 0, len(details))
+	for p := range details {
+		pointers = append(pointers, p)
+	}
+	sort.Strings(pointers)
+	resp := ErrorResponse{Errors: make([]Error, len(pointers))}
+	for i, p := range pointers {
+		resp.Errors[i] = Error{
+			Status: strconv.Itoa(http.StatusBadRequest),
+			Title:  "Invalid Attribute",
+			Detail: details[p],
+			Source: &ErrorSource{Pointer: p},
+		}
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+}
+
 func NotFound(w http.ResponseWriter, resourceType, id string) {
 	WriteError(w, http.StatusNotFound, "Not Found", resourceType+" "+id+" not found")
 }
@@ -0,0 +1,261 @@
+// Package ledger keeps double-entry balances of the mock bank's accounts.
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Internal accounts. SettlementAccount is the other side of every payment
+// posting: the bank's position with the scheme. AdjustmentsAccount is the
+// other side of adjustments.
+const (
+	SettlementAccount  = "settlement"
+	AdjustmentsAccount = "adjustments"
+)
+
+// Posting kinds.
+const (
+	KindPayment    = "payment"    // outbound payment released to the gateway
+	KindAdmission  = "admission"  // inbound payment admitted
+	KindReturn     = "return"     // payment returned
+	KindReversal   = "reversal"   // outbound payment given back
+	KindAdjustment = "adjustment" // made through the admin API
+)
+
+// ErrInsufficientFunds is returned when a reservation exceeds the available
+// balance of an account.
+var ErrInsufficientFunds = errors.New("ledger: insufficient funds")
+
+// AccountID names the ledger account of a bank account.
+func AccountID(sortCode, accountNumber string) string {
+	return sortCode + "/" + accountNumber
+}
+
+// Posting is one leg of an entry. Credits are positive, debits negative.
+type Posting struct {
+	ID        string    `json:"id"`
+	EntryID   string    `json:"entry_id"`
+	Account   string    `json:"account"`
+	Amount    string    `json:"amount"`
+	Currency  string    `json:"currency,omitempty"`
+	Kind      string    `json:"kind"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	PostedOn  time.Time `json:"posted_on"`
+
+	minor int64
+}
+
+// Entry moves Amount, in minor units, from Debit to Credit.
+type Entry struct {
+	Debit     string
+	Credit    string
+	Amount    int64
+	Currency  string
+	Kind      string
+	PaymentID string
+	// Reference identifies the resource the entry is for, e.g.
+	// "payment_submissions/<id>".
+	Reference string
+	At        time.Time
+}
+
+// Balance is the position of one account.
+type Balance struct {
+	Account   string `json:"account"`
+	Balance   string `json:"balance"`
+	Reserved  string `json:"reserved"`
+	Available string `json:"available"`
+}
+
+type reservation struct {
+	Account string `json:"account"`
+	Amount  int64  `json:"amount"`
+}
+
+// Ledger is a set of accounts and the postings made to them. Funds can be
+// reserved ahead of a posting so that concurrent payments cannot overdraw an
+// account. The zero value is not usable; call New.
+type Ledger struct {
+	mu       sync.Mutex
+	postings []Posting
+	balances map[string]int64
+	reserved map[string]reservation // by reference
+}
+
+// New creates an empty ledger.
+func New() *Ledger {
+	return &Ledger{balances: make(map[string]int64), reserved: make(map[string]reservation)}
+}
+
+// Post records e as a debit of one account and a matching credit of another.
+func (l *Ledger) Post(e Entry) error {
+	if e.Amount <= 0 {
+		return fmt.Errorf("ledger: amount must be positive, got %s", FormatAmount(e.Amount))
+	}
+	entryID := uuid.New().String()
+	leg := func(account string, amount int64) Posting {
+		return Posting{
+			ID:        uuid.New().String(),
+			EntryID:   entryID,
+			Account:   account,
+			Amount:    FormatAmount(amount),
+			Currency:  e.Currency,
+			Kind:      e.Kind,
+			PaymentID: e.PaymentID,
+			Reference: e.Reference,
+			PostedOn:  e.At,
+			minor:     amount,
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.postings = append(l.postings, leg(e.Debit, -e.Amount), leg(e.Credit, e.Amount))
+	l.balances[e.Debit] -= e.Amount
+	l.balances[e.Credit] += e.Amount
+	return nil
+}
+
+// Reserve sets amount aside on account for ref, provided the account's
+// available balance covers it.
+func (l *Ledger) Reserve(ref, account string, amount int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.availableLocked(account) < amount {
+		return ErrInsufficientFunds
+	}
+	l.reserved[ref] = reservation{Account: account, Amount: amount}
+	return nil
+}
+
+// Release drops the reservation made for ref, if any.
+func (l *Ledger) Release(ref string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.reserved, ref)
+}
+
+// Outstanding returns how much of an outbound payment is still debited from
+// account: what was paid less what has been given back by reversals.
+func (l *Ledger) Outstanding(account, paymentID string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int64
+	for _, p := range l.postings {
+		if p.Account == account && p.PaymentID == paymentID && (p.Kind == KindPayment || p.Kind == KindReversal) {
+			n -= p.minor
+		}
+	}
+	return n
+}
+
+// Balance returns the position of account.
+func (l *Ledger) Balance(account string) Balance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.balanceLocked(account)
+}
+
+// Balances returns the position of every account with postings or
+// reservations, ordered by account.
+func (l *Ledger) Balances() []Balance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := make(map[string]bool, len(l.balances))
+	for account := range l.balances {
+		seen[account] = true
+	}
+	for _, r := range l.reserved {
+		seen[r.Account] = true
+	}
+	out := make([]Balance, 0, len(seen))
+	for account := range seen {
+		out = append(out, l.balanceLocked(account))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Account < out[j].Account })
+	return out
+}
+
+// Postings returns the postings to account, or all postings if account is
+// empty, oldest first.
+func (l *Ledger) Postings(account string) []Posting {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Posting{}
+	for _, p := range l.postings {
+		if account == "" || p.Account == account {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (l *Ledger) balanceLocked(account string) Balance {
+	var reserved int64
+	for _, r := range l.reserved {
+		if r.Account == account {
+			reserved += r.Amount
+		}
+	}
+	return Balance{
+		Account:   account,
+		Balance:   FormatAmount(l.balances[account]),
+		Reserved:  FormatAmount(reserved),
+		Available: FormatAmount(l.balances[account] - reserved),
+	}
+}
+
+func (l *Ledger) availableLocked(account string) int64 {
+	n := l.balances[account]
+	for _, r := range l.reserved {
+		if r.Account == account {
+			n -= r.Amount
+		}
+	}
+	return n
+}
+
+// ledgerState is the JSON form of a Ledger.
+type ledgerState struct {
+	Postings []Posting              `json:"postings"`
+	Reserved map[string]reservation `json:"reserved"`
+}
+
+// MarshalJSON encodes the ledger's postings and reservations.
+func (l *Ledger) MarshalJSON() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return json.Marshal(ledgerState{Postings: l.postings, Reserved: l.reserved})
+}
+
+// UnmarshalJSON replaces the ledger's contents with ones encoded by
+// MarshalJSON.
+func (l *Ledger) UnmarshalJSON(data []byte) error {
+	var st ledgerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	balances := make(map[string]int64)
+	for i := range st.Postings {
+		n, err := ParseAmount(st.Postings[i].Amount)
+		if err != nil {
+			return fmt.Errorf("posting %s: %w", st.Postings[i].ID, err)
+		}
+		st.Postings[i].minor = n
+		balances[st.Postings[i].Account] += n
+	}
+	if st.Reserved == nil {
+		st.Reserved = make(map[string]reservation)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.postings, l.balances, l.reserved = st.Postings, balances, st.Reserved
+	return nil
+}
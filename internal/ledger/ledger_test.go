@@ -0,0 +1,61 @@
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	for in, want := range map[string]int64{"0": 0, "12": 1200, "12.3": 1230, "12.34": 1234, "-0.05": -5} {
+		got, err := ParseAmount(in)
+		if err != nil || got != want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d", in, got, err, want)
+		}
+		if in == "12.34" && FormatAmount(got) != in {
+			t.Errorf("FormatAmount(%d) = %s", got, FormatAmount(got))
+		}
+	}
+	for _, in := range []string{"", "1.234", "abc", "1.x", "."} {
+		if _, err := ParseAmount(in); err == nil {
+			t.Errorf("ParseAmount(%q): expected an error", in)
+		}
+	}
+}
+
+func TestReservations(t *testing.T) {
+	l := New()
+	if err := l.Post(Entry{Debit: SettlementAccount, Credit: "a", Amount: 1000, Kind: KindAdjustment}); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if err := l.Reserve("r1", "a", 600); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := l.Reserve("r2", "a", 600); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if b := l.Balance("a"); b.Balance != "10.00" || b.Reserved != "6.00" || b.Available != "4.00" {
+		t.Errorf("unexpected balance %+v", b)
+	}
+
+	l.Post(Entry{Debit: "a", Credit: SettlementAccount, Amount: 600, Kind: KindPayment, PaymentID: "p"})
+	l.Release("r1")
+	if n := l.Outstanding("a", "p"); n != 600 {
+		t.Errorf("expected 600 outstanding, got %d", n)
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	restored := New()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if b := restored.Balance("a"); b.Available != "4.00" {
+		t.Errorf("restored: unexpected balance %+v", b)
+	}
+	if n := len(restored.Postings("")); n != 4 {
+		t.Errorf("restored: expected 4 postings, got %d", n)
+	}
+}
@@ -0,0 +1,142 @@
+package lifecycle
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Random is the source of randomness used to plan lifecycles. *rand.Rand
+// satisfies it.
+type Random interface {
+	Float64() float64
+	NormFloat64() float64
+}
+
+// Distribution kinds.
+const (
+	DistributionFixed     = "fixed"
+	DistributionUniform   = "uniform"
+	DistributionNormal    = "normal"
+	DistributionLogNormal = "lognormal"
+)
+
+// Distribution describes how a delay is drawn. Which fields apply depends on
+// Kind:
+//
+//	fixed:     ms
+//	uniform:   min_ms, max_ms
+//	normal:    mean_ms, stddev_ms
+//	lognormal: median_ms, sigma
+//
+// For normal and log-normal delays, min_ms and max_ms optionally clamp the
+// result. Delays are never negative.
+type Distribution struct {
+	Kind     string  `json:"kind"`
+	Ms       float64 `json:"ms,omitempty"`
+	MinMs    float64 `json:"min_ms,omitempty"`
+	MaxMs    float64 `json:"max_ms,omitempty"`
+	MeanMs   float64 `json:"mean_ms,omitempty"`
+	StddevMs float64 `json:"stddev_ms,omitempty"`
+	MedianMs float64 `json:"median_ms,omitempty"`
+	Sigma    float64 `json:"sigma,omitempty"`
+}
+
+// DelayProfile sets the delays of one machine's transitions.
+type DelayProfile struct {
+	// Default applies to every transition without a more specific delay.
+	Default *Distribution `json:"default,omitempty"`
+	// Steps holds delays keyed by the status transitioned to.
+	Steps map[string]*Distribution `json:"steps,omitempty"`
+}
+
+// Validate checks the distribution's parameters.
+func (d *Distribution) Validate() error {
+	if d.MinMs < 0 || d.MaxMs < 0 || (d.MaxMs > 0 && d.MaxMs < d.MinMs) {
+		return fmt.Errorf("%s delay: invalid min_ms/max_ms", d.Kind)
+	}
+	switch d.Kind {
+	case DistributionFixed:
+		if d.Ms < 0 {
+			return fmt.Errorf("fixed delay: negative ms")
+		}
+	case DistributionUniform:
+		if d.MaxMs == 0 {
+			return fmt.Errorf("uniform delay: max_ms is required")
+		}
+	case DistributionNormal:
+		if d.StddevMs < 0 {
+			return fmt.Errorf("normal delay: negative stddev_ms")
+		}
+	case DistributionLogNormal:
+		if d.MedianMs <= 0 || d.Sigma < 0 {
+			return fmt.Errorf("lognormal delay: median_ms must be positive and sigma non-negative")
+		}
+	default:
+		return fmt.Errorf("unknown delay kind %q", d.Kind)
+	}
+	return nil
+}
+
+// Sample draws a delay.
+func (d *Distribution) Sample(r Random) time.Duration {
+	var ms float64
+	switch d.Kind {
+	case DistributionFixed:
+		return msDuration(d.Ms)
+	case DistributionUniform:
+		ms = d.MinMs + r.Float64()*(d.MaxMs-d.MinMs)
+	case DistributionNormal:
+		ms = d.MeanMs + r.NormFloat64()*d.StddevMs
+	case DistributionLogNormal:
+		ms = d.MedianMs * math.Exp(r.NormFloat64()*d.Sigma)
+	}
+	ms = max(ms, d.MinMs)
+	if d.MaxMs > 0 {
+		ms = min(ms, d.MaxMs)
+	}
+	return msDuration(ms)
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(max(ms, 0) * float64(time.Millisecond))
+}
+
+// Validate checks the profile against the machine it belongs to.
+func (p *DelayProfile) Validate(d *Definition) error {
+	if p.Default != nil {
+		if err := p.Default.Validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for status, dist := range p.Steps {
+		if _, ok := d.States[status]; !ok {
+			return fmt.Errorf("delay for undefined state %q", status)
+		}
+		if dist == nil {
+			return fmt.Errorf("state %q: empty delay", status)
+		}
+		if err := dist.Validate(); err != nil {
+			return fmt.Errorf("state %q: %w", status, err)
+		}
+	}
+	return nil
+}
+
+// delay returns the delay before transition t. An explicit delay_ms on the
+// transition wins, then the profile's delay for the target status, then the
+// profile's default, then fallback.
+func (d *Definition) delay(t Transition, fallback time.Duration, r Random) time.Duration {
+	if t.DelayMs != nil {
+		return time.Duration(*t.DelayMs) * time.Millisecond
+	}
+	if d.Delays != nil {
+		if dist := d.Delays.Steps[t.To]; dist != nil {
+			return dist.Sample(r)
+		}
+		if d.Delays.Default != nil {
+			return d.Delays.Default.Sample(r)
+		}
+	}
+	return fallback
+}
@@ -1,46 +1,659 @@
 package lifecycle
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
+	"sync"
 	"time"
+
+	"github.com/nibble/mock-fps/internal/clock"
+	"github.com/nibble/mock-fps/internal/models"
 )
 
-// StatusUpdater is a closure that updates the status of a resource.
-// It returns the new status on success, or an error.
-type StatusUpdater func(newStatus string) error
+// ErrNotVirtual is returned when time control is requested on a real clock.
+var ErrNotVirtual = errors.New("lifecycle: engine clock is not virtual")
+
+// Updater persists a status change of the resource identified by key. The
+// outcome is the one the lifecycle was started with.
+type Updater func(key Key, outcome Outcome, newStatus string) error
+
+// StatusReader reads the stored status of the resource identified by key.
+type StatusReader func(key Key) (string, error)
+
+// StatusChangeCallback is called with models.EventCreated or
+// models.EventUpdated for each change to the resource of the given type whose
+// key is made of path. For an update that moved the resource to a new status,
+// status is that status; otherwise it is empty.
+type StatusChangeCallback func(resourceType string, path []string, event, status string)
+
+// TransitionFunc observes a status transition of the resource of the given
+// type whose key is made of path.
+type TransitionFunc func(resourceType string, path []string, t models.StatusTransition)
 
-// StatusChangeCallback is called after each status transition.
-type StatusChangeCallback func(resourceType, resourceID, newStatus string)
+// OutcomeSelector picks the outcome of a payment submission lifecycle.
+type OutcomeSelector func(p models.Payment) Outcome
+
+// TaskSelector picks the tasks an admission of a payment waits for.
+type TaskSelector func(p models.Payment) []string
 
 // Engine manages async status transitions.
 type Engine struct {
 	stepDelay time.Duration
+	clock     clock.Clock
 	onChange  StatusChangeCallback
+	observers []TransitionFunc
+	onClock   []func()
+	onDrop    []func(Key)
+	selector  OutcomeSelector
+	tasks     TaskSelector
+	defs      Definitions
+	updaters  map[string]Updater
+	reader    StatusReader
+	journal   Journal
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	workers int
+	wake    chan struct{}
+	work    chan *lifecycleRun
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    sync.WaitGroup // scheduler and workers
+	policy  ShutdownPolicy
+
+	mu         sync.Mutex
+	closed     bool
+	idle       *sync.Cond // signalled when a worker finishes a transition
+	queue      runHeap
+	runs       map[string]*lifecycleRun // by key, queued or in flight
+	dispatched int
+	running    int
+	executed   uint64
+	held       int
 }
 
-// NewEngine creates a new lifecycle engine.
-func NewEngine(stepDelayMs int, onChange StatusChangeCallback) *Engine {
-	return &Engine{
+// lifecycleRun is a resource part-way through its state machine.
+type lifecycleRun struct {
+	key      Key
+	outcome  Outcome
+	start    string // status the steps start from
+	steps    []Step
+	next     int
+	due      time.Time
+	index    int  // position in the scheduler heap, -1 when not queued
+	stopped  bool // superseded by Force
+	stepping bool // a transition is being applied; see Force
+
+	// Breakpoints; see holds.go.
+	holdAt    string        // status to hold at once applied
+	held      bool          // waiting to be resumed or released
+	heldAt    time.Time     // when the hold began
+	remaining time.Duration // time left until the next transition when held
+}
+
+// NewEngine creates a new lifecycle engine. A single scheduler goroutine
+// hands due transitions to a pool of workers goroutines, all of which stop
+// when ctx is cancelled.
+func NewEngine(ctx context.Context, stepDelayMs, workers int, clk clock.Clock, onChange StatusChangeCallback) *Engine {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	e := &Engine{
 		stepDelay: time.Duration(stepDelayMs) * time.Millisecond,
+		clock:     clk,
 		onChange:  onChange,
+		defs:      DefaultDefinitions(),
+		updaters:  make(map[string]Updater),
+		workers:   workers,
+		wake:      make(chan struct{}, 1),
+		work:      make(chan *lifecycleRun, workers),
+		ctx:       ctx,
+		cancel:    cancel,
+		policy:    ShutdownAbandon,
+		runs:      make(map[string]*lifecycleRun),
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	e.idle = sync.NewCond(&e.mu)
+	e.done.Add(workers + 1)
+	go e.schedule()
+	for i := 0; i < workers; i++ {
+		go e.worker()
+	}
+	return e
+}
+
+// Clock returns the engine's clock.
+func (e *Engine) Clock() clock.Clock {
+	return e.clock
+}
+
+// SetOutcomeSelector installs the function used to pick submission outcomes.
+// It must be called before the engine is used.
+func (e *Engine) SetOutcomeSelector(s OutcomeSelector) {
+	e.selector = s
+}
+
+// SetTaskSelector installs the function used to pick admission tasks.
+// It must be called before the engine is used.
+func (e *Engine) SetTaskSelector(s TaskSelector) {
+	e.tasks = s
+}
+
+// SetDefinitions replaces the engine's state machines after validating them.
+// It must be called before the engine is used.
+func (e *Engine) SetDefinitions(defs Definitions) error {
+	if err := defs.Validate(); err != nil {
+		return err
+	}
+	e.defs = defs
+	return nil
+}
+
+// SetSeed makes the engine's branch choices and delays reproducible: the
+// same seed and the same sequence of lifecycles give the same plans.
+// It must be called before the engine is used.
+func (e *Engine) SetSeed(seed uint64) {
+	e.rng = rand.New(rand.NewPCG(seed, seed))
+}
+
+// OnTransition makes the engine report every transition it applies to fn,
+// after any functions registered earlier and before the StatusChangeCallback.
+// It must be called before the engine is used.
+func (e *Engine) OnTransition(fn TransitionFunc) {
+	e.observers = append(e.observers, fn)
+}
+
+// OnClockChange makes the engine call fn whenever its clock is frozen,
+// unfrozen or moved through the engine, so that others timed by the same
+// clock can re-read it. It must be called before the engine is used.
+func (e *Engine) OnClockChange(fn func()) {
+	e.onClock = append(e.onClock, fn)
+}
+
+// OnDrop makes the engine call fn with the key of every lifecycle it gives up
+// on before it finishes: one whose transition fails and cannot be replanned,
+// one it cannot restore and, when there is no journal to resume them from,
+// those left pending by an abandoning Shutdown. It must be called before the
+// engine is used.
+func (e *Engine) OnDrop(fn func(key Key)) {
+	e.onDrop = append(e.onDrop, fn)
+}
+
+// Notify passes a change made outside the engine's lifecycles to its
+// StatusChangeCallback, so it is announced like any other.
+func (e *Engine) Notify(key Key, event string) {
+	if e.onChange != nil {
+		e.onChange(key.Type, key.Path, event, "")
+	}
+}
+
+// NotifyStatus announces that a resource was updated to a new status, like
+// the transitions the engine applies itself.
+func (e *Engine) NotifyStatus(key Key, status string) {
+	if e.onChange != nil {
+		e.onChange(key.Type, key.Path, models.EventUpdated, status)
+	}
+}
+
+// SetJournal makes the engine record pending transitions in j.
+// It must be called before the engine is used.
+func (e *Engine) SetJournal(j Journal) {
+	e.journal = j
+}
+
+// Handle registers the updater for a resource type. Lifecycles of that type
+// can only be started or restored once it is registered.
+func (e *Engine) Handle(resourceType string, u Updater) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.updaters[resourceType] = u
+}
+
+// SetStatusReader lets the engine read the stored status of resources, so
+// that a lifecycle whose transition is rejected carries on from wherever its
+// resource actually is. It must be called before the engine is used.
+func (e *Engine) SetStatusReader(r StatusReader) {
+	e.reader = r
+}
+
+// InitialStatus returns the status a new resource of the given type starts in.
+func (e *Engine) InitialStatus(resourceType string) string {
+	if d, ok := e.defs[resourceType]; ok {
+		return d.Initial
+	}
+	return ""
+}
+
+// SubmissionOutcome returns the outcome for a payment submission of p.
+func (e *Engine) SubmissionOutcome(p models.Payment) Outcome {
+	if e.selector == nil {
+		return OutcomeDelivered
+	}
+	return e.selector(p)
+}
+
+// AdmissionTasks returns the tasks an admission of p waits for.
+func (e *Engine) AdmissionTasks(p models.Payment) []string {
+	if e.tasks == nil {
+		return nil
+	}
+	return e.tasks(p)
+}
+
+// StartTransition begins an async walk of the resource type's state machine.
+// The updater registered for key.Type persists each status change.
+func (e *Engine) StartTransition(key Key, outcome Outcome) {
+	e.start(key, outcome, "")
+}
+
+// StartTransitionHeld is StartTransition with a breakpoint: the lifecycle
+// stops once the resource reaches holdAt, until it is resumed or released.
+// An empty holdAt sets no breakpoint.
+func (e *Engine) StartTransitionHeld(key Key, outcome Outcome, holdAt string) {
+	e.start(key, outcome, holdAt)
+}
+
+func (e *Engine) start(key Key, outcome Outcome, holdAt string) {
+	def, ok := e.defs[key.Type]
+	if !ok {
+		log.Printf("lifecycle: no state machine for %s, leaving %s as is", key.Type, key)
+		return
+	}
+	steps := e.plan(def, def.Initial, outcome)
+	if len(steps) == 0 {
+		return
+	}
+	// The initial status was already set at creation time.
+	run := &lifecycleRun{
+		key:     key,
+		outcome: outcome,
+		start:   def.Initial,
+		steps:   steps,
+		due:     e.clock.Now().Add(steps[0].Delay),
+		index:   -1,
+		holdAt:  holdAt,
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		log.Printf("lifecycle: engine shut down, not starting %s", key)
+		return
+	}
+	e.runs[key.String()] = run
+	if holdAt == def.Initial {
+		e.holdLocked(run)
+	} else {
+		e.scheduleLocked(run)
 	}
+	e.record(run)
 }
 
-// StartTransition begins an async status chain for a resource.
-// The updater closure is responsible for actually persisting the status change.
-func (e *Engine) StartTransition(resourceType, resourceID string, chain StatusChain, updater StatusUpdater) {
-	go func() {
-		// Skip the first status (already set at creation time).
-		for i := 1; i < len(chain); i++ {
-			time.Sleep(e.stepDelay)
-			newStatus := chain[i]
-			if err := updater(newStatus); err != nil {
-				log.Printf("lifecycle: failed to update %s %s to %s: %v", resourceType, resourceID, newStatus, err)
-				return
+// Restore schedules every transition left in the journal by a previous run of
+// the server. Each carries on from the status its resource is stored in,
+// whichever way that differs from the journal. Overdue lifecycles continue
+// from now rather than catching up all at once, and held ones stay held. It returns the number of lifecycles
+// restored, and fails if a lifecycle that cannot be restored cannot be
+// dropped from the journal either.
+func (e *Engine) Restore() (int, error) {
+	if e.journal == nil {
+		return 0, nil
+	}
+	now := e.clock.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for _, p := range e.journal.Pending() {
+		if _, ok := e.updaters[p.Key.Type]; !ok || p.Next >= len(p.Steps) {
+			log.Printf("lifecycle: cannot restore %s, dropping it", p.Key)
+			if err := e.journal.Delete(p.Key); err != nil {
+				return n, fmt.Errorf("lifecycle: drop %s from journal: %w", p.Key, err)
 			}
-			if e.onChange != nil {
-				e.onChange(resourceType, resourceID, newStatus)
+			e.dropped(p.Key)
+			continue
+		}
+		run := &lifecycleRun{
+			key:     p.Key,
+			outcome: p.Outcome,
+			start:   p.Start,
+			steps:   p.Steps,
+			next:    p.Next,
+			due:     p.Due,
+			index:   -1,
+			holdAt:  p.HoldAt,
+		}
+		if run.start == "" {
+			run.start = e.InitialStatus(p.Key.Type)
+		}
+		if !e.reconcile(run) {
+			log.Printf("lifecycle: %s has nothing left to do, dropping it", p.Key)
+			if err := e.journal.Delete(p.Key); err != nil {
+				return n, fmt.Errorf("lifecycle: drop %s from journal: %w", p.Key, err)
 			}
+			e.dropped(p.Key)
+			continue
+		}
+		if run.start != p.Start || run.next != p.Next {
+			e.record(run)
+		}
+		e.runs[run.key.String()] = run
+		n++
+		if p.Held {
+			run.held = true
+			run.heldAt = now
+			run.remaining = p.Remaining
+			e.held++
+			continue
+		}
+		if run.due.Before(now) {
+			run.due = now
+		}
+		e.scheduleLocked(run)
+	}
+	return n, nil
+}
+
+// reconcile moves a restored run to the status its resource is stored in,
+// which after a crash may be ahead of or behind the journal. A status the
+// run's plan does not pass through is planned afresh. It reports false if
+// the resource cannot be read or has nowhere left to go.
+func (e *Engine) reconcile(run *lifecycleRun) bool {
+	if e.reader == nil {
+		return true
+	}
+	current, err := e.reader(run.key)
+	if err != nil {
+		log.Printf("lifecycle: cannot read the status of %s: %v", run.key, err)
+		return false
+	}
+	if current == run.current() {
+		return true
+	}
+	if current == run.start {
+		run.next = 0
+		return true
+	}
+	for i, s := range run.steps {
+		if s.Status == current {
+			run.next = i + 1
+			return run.next < len(run.steps)
+		}
+	}
+	def := e.defs[run.key.Type]
+	if def == nil {
+		return false
+	}
+	if _, ok := def.States[current]; !ok {
+		return false
+	}
+	run.start, run.steps, run.next = current, e.plan(def, current, run.outcome), 0
+	return len(run.steps) > 0
+}
+
+// plan draws the steps of a lifecycle of def starting from state from.
+func (e *Engine) plan(def *Definition, from string, outcome Outcome) []Step {
+	e.rngMu.Lock()
+	defer e.rngMu.Unlock()
+	return def.planFrom(from, outcome, e.stepDelay, e.rng)
+}
+
+// record writes run's progress to the journal, if there is one.
+func (e *Engine) record(run *lifecycleRun) {
+	if e.journal == nil {
+		return
+	}
+	err := e.journal.Put(PendingTransition{
+		Key:       run.key,
+		Outcome:   run.outcome,
+		Start:     run.start,
+		Steps:     run.steps,
+		Next:      run.next,
+		Due:       run.due,
+		HoldAt:    run.holdAt,
+		Held:      run.held,
+		Remaining: run.remaining,
+	})
+	if err != nil {
+		log.Printf("lifecycle: journal write for %s failed: %v", run.key, err)
+	}
+}
+
+// forget drops a finished run and removes it from the journal, if there is
+// one, reporting whether it did. Runs superseded by Force are left alone.
+func (e *Engine) forget(run *lifecycleRun) bool {
+	e.mu.Lock()
+	current := e.runs[run.key.String()] == run
+	if current {
+		delete(e.runs, run.key.String())
+	}
+	e.mu.Unlock()
+	if current {
+		e.removeFromJournal(run.key)
+	}
+	return current
+}
+
+// abandon is forget for a run given up on before it finished.
+func (e *Engine) abandon(run *lifecycleRun) {
+	if e.forget(run) {
+		e.dropped(run.key)
+	}
+}
+
+// dropped reports a lifecycle given up on to the OnDrop functions.
+func (e *Engine) dropped(key Key) {
+	for _, fn := range e.onDrop {
+		fn(key)
+	}
+}
+
+// removeFromJournal deletes key's entry from the journal, if there is one.
+func (e *Engine) removeFromJournal(key Key) {
+	if e.journal == nil {
+		return
+	}
+	if err := e.journal.Delete(key); err != nil {
+		log.Printf("lifecycle: journal delete for %s failed: %v", key, err)
+	}
+}
+
+// NextDue returns the due time of the earliest pending transition.
+func (e *Engine) NextDue() (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run := e.earliestLocked()
+	if run == nil {
+		return time.Time{}, false
+	}
+	return run.due, true
+}
+
+// Advance moves a virtual clock forward by d, running every transition that
+// falls due on the way in order, with the clock set to each one's due time.
+func (e *Engine) Advance(d time.Duration) error {
+	vc, ok := e.clock.(*clock.Virtual)
+	if !ok {
+		return ErrNotVirtual
+	}
+	target := vc.Now().Add(d)
+	for {
+		e.mu.Lock()
+		// Let transitions the scheduler already handed out finish first, so
+		// that everything due has been applied when Advance returns.
+		for e.dispatched+e.running > 0 && e.ctx.Err() == nil {
+			e.idle.Wait()
 		}
+		run := e.earliestLocked()
+		if run == nil || run.due.After(target) {
+			e.mu.Unlock()
+			break
+		}
+		e.unscheduleLocked(run)
+		e.mu.Unlock()
+
+		if gap := run.due.Sub(vc.Now()); gap > 0 {
+			vc.Advance(gap)
+		}
+		e.step(run)
+	}
+	if gap := target.Sub(vc.Now()); gap > 0 {
+		vc.Advance(gap)
+	}
+	e.ClockChanged()
+	return nil
+}
+
+// AdvanceToNext moves a virtual clock to the earliest pending transition and runs it.
+// It reports false if nothing is pending.
+func (e *Engine) AdvanceToNext() (bool, error) {
+	if _, ok := e.clock.(*clock.Virtual); !ok {
+		return false, ErrNotVirtual
+	}
+	due, ok := e.NextDue()
+	if !ok {
+		return false, nil
+	}
+	return true, e.Advance(max(due.Sub(e.clock.Now()), 0))
+}
+
+// ClockChanged must be called after the clock is frozen, unfrozen or moved
+// other than through Advance, so the scheduler re-reads it.
+func (e *Engine) ClockChanged() {
+	e.wakeScheduler()
+	for _, fn := range e.onClock {
+		fn()
+	}
+}
+
+// applied records and announces a status change that has been persisted.
+func (e *Engine) applied(key Key, from, to, trigger string) {
+	t := models.StatusTransition{
+		From:    from,
+		To:      to,
+		At:      e.clock.Now().UTC(),
+		Trigger: trigger,
+	}
+	for _, fn := range e.observers {
+		fn(key.Type, key.Path, t)
+	}
+	e.NotifyStatus(key, to)
+}
+
+// step applies the next transition of run and schedules the one after.
+func (e *Engine) step(run *lifecycleRun) {
+	e.mu.Lock()
+	updater := e.updaters[run.key.Type]
+	stopped := run.stopped
+	from := run.current()
+	newStatus := run.steps[run.next].Status
+	run.stepping = !stopped
+	e.mu.Unlock()
+	if stopped {
+		return
+	}
+	defer func() {
+		e.mu.Lock()
+		run.stepping = false
+		e.idle.Broadcast()
+		e.mu.Unlock()
 	}()
+
+	if updater == nil {
+		log.Printf("lifecycle: no updater for %s, dropping %s", run.key.Type, run.key)
+		e.abandon(run)
+		return
+	}
+	if err := updater(run.key, run.outcome, newStatus); err != nil {
+		log.Printf("lifecycle: failed to update %s to %s: %v", run.key, newStatus, err)
+		e.replan(run, from, newStatus)
+		return
+	}
+	trigger := models.TriggerEngine
+	if newStatus == run.outcome.Status {
+		trigger = models.TriggerRule
+	}
+	e.applied(run.key, from, newStatus, trigger)
+	e.mu.Lock()
+	e.executed++
+	run.next++
+	if run.stopped {
+		e.mu.Unlock()
+		return
+	}
+	if run.next == len(run.steps) {
+		e.mu.Unlock()
+		e.forget(run)
+		return
+	}
+	// Chain due times off each other so timings do not drift with load.
+	run.due = run.due.Add(run.steps[run.next].Delay)
+	if run.holdAt == newStatus {
+		e.holdLocked(run)
+		e.record(run)
+		e.mu.Unlock()
+		return
+	}
+	if e.closed {
+		fastForward := e.policy == ShutdownFastForward
+		e.mu.Unlock()
+		if fastForward {
+			e.step(run)
+		} else if e.journal != nil {
+			// Left in the journal to be resumed after a restart.
+			e.record(run)
+		} else {
+			e.dropped(run.key)
+		}
+		return
+	}
+	e.scheduleLocked(run)
+	e.record(run)
+	e.mu.Unlock()
+}
+
+// replan carries on a lifecycle whose transition from one status to another
+// was rejected, from the status its resource is stored in. That is another
+// status if the resource was moved outside the engine, and the transition is
+// illegal if the state machines changed since it was planned. If neither is
+// the case, or the resource cannot be read or has nowhere left to go, the
+// lifecycle is dropped.
+func (e *Engine) replan(run *lifecycleRun, from, to string) {
+	def := e.defs[run.key.Type]
+	if e.reader == nil || def == nil {
+		e.abandon(run)
+		return
+	}
+	current, err := e.reader(run.key)
+	if err != nil || current == from && def.Allows(from, to) {
+		e.abandon(run)
+		return
+	}
+	var steps []Step
+	if _, ok := def.States[current]; ok {
+		steps = e.plan(def, current, run.outcome)
+	}
+	if len(steps) == 0 {
+		e.abandon(run)
+		return
+	}
+	log.Printf("lifecycle: replanning %s from %s", run.key, current)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if run.stopped {
+		// Force has taken over and reads the status itself.
+		return
+	}
+	run.start, run.steps, run.next = current, steps, 0
+	run.due = e.clock.Now().Add(steps[0].Delay)
+	switch {
+	case run.holdAt == current:
+		e.holdLocked(run)
+	case !e.closed:
+		e.scheduleLocked(run)
+	}
+	e.record(run)
 }
@@ -0,0 +1,388 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/clock"
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// recorder collects transitions in the order they are applied.
+type recorder struct {
+	mu  sync.Mutex
+	got []string
+}
+
+func (r *recorder) update(key Key, _ Outcome, newStatus string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, key.ID()+":"+newStatus)
+	return nil
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.got...)
+}
+
+// statusStore keeps resources' statuses and, like the real store, rejects
+// transitions the engine's state machines do not allow.
+type statusStore struct {
+	mu     sync.Mutex
+	e      *Engine
+	status map[string]string
+}
+
+func newStatusStore(e *Engine) *statusStore {
+	st := &statusStore{e: e, status: make(map[string]string)}
+	e.SetStatusReader(st.read)
+	for resourceType := range DefaultDefinitions() {
+		e.Handle(resourceType, st.update)
+	}
+	return st
+}
+
+func (st *statusStore) set(key Key, status string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.status[key.String()] = status
+}
+
+func (st *statusStore) read(key Key) (string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	status, ok := st.status[key.String()]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return status, nil
+}
+
+func (st *statusStore) update(key Key, _ Outcome, newStatus string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	from := st.status[key.String()]
+	if !st.e.Legal(key.Type, from, newStatus) {
+		return fmt.Errorf("invalid status transition %s -> %s", from, newStatus)
+	}
+	st.status[key.String()] = newStatus
+	return nil
+}
+
+// newFrozenEngine returns an engine on a frozen clock that records every
+// transition in rec.
+func newFrozenEngine(t *testing.T, stepDelayMs int, rec *recorder) (*Engine, *clock.Virtual) {
+	t.Helper()
+	vc := clock.NewVirtual()
+	vc.Set(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	e := NewEngine(context.Background(), stepDelayMs, 2, vc, nil)
+	for resourceType := range DefaultDefinitions() {
+		e.Handle(resourceType, rec.update)
+	}
+	return e, vc
+}
+
+func TestAdvanceRunsTransitionsInDueOrder(t *testing.T) {
+	var rec recorder
+	e, vc := newFrozenEngine(t, 1000, &rec)
+
+	e.StartTransition(NewKey(models.ResourceTypeReturnSubmission, "a"), OutcomeDelivered)
+	vc.Advance(500 * time.Millisecond)
+	e.StartTransition(NewKey(models.ResourceTypePaymentAdmission, "b"), OutcomeDelivered)
+
+	if s := e.Stats(); s.Pending != 2 || s.Overdue != 0 {
+		t.Fatalf("expected 2 pending, 0 overdue, got %+v", s)
+	}
+	if err := e.Advance(2 * time.Second); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	got := rec.list()
+	want := []string{"a:delivery_confirmed", "b:confirmed"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if s := e.Stats(); s.Pending != 0 || s.Executed != 2 {
+		t.Errorf("expected nothing pending and 2 executed, got %+v", s)
+	}
+}
+
+func TestStatsCountsOverdue(t *testing.T) {
+	var rec recorder
+	e, vc := newFrozenEngine(t, 1000, &rec)
+	for _, id := range []string{"a", "b", "c"} {
+		e.StartTransition(NewKey(models.ResourceTypeReturnSubmission, id), OutcomeDelivered)
+	}
+
+	// Moving the clock directly makes everything due without running it
+	// until the scheduler notices.
+	vc.Advance(time.Hour)
+	if s := e.Stats(); s.Overdue+int(s.Executed) != 3 {
+		t.Errorf("expected 3 overdue or executed, got %+v", s)
+	}
+
+	e.ClockChanged()
+	deadline := time.Now().Add(time.Second)
+	for e.Stats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(rec.list()); n != 3 {
+		t.Errorf("expected 3 transitions after waking the scheduler, got %d", n)
+	}
+}
+
+func TestShutdownFastForward(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	e.SetShutdownPolicy(ShutdownFastForward)
+	e.StartTransition(NewKey(models.ResourceTypePaymentSubmission, "a"), OutcomeDelivered)
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	got := rec.list()
+	if len(got) != len(PaymentSubmissionChain)-1 || got[len(got)-1] != "a:delivery_confirmed" {
+		t.Errorf("expected the chain to be fast-forwarded, got %v", got)
+	}
+
+	// New lifecycles are refused after shutdown.
+	e.StartTransition(NewKey(models.ResourceTypePaymentSubmission, "b"), OutcomeDelivered)
+	if s := e.Stats(); s.Pending != 0 {
+		t.Errorf("expected nothing pending after shutdown, got %+v", s)
+	}
+}
+
+func TestShutdownAbandon(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	e.StartTransition(NewKey(models.ResourceTypePaymentSubmission, "a"), OutcomeDelivered)
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := rec.list(); len(got) != 0 {
+		t.Errorf("expected pending transitions to be abandoned, got %v", got)
+	}
+}
+
+func TestOnDrop(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	var mu sync.Mutex
+	var dropped []string
+	e.OnDrop(func(key Key) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped = append(dropped, key.ID())
+	})
+	e.SetStatusReader(func(Key) (string, error) { return models.StatusAccepted, nil })
+	e.Handle(models.ResourceTypePaymentSubmission, func(key Key, outcome Outcome, newStatus string) error {
+		if key.ID() == "a" {
+			return errors.New("store unavailable")
+		}
+		return rec.update(key, outcome, newStatus)
+	})
+
+	e.StartTransition(NewKey(models.ResourceTypePaymentSubmission, "p", "a"), OutcomeDelivered)
+	if _, err := e.AdvanceToNext(); err != nil {
+		t.Fatalf("AdvanceToNext: %v", err)
+	}
+	e.StartTransition(NewKey(models.ResourceTypePaymentSubmission, "p", "b"), OutcomeDelivered)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dropped) != 2 || dropped[0] != "a" || dropped[1] != "b" {
+		t.Errorf("expected a to be dropped on failure and b on shutdown, got %v", dropped)
+	}
+}
+
+func TestForceReplacesPendingLifecycle(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	key := NewKey(models.ResourceTypeReturnSubmission, "a")
+	e.StartTransition(key, OutcomeDelivered)
+
+	accepted := func() (string, error) { return models.StatusAccepted, nil }
+
+	if _, err := e.Force(key, models.StatusAccepted, accepted); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected ErrIllegalTransition, got %v", err)
+	}
+	if previous, err := e.Force(key, models.StatusDeliveryConfirmed, accepted); err != nil || previous != models.StatusAccepted {
+		t.Fatalf("Force: %q, %v", previous, err)
+	}
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if got := rec.list(); len(got) != 1 || got[0] != "a:delivery_confirmed" {
+		t.Errorf("expected only the forced transition, got %v", got)
+	}
+	if s := e.Stats(); s.Pending != 0 {
+		t.Errorf("expected nothing pending, got %+v", s)
+	}
+}
+
+func TestForceKeepsLifecycleWhenUpdateFails(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	e.Handle(models.ResourceTypeReturnSubmission, func(key Key, outcome Outcome, newStatus string) error {
+		if newStatus == models.StatusDeliveryConfirmed {
+			return errors.New("store unavailable")
+		}
+		return rec.update(key, outcome, newStatus)
+	})
+	key := NewKey(models.ResourceTypeReturnSubmission, "a")
+	e.StartTransition(key, OutcomeDelivered)
+
+	accepted := func() (string, error) { return models.StatusAccepted, nil }
+	if _, err := e.Force(key, models.StatusDeliveryConfirmed, accepted); err == nil {
+		t.Fatal("expected the failed update to be reported")
+	}
+	if s := e.Stats(); s.Pending != 1 {
+		t.Fatalf("expected the lifecycle to be kept, got %+v", s)
+	}
+	if err := e.Pause(key, ""); err != nil {
+		t.Errorf("Pause: %v", err)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	var rec recorder
+	e, vc := newFrozenEngine(t, 1000, &rec)
+	a := NewKey(models.ResourceTypePaymentSubmission, "p", "a")
+	b := NewKey(models.ResourceTypePaymentSubmission, "p", "b")
+	e.StartTransitionHeld(a, OutcomeDelivered, models.StatusLimitCheckPassed)
+	e.StartTransition(b, OutcomeDelivered)
+
+	if err := e.Advance(500 * time.Millisecond); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	// Paused half way to its next transition.
+	if err := e.Pause(b, ""); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := e.Pause(b, "no_such_status"); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("expected ErrUnknownStatus, got %v", err)
+	}
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if got := rec.list(); len(got) != 3 || got[2] != "a:limit_check_passed" {
+		t.Fatalf("expected a to stop at limit_check_passed and b not to move, got %v", got)
+	}
+	holds := e.Holds()
+	if len(holds) != 2 || !holds[0].Held || holds[0].Status != models.StatusLimitCheckPassed ||
+		!holds[1].Held || holds[1].Status != models.StatusAccepted {
+		t.Fatalf("unexpected holds %+v", holds)
+	}
+	if s := e.Stats(); s.Held != 2 || s.Pending != 0 {
+		t.Errorf("expected 2 held, 0 pending, got %+v", s)
+	}
+
+	// Resume keeps the half second b had left; release moves a on at once.
+	if err := e.Resume(b); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if err := e.Release(a); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if due, _ := e.NextDue(); !due.Equal(vc.Now()) {
+		t.Errorf("expected released transition due now, got %s", due)
+	}
+	if err := e.Advance(500 * time.Millisecond); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if got := rec.list(); len(got) != 5 || got[3] != "a:released_to_gateway" || got[4] != "b:validation_pending" {
+		t.Errorf("expected a then b to move on, got %v", got)
+	}
+	if err := e.Pause(b, models.StatusAccepted); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("status already passed: expected ErrUnknownStatus, got %v", err)
+	}
+	if err := e.Release(NewKey(models.ResourceTypePaymentSubmission, "p", "missing")); !errors.Is(err, ErrNoLifecycle) {
+		t.Errorf("expected ErrNoLifecycle, got %v", err)
+	}
+}
+
+func TestRejectedStepReplansFromStoredStatus(t *testing.T) {
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "lifecycles.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenFileJournal: %v", err)
+	}
+	defer journal.Close()
+	var rec recorder
+	e, vc := newFrozenEngine(t, 1000, &rec)
+	st := newStatusStore(e)
+	e.SetJournal(journal)
+
+	// Planned by a rule under a machine that let submitted fail; this one
+	// does not, so the second step is rejected.
+	key := NewKey(models.ResourceTypePaymentSubmission, "p", "a")
+	st.set(key, models.StatusQueuedForDelivery)
+	journal.Put(PendingTransition{
+		Key:     key,
+		Outcome: Outcome{Status: models.StatusFailed, SchemeStatusCode: "AM04"},
+		Start:   models.StatusQueuedForDelivery,
+		Steps:   []Step{{Status: models.StatusSubmitted, Delay: time.Second}, {Status: models.StatusFailed, Delay: time.Second}},
+		Due:     vc.Now().Add(time.Second),
+	})
+	if n, err := e.Restore(); err != nil || n != 1 {
+		t.Fatalf("Restore: expected 1 lifecycle, got %d (%v)", n, err)
+	}
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	if got, _ := st.read(key); got != models.StatusDeliveryConfirmed {
+		t.Errorf("expected the lifecycle to carry on to delivery_confirmed, got %s", got)
+	}
+	if s := e.Stats(); s.Pending != 0 {
+		t.Errorf("expected nothing pending, got %+v", s)
+	}
+	if p := journal.Pending(); len(p) != 0 {
+		t.Errorf("expected journal to be empty once finished, got %d entries", len(p))
+	}
+}
+
+func TestPauseInFlightIsJournalled(t *testing.T) {
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "lifecycles.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenFileJournal: %v", err)
+	}
+	defer journal.Close()
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	e.SetJournal(journal)
+	key := NewKey(models.ResourceTypePaymentSubmission, "p", "a")
+	var journalled string
+	e.Handle(models.ResourceTypePaymentSubmission, func(k Key, o Outcome, newStatus string) error {
+		if newStatus == models.StatusValidationPending {
+			if err := e.Pause(k, ""); err != nil {
+				t.Errorf("Pause: %v", err)
+			}
+			if p := journal.Pending(); len(p) == 1 {
+				journalled = p[0].HoldAt
+			}
+		}
+		return rec.update(k, o, newStatus)
+	})
+	e.StartTransition(key, OutcomeDelivered)
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	if journalled != models.StatusValidationPending {
+		t.Errorf("expected the breakpoint to be journalled while in flight, got %q", journalled)
+	}
+	if holds := e.Holds(); len(holds) != 1 || !holds[0].Held || holds[0].Status != models.StatusValidationPending {
+		t.Errorf("expected a hold at validation_pending, got %+v", holds)
+	}
+}
@@ -0,0 +1,176 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// ErrIllegalTransition is returned when a resource is forced into a status
+// its state machine cannot reach.
+var ErrIllegalTransition = errors.New("lifecycle: illegal status transition")
+
+// Legal reports whether a resource of the given type may move directly from
+// one status to another. Types without a state machine are unrestricted.
+func (e *Engine) Legal(resourceType, from, to string) bool {
+	def, ok := e.defs[resourceType]
+	if !ok {
+		return true
+	}
+	return def.Allows(from, to)
+}
+
+// Force moves the resource identified by key from its current status, as
+// read by current, to status straight away, stepping through the shortest
+// legal path so that every intermediate status is persisted and notified as
+// usual. It returns the status the resource was in. Any pending lifecycle
+// of the resource is replaced, along with any hold on it, once the first
+// step is persisted; if that fails the lifecycle carries on as before. If
+// status is not terminal the resource carries on through its state machine
+// from there, keeping the outcome it was started with.
+func (e *Engine) Force(key Key, status string, current func() (string, error)) (string, error) {
+	def, ok := e.defs[key.Type]
+	if !ok {
+		return "", fmt.Errorf("%w: no state machine for %s", ErrIllegalTransition, key.Type)
+	}
+
+	e.mu.Lock()
+	updater := e.updaters[key.Type]
+	if updater == nil {
+		e.mu.Unlock()
+		return "", fmt.Errorf("lifecycle: no updater for %s", key.Type)
+	}
+	// Stop the pending lifecycle and let any transition of it that is being
+	// applied finish, so the status read below stays put.
+	old := e.runs[key.String()]
+	if old != nil {
+		old.stopped = true
+		for old.stepping {
+			e.idle.Wait()
+		}
+		if e.runs[key.String()] != old {
+			old = nil
+		}
+	}
+	previous, err := current()
+	if err != nil {
+		e.reinstateLocked(old)
+		e.mu.Unlock()
+		return "", err
+	}
+	path, ok := def.Path(previous, status)
+	if !ok {
+		e.reinstateLocked(old)
+		e.mu.Unlock()
+		return "", fmt.Errorf("%w: %s cannot move from %s to %s", ErrIllegalTransition, key.Type, previous, status)
+	}
+	outcome := OutcomeDelivered
+	if old != nil {
+		outcome = old.outcome
+	}
+	e.mu.Unlock()
+
+	from := previous
+	for _, s := range path {
+		if err := updater(key, outcome, s); err != nil {
+			e.mu.Lock()
+			if from == previous {
+				e.reinstateLocked(old)
+				e.mu.Unlock()
+				return "", err
+			}
+			// The resource has moved on from where the old lifecycle left it.
+			e.dropLocked(old)
+			e.mu.Unlock()
+			e.removeFromJournal(key)
+			e.dropped(key)
+			return "", err
+		}
+		e.applied(key, from, s, models.TriggerAdmin)
+		from = s
+	}
+
+	steps := e.plan(def, status, outcome)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dropLocked(old)
+	if len(steps) == 0 {
+		e.removeFromJournal(key)
+		return previous, nil
+	}
+	run := &lifecycleRun{
+		key:     key,
+		outcome: outcome,
+		start:   status,
+		steps:   steps,
+		due:     e.clock.Now().Add(steps[0].Delay),
+		index:   -1,
+	}
+	if e.closed {
+		// Left for a restart to pick up, as with any other pending run.
+		e.record(run)
+		return previous, nil
+	}
+	e.runs[key.String()] = run
+	e.scheduleLocked(run)
+	e.record(run)
+	return previous, nil
+}
+
+// reinstateLocked lets a lifecycle stopped by Force carry on. A lifecycle
+// whose last transition was applied while it was stopped is finished off.
+func (e *Engine) reinstateLocked(run *lifecycleRun) {
+	if run == nil {
+		return
+	}
+	run.stopped = false
+	if run.next == len(run.steps) {
+		delete(e.runs, run.key.String())
+		e.removeFromJournal(run.key)
+		return
+	}
+	if !run.held && run.index < 0 && !e.closed {
+		if run.holdAt == run.current() {
+			e.holdLocked(run)
+		} else {
+			e.scheduleLocked(run)
+		}
+	}
+	e.record(run)
+}
+
+// dropLocked discards a lifecycle stopped by Force.
+func (e *Engine) dropLocked(run *lifecycleRun) {
+	if run == nil {
+		return
+	}
+	if run.held {
+		e.held--
+	}
+	e.unscheduleLocked(run)
+	if e.runs[run.key.String()] == run {
+		delete(e.runs, run.key.String())
+	}
+}
+
+// Apply moves the resource identified by key from status from to status to
+// straight away, passing outcome to its updater. It is how machines that are
+// driven by other resources, rather than by time, move on; to must be a
+// transition out of from.
+func (e *Engine) Apply(key Key, from, to string, outcome Outcome) error {
+	if def, ok := e.defs[key.Type]; !ok || !def.Allows(from, to) {
+		return fmt.Errorf("%w: %s cannot move from %s to %s", ErrIllegalTransition, key.Type, from, to)
+	}
+	e.mu.Lock()
+	updater := e.updaters[key.Type]
+	e.mu.Unlock()
+	if updater == nil {
+		return fmt.Errorf("lifecycle: no updater for %s", key.Type)
+	}
+	if err := updater(key, outcome, to); err != nil {
+		return err
+	}
+	e.applied(key, from, to, models.TriggerEngine)
+	return nil
+}
@@ -0,0 +1,172 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoLifecycle is returned when a resource has no lifecycle in progress.
+var ErrNoLifecycle = errors.New("lifecycle: no lifecycle in progress")
+
+// ErrUnknownStatus is returned for a status the resource's state machine
+// does not have.
+var ErrUnknownStatus = errors.New("lifecycle: unknown status")
+
+// Hold describes a lifecycle that is held, or will be held once it reaches
+// a breakpoint.
+type Hold struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Status is the status the resource is held at or, when Held is false,
+	// the breakpoint it will be held at.
+	Status string     `json:"status"`
+	Held   bool       `json:"held"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// HasStatus reports whether the state machine for resourceType has status.
+func (e *Engine) HasStatus(resourceType, status string) bool {
+	def, ok := e.defs[resourceType]
+	if !ok {
+		return false
+	}
+	_, ok = def.States[status]
+	return ok
+}
+
+// Pause holds the lifecycle of key once it reaches status, or straight away
+// if status is empty or the resource's current status. A transition that is
+// already being applied finishes first and the hold starts after it. A
+// status the lifecycle has passed or will not reach is ErrUnknownStatus.
+func (e *Engine) Pause(key Key, status string) error {
+	if status != "" && !e.HasStatus(key.Type, status) {
+		return fmt.Errorf("%w: %s has no status %q", ErrUnknownStatus, key.Type, status)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run, ok := e.runs[key.String()]
+	if !ok {
+		return ErrNoLifecycle
+	}
+	if run.held {
+		return nil
+	}
+	switch {
+	case status == "" || status == run.current():
+		if run.index < 0 {
+			// In flight: hold at the status being applied.
+			run.holdAt = run.steps[run.next].Status
+			break
+		}
+		e.unscheduleLocked(run)
+		e.holdLocked(run)
+	case run.ahead(status):
+		run.holdAt = status
+	default:
+		return fmt.Errorf("%w: %s %s will not reach %q", ErrUnknownStatus, key.Type, key.ID(), status)
+	}
+	e.record(run)
+	return nil
+}
+
+// Resume lets a held lifecycle carry on, with whatever time was left until
+// its next transition when it was held. A breakpoint that has not been
+// reached yet is cleared.
+func (e *Engine) Resume(key Key) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run, ok := e.runs[key.String()]
+	if !ok {
+		return ErrNoLifecycle
+	}
+	e.unholdLocked(run, e.clock.Now().Add(run.remaining))
+	return nil
+}
+
+// Release clears any hold or breakpoint on the lifecycle of key. A held
+// lifecycle moves on to its next transition immediately.
+func (e *Engine) Release(key Key) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run, ok := e.runs[key.String()]
+	if !ok {
+		return ErrNoLifecycle
+	}
+	e.unholdLocked(run, e.clock.Now())
+	return nil
+}
+
+// Holds lists held lifecycles and breakpoints that are yet to be reached.
+func (e *Engine) Holds() []Hold {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []Hold
+	for _, run := range e.runs {
+		switch {
+		case run.held:
+			since := run.heldAt
+			out = append(out, Hold{
+				Type:   run.key.Type,
+				ID:     run.key.ID(),
+				Status: run.current(),
+				Held:   true,
+				Since:  &since,
+			})
+		case run.holdAt != "":
+			out = append(out, Hold{Type: run.key.Type, ID: run.key.ID(), Status: run.holdAt})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// holdLocked parks a run that is not queued.
+func (e *Engine) holdLocked(run *lifecycleRun) {
+	now := e.clock.Now()
+	run.held = true
+	run.holdAt = ""
+	run.heldAt = now
+	run.remaining = max(run.due.Sub(now), 0)
+	e.held++
+}
+
+// unholdLocked clears run's breakpoint and, if it is held, schedules its next
+// transition at due.
+func (e *Engine) unholdLocked(run *lifecycleRun, due time.Time) {
+	run.holdAt = ""
+	if run.held {
+		run.held = false
+		run.remaining = 0
+		run.due = due
+		e.held--
+		if !e.closed {
+			e.scheduleLocked(run)
+		}
+	}
+	e.record(run)
+}
+
+// ahead reports whether status is still to be applied by run.
+func (run *lifecycleRun) ahead(status string) bool {
+	for _, s := range run.steps[run.next:] {
+		if s.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the last status applied by run.
+func (run *lifecycleRun) current() string {
+	if run.next == 0 {
+		return run.start
+	}
+	return run.steps[run.next-1].Status
+}
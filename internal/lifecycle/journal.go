@@ -0,0 +1,198 @@
+package lifecycle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key identifies a resource by its type and the IDs on its path, outermost
+// first, e.g. payment ID then submission ID.
+type Key struct {
+	Type string   `json:"type"`
+	Path []string `json:"path"`
+}
+
+// NewKey builds a Key.
+func NewKey(resourceType string, path ...string) Key {
+	return Key{Type: resourceType, Path: path}
+}
+
+// ID returns the resource's own ID.
+func (k Key) ID() string {
+	if len(k.Path) == 0 {
+		return ""
+	}
+	return k.Path[len(k.Path)-1]
+}
+
+// String returns a unique representation of the key.
+func (k Key) String() string {
+	return k.Type + "/" + strings.Join(k.Path, "/")
+}
+
+// PendingTransition is the durable form of a lifecycle that has not finished.
+type PendingTransition struct {
+	Key     Key       `json:"key"`
+	Outcome Outcome   `json:"outcome"`
+	Start   string    `json:"start"`
+	Steps   []Step    `json:"steps"`
+	Next    int       `json:"next"`
+	Due     time.Time `json:"due"`
+	// Breakpoint state, see Engine.Pause.
+	HoldAt    string        `json:"hold_at,omitempty"`
+	Held      bool          `json:"held,omitempty"`
+	Remaining time.Duration `json:"remaining,omitempty"`
+}
+
+// Journal records pending transitions so they can be resumed after a restart.
+type Journal interface {
+	Put(p PendingTransition) error
+	Delete(k Key) error
+	Pending() []PendingTransition
+}
+
+// compactAt is how many entries the journal file may grow to, with more than
+// half of them stale, before it is rewritten with only the live ones.
+const compactAt = 1000
+
+// FileJournal is an append-only JSON lines Journal. Every change is written
+// straight to the file; the log is compacted each time it is opened and once
+// it has grown past compactAt entries.
+type FileJournal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries int // in the file
+	pending map[string]PendingTransition
+}
+
+type journalEntry struct {
+	Op      string             `json:"op"`
+	Key     Key                `json:"key"`
+	Pending *PendingTransition `json:"pending,omitempty"`
+}
+
+// OpenFileJournal replays and compacts the journal at path, creating it if needed.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	pending := make(map[string]PendingTransition)
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; sc.Scan(); line++ {
+			var e journalEntry
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("journal %s line %d: %w", path, line, err)
+			}
+			switch {
+			case e.Op == "put" && e.Pending != nil:
+				pending[e.Key.String()] = *e.Pending
+			case e.Op == "delete":
+				delete(pending, e.Key.String())
+			}
+		}
+		err := sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("journal %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	j := &FileJournal{path: path, pending: pending}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// compact rewrites the journal file with only the live entries and reopens
+// it for appending. It must be called with j.mu held.
+func (j *FileJournal) compact() error {
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, p := range j.pending {
+		if err := enc.Encode(journalEntry{Op: "put", Key: p.Key, Pending: &p}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	j.entries = len(j.pending)
+	return nil
+}
+
+// Put records or replaces the pending transition for p.Key.
+func (j *FileJournal) Put(p PendingTransition) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pending[p.Key.String()] = p
+	return j.append(journalEntry{Op: "put", Key: p.Key, Pending: &p})
+}
+
+// Delete forgets the pending transition for k.
+func (j *FileJournal) Delete(k Key) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.pending[k.String()]; !ok {
+		return nil
+	}
+	delete(j.pending, k.String())
+	return j.append(journalEntry{Op: "delete", Key: k})
+}
+
+// Pending returns every recorded pending transition.
+func (j *FileJournal) Pending() []PendingTransition {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]PendingTransition, 0, len(j.pending))
+	for _, p := range j.pending {
+		out = append(out, p)
+	}
+	return out
+}
+
+// Close closes the journal file.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+func (j *FileJournal) append(e journalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	j.entries++
+	if j.entries >= compactAt && j.entries > 2*len(j.pending) {
+		return j.compact()
+	}
+	return nil
+}
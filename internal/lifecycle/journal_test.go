@@ -0,0 +1,161 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+func TestRestoreFromJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lifecycles.jsonl")
+	key := NewKey(models.ResourceTypePaymentSubmission, "p1", "s1")
+	outcome := Outcome{Status: models.StatusFailed, At: models.StatusLimitCheckPending, SchemeStatusCode: "AM04"}
+
+	// First run: one transition, then shut down leaving the rest pending.
+	j1, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("OpenFileJournal: %v", err)
+	}
+	var first recorder
+	e1, _ := newFrozenEngine(t, 1000, &first)
+	e1.SetJournal(j1)
+	e1.StartTransition(key, outcome)
+	if _, err := e1.AdvanceToNext(); err != nil {
+		t.Fatalf("AdvanceToNext: %v", err)
+	}
+	if err := e1.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	j1.Close()
+
+	// Second run: the remaining transitions, with the original outcome.
+	j2, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer j2.Close()
+	var second recorder
+	var gotOutcome Outcome
+	e2, _ := newFrozenEngine(t, 1000, &second)
+	e2.Handle(models.ResourceTypePaymentSubmission, func(k Key, o Outcome, newStatus string) error {
+		gotOutcome = o
+		return second.update(k, o, newStatus)
+	})
+	e2.SetJournal(j2)
+	n, err := e2.Restore()
+	if err != nil || n != 1 {
+		t.Fatalf("Restore: expected 1 lifecycle, got %d (%v)", n, err)
+	}
+	if err := e2.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	if got := first.list(); len(got) != 1 || got[0] != "s1:validation_pending" {
+		t.Errorf("first run: expected [s1:validation_pending], got %v", got)
+	}
+	if got := second.list(); len(got) != 2 || got[0] != "s1:limit_check_pending" || got[1] != "s1:failed" {
+		t.Errorf("second run: expected limit_check_pending then failed, got %v", got)
+	}
+	if gotOutcome != outcome {
+		t.Errorf("expected outcome %+v to survive, got %+v", outcome, gotOutcome)
+	}
+	if p := j2.Pending(); len(p) != 0 {
+		t.Errorf("expected journal to be empty once finished, got %d entries", len(p))
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lifecycles.jsonl")
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("OpenFileJournal: %v", err)
+	}
+	defer j.Close()
+	live := NewKey(models.ResourceTypePaymentSubmission, "p1", "live")
+	j.Put(PendingTransition{Key: live})
+	for i := range compactAt {
+		key := NewKey(models.ResourceTypePaymentSubmission, "p1", fmt.Sprintf("s%d", i))
+		j.Put(PendingTransition{Key: key})
+		j.Delete(key)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines >= compactAt {
+		t.Errorf("expected the journal to be compacted, it has %d entries", lines)
+	}
+	if p := j.Pending(); len(p) != 1 || p[0].Key.String() != live.String() {
+		t.Errorf("expected only the live entry to be left, got %+v", p)
+	}
+}
+
+// stuckJournal holds pending transitions it cannot delete.
+type stuckJournal []PendingTransition
+
+func (j stuckJournal) Put(PendingTransition) error  { return nil }
+func (j stuckJournal) Delete(Key) error             { return errors.New("read-only journal") }
+func (j stuckJournal) Pending() []PendingTransition { return j }
+
+func TestRestoreFailsWhenJournalCannotBeCleaned(t *testing.T) {
+	var rec recorder
+	e, _ := newFrozenEngine(t, 1000, &rec)
+	e.SetJournal(stuckJournal{{Key: NewKey("no_such_type", "x")}})
+	if _, err := e.Restore(); err == nil {
+		t.Error("expected an error for an entry that can neither be restored nor dropped")
+	}
+}
+
+func TestRestoreFollowsStoredStatus(t *testing.T) {
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "lifecycles.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenFileJournal: %v", err)
+	}
+	defer journal.Close()
+	var rec recorder
+	e, vc := newFrozenEngine(t, 1000, &rec)
+	st := newStatusStore(e)
+	e.SetJournal(journal)
+
+	def := DefaultDefinitions()[models.ResourceTypePaymentSubmission]
+	steps := def.Plan(OutcomeDelivered, time.Second, constRandom(0.99))
+	pending := func(key Key, next int) PendingTransition {
+		return PendingTransition{Key: key, Start: def.Initial, Steps: steps, Next: next, Due: vc.Now().Add(time.Second)}
+	}
+	// The store snapshot is older than the journal for behind, newer for
+	// ahead, and predates gone altogether.
+	behind := NewKey(models.ResourceTypePaymentSubmission, "p", "behind")
+	ahead := NewKey(models.ResourceTypePaymentSubmission, "p", "ahead")
+	gone := NewKey(models.ResourceTypePaymentSubmission, "p", "gone")
+	st.set(behind, models.StatusValidationPending)
+	st.set(ahead, models.StatusSubmitted)
+	journal.Put(pending(behind, 3))
+	journal.Put(pending(ahead, 1))
+	journal.Put(pending(gone, 1))
+
+	if n, err := e.Restore(); err != nil || n != 2 {
+		t.Fatalf("Restore: expected 2 lifecycles, got %d (%v)", n, err)
+	}
+	if p := journal.Pending(); len(p) != 2 {
+		t.Errorf("expected the missing resource to be dropped from the journal, got %d entries", len(p))
+	}
+	if err := e.Advance(time.Minute); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	for _, key := range []Key{behind, ahead} {
+		if got, _ := st.read(key); got != models.StatusDeliveryConfirmed {
+			t.Errorf("%s: expected delivery_confirmed, got %s", key.ID(), got)
+		}
+	}
+	if s := e.Stats(); s.Executed != 7 {
+		t.Errorf("expected 6 steps for behind and 1 for ahead, got %+v", s)
+	}
+}
@@ -0,0 +1,433 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// Definition is a declarative state machine for one resource type.
+type Definition struct {
+	Initial string           `json:"initial"`
+	States  map[string]State `json:"states"`
+	// Delays overrides the engine's step delay for the machine's transitions.
+	Delays *DelayProfile `json:"delays,omitempty"`
+}
+
+// State is a node in a Definition.
+type State struct {
+	Terminal bool `json:"terminal,omitempty"`
+	// Manual marks a state that lifecycles stop at. Resources only leave it
+	// when something outside the machine moves them on, e.g. Engine.Apply.
+	Manual      bool         `json:"manual,omitempty"`
+	Transitions []Transition `json:"transitions,omitempty"`
+}
+
+// Transition is an edge between two states.
+type Transition struct {
+	To string `json:"to"`
+	// DelayMs overrides the engine's step delay for this transition.
+	DelayMs *int `json:"delay_ms,omitempty"`
+	// Probability is the chance of taking this branch. Branches without a
+	// probability share whatever is left over equally. An explicit zero keeps
+	// the transition legal without ever choosing it at random.
+	Probability *float64 `json:"probability,omitempty"`
+}
+
+// Definitions maps resource types to their state machines.
+type Definitions map[string]*Definition
+
+// Step is one planned transition of a lifecycle.
+type Step struct {
+	Status string        `json:"status"`
+	Delay  time.Duration `json:"delay"`
+}
+
+// LoadDefinitions reads a JSON file of the form
+//
+//	{"machines": {"<resource type>": Definition}, "delays": {"<resource type>": DelayProfile}}
+//
+// Machines in the file replace the defaults for their resource type. Delay
+// profiles apply to the machine of their resource type, whether it is a
+// default or comes from the file.
+func LoadDefinitions(filename string) (Definitions, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Machines Definitions              `json:"machines"`
+		Delays   map[string]*DelayProfile `json:"delays"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	defs := DefaultDefinitions()
+	for resourceType, d := range file.Machines {
+		defs[resourceType] = d
+	}
+	for resourceType, p := range file.Delays {
+		d, ok := defs[resourceType]
+		if !ok || d == nil {
+			return nil, fmt.Errorf("%s: delays for unknown machine %s", filename, resourceType)
+		}
+		d.Delays = p
+	}
+	if err := defs.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return defs, nil
+}
+
+// DefaultDefinitions returns the built-in state machines.
+func DefaultDefinitions() Definitions {
+	submission := linearDefinition(PaymentSubmissionChain)
+	for _, from := range []string{models.StatusValidationPending, models.StatusLimitCheckPending} {
+		submission.addTransition(from, models.StatusFailed, 0)
+	}
+	submission.addTransition(models.StatusSubmitted, models.StatusDeliveryFailed, 0)
+
+	// Admissions with tasks wait in pending_tasks until the tasks are done.
+	admission := linearDefinition(AdmissionChain)
+	admission.addTransition(models.StatusPending, models.StatusFailed, 0)
+	admission.addTransition(models.StatusPending, models.StatusPendingTasks, 0)
+	admission.States[models.StatusPendingTasks] = State{Manual: true}
+	admission.addTransition(models.StatusPendingTasks, models.StatusConfirmed, 0)
+	admission.addTransition(models.StatusPendingTasks, models.StatusFailed, 0)
+
+	// Returns, recalls and reversals are not timed: Engine.Apply moves them
+	// on in response to their children.
+	exception := func() *Definition {
+		d := linearDefinition(ExceptionChain)
+		d.addTransition(models.StatusSubmitted, models.StatusFailed, 0)
+		return d.manual()
+	}
+	recall := linearDefinition(RecallChain)
+	recall.addTransition(models.StatusPending, models.StatusFailed, 0)
+	recall.addTransition(models.StatusAwaitingDecision, models.StatusRejected, 0)
+	recall.manual()
+
+	return Definitions{
+		models.ResourceTypePaymentSubmission:        submission,
+		models.ResourceTypePaymentAdmission:         admission,
+		models.ResourceTypeReturnSubmission:         linearDefinition(SimpleSubmissionChain),
+		models.ResourceTypeRecallSubmission:         linearDefinition(SimpleSubmissionChain),
+		models.ResourceTypeRecallDecisionSubmission: linearDefinition(SimpleSubmissionChain),
+		models.ResourceTypeReversalSubmission:       linearDefinition(SimpleSubmissionChain),
+		models.ResourceTypeReturnPayment:            exception(),
+		models.ResourceTypeRecall:                   recall,
+		models.ResourceTypeReversal:                 exception(),
+	}
+}
+
+func linearDefinition(chain StatusChain) *Definition {
+	d := &Definition{Initial: chain[0], States: make(map[string]State, len(chain))}
+	for i, s := range chain {
+		if i == len(chain)-1 {
+			d.States[s] = State{Terminal: true}
+			continue
+		}
+		d.States[s] = State{Transitions: []Transition{{To: chain[i+1]}}}
+	}
+	return d
+}
+
+// addTransition adds a from -> to edge with the given probability, creating
+// to as a terminal state if it does not exist.
+func (d *Definition) addTransition(from, to string, probability float64) {
+	st := d.States[from]
+	st.Transitions = append(st.Transitions, Transition{To: to, Probability: &probability})
+	d.States[from] = st
+	if _, ok := d.States[to]; !ok {
+		d.States[to] = State{Terminal: true}
+	}
+}
+
+// manual marks every non-terminal state of d as manual.
+func (d *Definition) manual() *Definition {
+	for name, st := range d.States {
+		if !st.Terminal {
+			st.Manual = true
+			d.States[name] = st
+		}
+	}
+	return d
+}
+
+// Validate checks every definition.
+func (defs Definitions) Validate() error {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := defs[name].Validate(); err != nil {
+			return fmt.Errorf("machine %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the machine is well formed: every transition targets
+// a known state, every state is reachable from the initial state, terminal
+// states have no transitions, non-terminal states have at least one, branch
+// probabilities add up, and there are no cycles.
+func (d *Definition) Validate() error {
+	if d == nil {
+		return fmt.Errorf("definition is empty")
+	}
+	if _, ok := d.States[d.Initial]; !ok {
+		return fmt.Errorf("initial state %q is not defined", d.Initial)
+	}
+
+	hasTerminal := false
+	for name, st := range d.States {
+		if st.Terminal {
+			hasTerminal = true
+			if len(st.Transitions) > 0 {
+				return fmt.Errorf("terminal state %q has transitions", name)
+			}
+			if st.Manual {
+				return fmt.Errorf("terminal state %q is manual", name)
+			}
+			continue
+		}
+		if len(st.Transitions) == 0 {
+			return fmt.Errorf("state %q has no transitions and is not terminal", name)
+		}
+		total := 0.0
+		for _, t := range st.Transitions {
+			if _, ok := d.States[t.To]; !ok {
+				return fmt.Errorf("state %q transitions to undefined state %q", name, t.To)
+			}
+			if t.Probability != nil {
+				if *t.Probability < 0 {
+					return fmt.Errorf("state %q: negative probability to %q", name, t.To)
+				}
+				total += *t.Probability
+			}
+			if t.DelayMs != nil && *t.DelayMs < 0 {
+				return fmt.Errorf("state %q: negative delay to %q", name, t.To)
+			}
+		}
+		if total > 1.000001 {
+			return fmt.Errorf("state %q: branch probabilities sum to %.3f", name, total)
+		}
+	}
+	if !hasTerminal {
+		return fmt.Errorf("no terminal states")
+	}
+	if d.Delays != nil {
+		if err := d.Delays.Validate(d); err != nil {
+			return fmt.Errorf("delays: %w", err)
+		}
+	}
+
+	// Reachability from the initial state.
+	seen := map[string]bool{d.Initial: true}
+	queue := []string{d.Initial}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, t := range d.States[cur].Transitions {
+			if !seen[t.To] {
+				seen[t.To] = true
+				queue = append(queue, t.To)
+			}
+		}
+	}
+	for name := range d.States {
+		if !seen[name] {
+			return fmt.Errorf("state %q is unreachable", name)
+		}
+	}
+
+	// Cycle detection.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	color := make(map[string]int, len(d.States))
+	var visit func(string) error
+	visit = func(s string) error {
+		color[s] = visiting
+		for _, t := range d.States[s].Transitions {
+			switch color[t.To] {
+			case visiting:
+				return fmt.Errorf("cycle through %q -> %q", s, t.To)
+			case 0:
+				if err := visit(t.To); err != nil {
+					return err
+				}
+			}
+		}
+		color[s] = done
+		return nil
+	}
+	return visit(d.Initial)
+}
+
+// ValidateOutcome checks that the machine can end a lifecycle with o. The
+// status must be a terminal state. With o.At it must be a transition out of
+// o.At; without, it replaces the terminal status, so every state the machine
+// can leave for a terminal state must have a transition to it.
+func (d *Definition) ValidateOutcome(o Outcome) error {
+	st, ok := d.States[o.Status]
+	if !ok {
+		return fmt.Errorf("status %q is not defined", o.Status)
+	}
+	if !st.Terminal {
+		return fmt.Errorf("status %q is not terminal", o.Status)
+	}
+	if o.At != "" {
+		st, ok = d.States[o.At]
+		if !ok {
+			return fmt.Errorf("at %q is not defined", o.At)
+		}
+		if st.Manual || !d.Allows(o.At, o.Status) {
+			return fmt.Errorf("no transition from %q to %q", o.At, o.Status)
+		}
+		return nil
+	}
+	names := make([]string, 0, len(d.States))
+	for name := range d.States {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := d.States[name]
+		if st.Terminal || st.Manual {
+			continue
+		}
+		for _, t := range st.Transitions {
+			if t.Probability != nil && *t.Probability <= 0 || !d.States[t.To].Terminal {
+				continue
+			}
+			if !d.Allows(name, o.Status) {
+				return fmt.Errorf("no transition from %q to %q", name, o.Status)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// Plan walks the machine from its initial state and returns the transitions
+// to perform. Branches are chosen and delays drawn with r.
+// A failure outcome diverts the walk to o.Status after o.At, or in place of
+// the terminal state when o.At is empty or never reached. Diversions the
+// machine has no transition for are not taken.
+func (d *Definition) Plan(o Outcome, defaultDelay time.Duration, r Random) []Step {
+	return d.planFrom(d.Initial, o, defaultDelay, r)
+}
+
+// planFrom is Plan starting from state cur instead of the initial state.
+func (d *Definition) planFrom(cur string, o Outcome, defaultDelay time.Duration, r Random) []Step {
+	var steps []Step
+	for !d.States[cur].Terminal && !d.States[cur].Manual {
+		t := d.choose(cur, r.Float64())
+		if o.Status != "" && (cur == o.At || d.States[t.To].Terminal) {
+			if t, ok := d.transition(cur, o.Status); ok {
+				steps = append(steps, Step{Status: o.Status, Delay: d.delay(t, defaultDelay, r)})
+				break
+			}
+		}
+		steps = append(steps, Step{Status: t.To, Delay: d.delay(t, defaultDelay, r)})
+		cur = t.To
+	}
+	return steps
+}
+
+// Allows reports whether the machine has a transition from one state to another.
+func (d *Definition) Allows(from, to string) bool {
+	for _, t := range d.States[from].Transitions {
+		if t.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the shortest run of states leading from one state to another,
+// excluding from itself. It reports false if to cannot be reached.
+func (d *Definition) Path(from, to string) ([]string, bool) {
+	if _, ok := d.States[from]; !ok || from == to {
+		return nil, false
+	}
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, t := range d.States[cur].Transitions {
+			if _, seen := prev[t.To]; seen {
+				continue
+			}
+			prev[t.To] = cur
+			if t.To == to {
+				var path []string
+				for s := to; s != from; s = prev[s] {
+					path = append([]string{s}, path...)
+				}
+				return path, true
+			}
+			queue = append(queue, t.To)
+		}
+	}
+	return nil, false
+}
+
+// choose picks a transition out of state s for the random value r.
+func (d *Definition) choose(s string, r float64) Transition {
+	ts := d.States[s].Transitions
+	assigned, unassigned := 0.0, 0
+	for _, t := range ts {
+		if t.Probability != nil {
+			assigned += *t.Probability
+		} else {
+			unassigned++
+		}
+	}
+	share := 0.0
+	if unassigned > 0 {
+		share = (1 - assigned) / float64(unassigned)
+	}
+	// Scale so the probabilities always cover the whole range.
+	total := assigned + share*float64(unassigned)
+	if total <= 0 {
+		return ts[0]
+	}
+	r *= total
+	var last Transition
+	for _, t := range ts {
+		p := share
+		if t.Probability != nil {
+			p = *t.Probability
+		}
+		if p <= 0 {
+			continue
+		}
+		if r < p {
+			return t
+		}
+		r -= p
+		last = t
+	}
+	// Only reachable through floating point rounding.
+	return last
+}
+
+// transition returns the from -> to edge, reporting false if the machine has none.
+func (d *Definition) transition(from, to string) (Transition, bool) {
+	for _, t := range d.States[from].Transitions {
+		if t.To == to {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
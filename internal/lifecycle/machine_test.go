@@ -0,0 +1,207 @@
+package lifecycle
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// constRandom always draws the same value, and the mean from NormFloat64.
+type constRandom float64
+
+func (r constRandom) Float64() float64     { return float64(r) }
+func (r constRandom) NormFloat64() float64 { return 0 }
+
+func statuses(steps []Step) []string {
+	out := make([]string, len(steps))
+	for i, s := range steps {
+		out[i] = s.Status
+	}
+	return out
+}
+
+func TestDefaultDefinitionsValid(t *testing.T) {
+	if err := DefaultDefinitions().Validate(); err != nil {
+		t.Fatalf("default definitions invalid: %v", err)
+	}
+}
+
+func TestPlanHappyPath(t *testing.T) {
+	def := DefaultDefinitions()[models.ResourceTypePaymentSubmission]
+	got := statuses(def.Plan(OutcomeDelivered, time.Millisecond, constRandom(0.99)))
+	want := strings.Join(PaymentSubmissionChain[1:], ",")
+	if strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestPlanWithOutcome(t *testing.T) {
+	def := DefaultDefinitions()[models.ResourceTypePaymentSubmission]
+	pick := constRandom(0)
+
+	got := statuses(def.Plan(Outcome{Status: models.StatusFailed, At: models.StatusLimitCheckPending}, 0, pick))
+	if want := "validation_pending,limit_check_pending,failed"; strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	got = statuses(def.Plan(Outcome{Status: models.StatusDeliveryFailed}, 0, pick))
+	if len(got) != len(PaymentSubmissionChain)-1 || got[len(got)-1] != models.StatusDeliveryFailed {
+		t.Errorf("expected delivery_failed to replace the terminal status, got %v", got)
+	}
+
+	// The machine has no submitted -> failed transition to divert through.
+	got = statuses(def.Plan(Outcome{Status: models.StatusFailed}, 0, pick))
+	if want := strings.Join(PaymentSubmissionChain[1:], ","); strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestPlanBranchesAndDelays(t *testing.T) {
+	defs, err := LoadDefinitions(writeFile(t, `{"machines": {"payment_admissions": {
+	  "initial": "pending",
+	  "states": {
+	    "pending": {"transitions": [
+	      {"to": "confirmed", "probability": 0.75, "delay_ms": 5},
+	      {"to": "failed", "delay_ms": 7}
+	    ]},
+	    "confirmed": {"terminal": true},
+	    "failed": {"terminal": true}
+	  }}}}`))
+	if err != nil {
+		t.Fatalf("LoadDefinitions: %v", err)
+	}
+	def := defs[models.ResourceTypePaymentAdmission]
+
+	steps := def.Plan(OutcomeDelivered, time.Second, constRandom(0.5))
+	if len(steps) != 1 || steps[0].Status != "confirmed" || steps[0].Delay != 5*time.Millisecond {
+		t.Errorf("expected confirmed after 5ms, got %+v", steps)
+	}
+	steps = def.Plan(OutcomeDelivered, time.Second, constRandom(0.8))
+	if len(steps) != 1 || steps[0].Status != "failed" || steps[0].Delay != 7*time.Millisecond {
+		t.Errorf("expected failed after 7ms, got %+v", steps)
+	}
+	if _, ok := defs[models.ResourceTypePaymentSubmission]; !ok {
+		t.Error("expected defaults to be kept for machines not in the file")
+	}
+}
+
+func TestDefinitionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		def  *Definition
+		want string
+	}{
+		{"missing initial", &Definition{Initial: "x", States: map[string]State{"a": {Terminal: true}}}, "initial"},
+		{"undefined target", &Definition{Initial: "a", States: map[string]State{
+			"a": {Transitions: []Transition{{To: "b"}}},
+		}}, "undefined"},
+		{"no terminal", &Definition{Initial: "a", States: map[string]State{
+			"a": {Transitions: []Transition{{To: "b"}}},
+			"b": {Transitions: []Transition{{To: "a"}}},
+		}}, "no terminal"},
+		{"unreachable", &Definition{Initial: "a", States: map[string]State{
+			"a": {Transitions: []Transition{{To: "b"}}},
+			"b": {Terminal: true},
+			"c": {Terminal: true},
+		}}, "unreachable"},
+		{"cycle", &Definition{Initial: "a", States: map[string]State{
+			"a": {Transitions: []Transition{{To: "b"}}},
+			"b": {Transitions: []Transition{{To: "a"}, {To: "c"}}},
+			"c": {Terminal: true},
+		}}, "cycle"},
+		{"dead end", &Definition{Initial: "a", States: map[string]State{
+			"a": {Transitions: []Transition{{To: "b"}, {To: "c"}}},
+			"b": {},
+			"c": {Terminal: true},
+		}}, "not terminal"},
+	}
+	for _, tt := range tests {
+		err := tt.def.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	d := DefaultDefinitions()[models.ResourceTypePaymentSubmission]
+
+	path, ok := d.Path(models.StatusAccepted, models.StatusLimitCheckPassed)
+	want := []string{models.StatusValidationPending, models.StatusLimitCheckPending, models.StatusLimitCheckPassed}
+	if !ok || !slices.Equal(path, want) {
+		t.Errorf("expected %v, got %v (%v)", want, path, ok)
+	}
+	if path, ok := d.Path(models.StatusValidationPending, models.StatusFailed); !ok || len(path) != 1 {
+		t.Errorf("expected direct path to failed, got %v (%v)", path, ok)
+	}
+	if _, ok := d.Path(models.StatusSubmitted, models.StatusAccepted); ok {
+		t.Error("expected no path backwards")
+	}
+	if !d.Allows(models.StatusSubmitted, models.StatusDeliveryFailed) {
+		t.Error("expected zero-probability branch to be allowed")
+	}
+	if d.Allows(models.StatusAccepted, models.StatusSubmitted) {
+		t.Error("expected skipping states to be disallowed")
+	}
+}
+
+func TestDelayProfiles(t *testing.T) {
+	defs, err := LoadDefinitions(writeFile(t, `{"delays": {"payment_submissions": {
+	  "default": {"kind": "fixed", "ms": 10},
+	  "steps": {
+	    "validation_pending": {"kind": "uniform", "min_ms": 100, "max_ms": 200},
+	    "limit_check_pending": {"kind": "normal", "mean_ms": 50, "stddev_ms": 5},
+	    "delivery_confirmed": {"kind": "lognormal", "median_ms": 1000, "sigma": 1}
+	  }}}}`))
+	if err != nil {
+		t.Fatalf("LoadDefinitions: %v", err)
+	}
+	steps := defs[models.ResourceTypePaymentSubmission].Plan(OutcomeDelivered, time.Second, constRandom(0.5))
+	want := map[string]time.Duration{
+		models.StatusValidationPending: 150 * time.Millisecond,
+		models.StatusLimitCheckPending: 50 * time.Millisecond,
+		models.StatusLimitCheckPassed:  10 * time.Millisecond,
+		models.StatusDeliveryConfirmed: time.Second,
+	}
+	for _, s := range steps {
+		if d, ok := want[s.Status]; ok && s.Delay != d {
+			t.Errorf("%s: expected %s, got %s", s.Status, d, s.Delay)
+		}
+	}
+	// Machines without a profile keep the engine's delay.
+	steps = defs[models.ResourceTypePaymentAdmission].Plan(OutcomeDelivered, time.Second, constRandom(0.5))
+	if steps[0].Delay != time.Second {
+		t.Errorf("expected admissions to keep the default delay, got %s", steps[0].Delay)
+	}
+
+	// Seeded sources give the same long-tail draws every time.
+	d := &Distribution{Kind: DistributionLogNormal, MedianMs: 200, Sigma: 1.5, MaxMs: 60000}
+	a, b := rand.New(rand.NewPCG(7, 7)), rand.New(rand.NewPCG(7, 7))
+	for i := 0; i < 100; i++ {
+		x, y := d.Sample(a), d.Sample(b)
+		if x != y {
+			t.Fatalf("draw %d: %s != %s with the same seed", i, x, y)
+		}
+		if x < 0 || x > time.Minute {
+			t.Fatalf("draw %d: %s outside [0, max_ms]", i, x)
+		}
+	}
+}
+
+func TestDelayProfileValidation(t *testing.T) {
+	tests := map[string]string{
+		"unknown kind":    `{"delays": {"payment_admissions": {"default": {"kind": "poisson"}}}}`,
+		"unknown state":   `{"delays": {"payment_admissions": {"steps": {"nowhere": {"kind": "fixed"}}}}}`,
+		"unknown machine": `{"delays": {"widgets": {"default": {"kind": "fixed"}}}}`,
+		"uniform no max":  `{"delays": {"payment_admissions": {"default": {"kind": "uniform", "min_ms": 5}}}}`,
+	}
+	for name, body := range tests {
+		if _, err := LoadDefinitions(writeFile(t, body)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
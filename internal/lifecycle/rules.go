@@ -0,0 +1,210 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// Rule maps a set of payment attribute patterns to a lifecycle outcome.
+type Rule struct {
+	Name    string            `json:"name,omitempty"`
+	Match   map[string]string `json:"match"`
+	Outcome Outcome           `json:"outcome"`
+}
+
+// TaskRule maps a set of payment attribute patterns to the tasks an
+// admission of the payment must wait for.
+type TaskRule struct {
+	Name  string            `json:"name,omitempty"`
+	Match map[string]string `json:"match"`
+	Tasks []string          `json:"tasks"`
+}
+
+// RuleSet is an ordered list of scenario rules, plus an ordered list of
+// admission task rules. In each list the first matching rule wins.
+type RuleSet struct {
+	Rules          []Rule     `json:"rules"`
+	AdmissionTasks []TaskRule `json:"admission_tasks,omitempty"`
+}
+
+// fieldAliases are shorthand names accepted in rule matches.
+var fieldAliases = map[string]string{
+	"scheme":         "payment_scheme",
+	"sort_code":      "beneficiary_party.sort_code",
+	"account_number": "beneficiary_party.account_number",
+	"account_name":   "beneficiary_party.account_name",
+}
+
+// LoadRules reads a JSON rule file such as:
+//
+//	{"rules": [
+//	  {"match": {"amount": "666.66"}, "outcome": {"status": "failed", "at": "limit_check_pending"}},
+//	  {"match": {"reference": "REJECT-*"}, "outcome": {"status": "delivery_failed", "scheme_status_code": "AC01"}}
+//	],
+//	 "admission_tasks": [
+//	  {"match": {"amount": "5000.00"}, "tasks": ["manual_review"]}
+//	]}
+//
+// Match keys are PaymentAttributes JSON names, with nested parties addressed
+// as e.g. "debtor_party.sort_code". Values use path.Match glob syntax.
+//
+// Outcomes are checked against the payment submission machine of defs.
+func LoadRules(filename string, defs Definitions) (*RuleSet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rs RuleSet
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	if err := rs.Validate(defs); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &rs, nil
+}
+
+// Validate checks that every rule names known fields, valid patterns and an
+// outcome the payment submission machine of defs can reach, and that every
+// task rule names at least one task.
+func (rs *RuleSet) Validate(defs Definitions) error {
+	def := defs[models.ResourceTypePaymentSubmission]
+	if def == nil {
+		return fmt.Errorf("no %s machine", models.ResourceTypePaymentSubmission)
+	}
+	known := attributeFieldNames(reflect.TypeOf(models.PaymentAttributes{}), "")
+	for i, r := range rs.Rules {
+		if err := validateMatch(r.Match, known); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if r.Outcome.Status == "" {
+			return fmt.Errorf("rule %d: outcome status is required", i)
+		}
+		if err := def.ValidateOutcome(r.Outcome); err != nil {
+			return fmt.Errorf("rule %d: outcome: %w", i, err)
+		}
+	}
+	for i, r := range rs.AdmissionTasks {
+		if err := validateMatch(r.Match, known); err != nil {
+			return fmt.Errorf("task rule %d: %w", i, err)
+		}
+		if len(r.Tasks) == 0 {
+			return fmt.Errorf("task rule %d: tasks are required", i)
+		}
+	}
+	return nil
+}
+
+func validateMatch(match map[string]string, known map[string]bool) error {
+	if len(match) == 0 {
+		return fmt.Errorf("match is empty")
+	}
+	for field, pattern := range match {
+		if !known[resolveField(field)] {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q for %s: %w", pattern, field, err)
+		}
+	}
+	return nil
+}
+
+// Select returns the outcome of the first rule matching p, or OutcomeDelivered.
+func (rs *RuleSet) Select(p models.Payment) Outcome {
+	fields := attributeFields(reflect.ValueOf(p.Attributes), "", nil)
+	for _, r := range rs.Rules {
+		if matches(r.Match, fields) {
+			return r.Outcome
+		}
+	}
+	return OutcomeDelivered
+}
+
+// Tasks returns the tasks of the first task rule matching p, or nil.
+func (rs *RuleSet) Tasks(p models.Payment) []string {
+	fields := attributeFields(reflect.ValueOf(p.Attributes), "", nil)
+	for _, r := range rs.AdmissionTasks {
+		if matches(r.Match, fields) {
+			return r.Tasks
+		}
+	}
+	return nil
+}
+
+func matches(match, fields map[string]string) bool {
+	for field, pattern := range match {
+		ok, _ := path.Match(pattern, fields[resolveField(field)])
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func resolveField(name string) string {
+	if full, ok := fieldAliases[name]; ok {
+		return full
+	}
+	return name
+}
+
+// attributeFields flattens string fields of a struct into dotted JSON names.
+func attributeFields(v reflect.Value, prefix string, out map[string]string) map[string]string {
+	if out == nil {
+		out = make(map[string]string)
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			out[prefix+name] = f.String()
+		case reflect.Pointer:
+			if !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+				attributeFields(f.Elem(), prefix+name+".", out)
+			}
+		}
+	}
+	return out
+}
+
+// attributeFieldNames lists the names attributeFields can produce for t.
+func attributeFieldNames(t reflect.Type, prefix string) map[string]bool {
+	out := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		ft := t.Field(i).Type
+		switch {
+		case ft.Kind() == reflect.String:
+			out[prefix+name] = true
+		case ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct:
+			for k := range attributeFieldNames(ft.Elem(), prefix+name+".") {
+				out[k] = true
+			}
+		}
+	}
+	return out
+}
+
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
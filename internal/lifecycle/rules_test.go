@@ -0,0 +1,94 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+const testRules = `{"rules": [
+  {"name": "limit", "match": {"amount": "666.66"}, "outcome": {"status": "failed", "at": "limit_check_pending", "scheme_status_code": "AM04"}},
+  {"name": "reject", "match": {"reference": "REJECT-*"}, "outcome": {"status": "delivery_failed", "scheme_status_code": "AC01"}},
+  {"name": "closed", "match": {"sort_code": "400400", "currency": "GBP"}, "outcome": {"status": "delivery_failed", "scheme_status_code": "AC04"}}
+]}`
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "fixture.json")
+	if err := os.WriteFile(fn, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestRuleSelection(t *testing.T) {
+	rs, err := LoadRules(writeFile(t, testRules), DefaultDefinitions())
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		attrs models.PaymentAttributes
+		want  string
+	}{
+		{"amount", models.PaymentAttributes{Amount: "666.66"}, "AM04"},
+		{"reference prefix", models.PaymentAttributes{Amount: "1.00", Reference: "REJECT-123"}, "AC01"},
+		{"nested party", models.PaymentAttributes{Currency: "GBP", BeneficiaryParty: &models.AccountParty{SortCode: "400400"}}, "AC04"},
+		{"partial match", models.PaymentAttributes{Currency: "EUR", BeneficiaryParty: &models.AccountParty{SortCode: "400400"}}, ""},
+		{"no match", models.PaymentAttributes{Amount: "10.00", Reference: "invoice"}, ""},
+	}
+	for _, tt := range tests {
+		got := rs.Select(models.Payment{Attributes: tt.attrs})
+		if got.SchemeStatusCode != tt.want {
+			t.Errorf("%s: expected code %q, got %q", tt.name, tt.want, got.SchemeStatusCode)
+		}
+	}
+}
+
+func TestLoadRulesRejectsUnknownField(t *testing.T) {
+	_, err := LoadRules(writeFile(t, `{"rules": [{"match": {"colour": "red"}, "outcome": {"status": "failed"}}]}`), DefaultDefinitions())
+	if err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestLoadRulesRejectsUnreachableOutcome(t *testing.T) {
+	for _, outcome := range []string{
+		`{"status": "failed"}`,
+		`{"status": "delivery_failed", "at": "validation_pending"}`,
+		`{"status": "bogus"}`,
+		`{"status": "submitted", "at": "queued_for_delivery"}`,
+		`{"status": "failed", "at": "checking"}`,
+	} {
+		_, err := LoadRules(writeFile(t, `{"rules": [{"match": {"amount": "1.00"}, "outcome": `+outcome+`}]}`), DefaultDefinitions())
+		if err == nil {
+			t.Errorf("%s: expected error", outcome)
+		}
+	}
+}
+
+func TestAdmissionTaskRules(t *testing.T) {
+	rs, err := LoadRules(writeFile(t, `{"rules": [], "admission_tasks": [
+  {"match": {"amount": "5000.00"}, "tasks": ["manual_review"]},
+  {"match": {"account_name": "J*"}, "tasks": ["name_mismatch", "manual_review"]}
+]}`), DefaultDefinitions())
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	if got := rs.Tasks(models.Payment{Attributes: models.PaymentAttributes{Amount: "5000.00"}}); len(got) != 1 || got[0] != "manual_review" {
+		t.Errorf("amount: got %v", got)
+	}
+	if got := rs.Tasks(models.Payment{Attributes: models.PaymentAttributes{BeneficiaryParty: &models.AccountParty{AccountName: "Jo"}}}); len(got) != 2 {
+		t.Errorf("account name: got %v", got)
+	}
+	if got := rs.Tasks(models.Payment{Attributes: models.PaymentAttributes{Amount: "1.00"}}); got != nil {
+		t.Errorf("no match: got %v", got)
+	}
+
+	if _, err := LoadRules(writeFile(t, `{"rules": [], "admission_tasks": [{"match": {"amount": "1.00"}, "tasks": []}]}`), DefaultDefinitions()); err == nil {
+		t.Error("expected error for task rule without tasks")
+	}
+}
@@ -0,0 +1,170 @@
+package lifecycle
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Stats is a snapshot of the engine's scheduler.
+type Stats struct {
+	// Pending is the number of lifecycles with transitions still to run.
+	Pending int `json:"pending"`
+	// Overdue is the number of transitions that are due but not yet started.
+	Overdue int `json:"overdue"`
+	// Running is the number of transitions currently executing.
+	Running int `json:"running"`
+	// Held is the number of lifecycles held at a breakpoint.
+	Held int `json:"held"`
+	// Executed is the total number of transitions applied.
+	Executed uint64 `json:"executed"`
+	// Workers is the size of the worker pool.
+	Workers int `json:"workers"`
+}
+
+// runHeap is a min-heap of lifecycle runs ordered by due time.
+type runHeap []*lifecycleRun
+
+func (h runHeap) Len() int { return len(h) }
+
+func (h runHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h runHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *runHeap) Push(x any) {
+	run := x.(*lifecycleRun)
+	run.index = len(*h)
+	*h = append(*h, run)
+}
+
+func (h *runHeap) Pop() any {
+	old := *h
+	n := len(old)
+	run := old[n-1]
+	old[n-1] = nil
+	run.index = -1
+	*h = old[:n-1]
+	return run
+}
+
+// countDue counts heap entries due at or before now, skipping subtrees that
+// the heap ordering guarantees are all later.
+func (h runHeap) countDue(i int, now time.Time) int {
+	if i >= len(h) || h[i].due.After(now) {
+		return 0
+	}
+	return 1 + h.countDue(2*i+1, now) + h.countDue(2*i+2, now)
+}
+
+// scheduleLocked queues run for its due time, waking the scheduler if it is
+// now the earliest entry.
+func (e *Engine) scheduleLocked(run *lifecycleRun) {
+	heap.Push(&e.queue, run)
+	if run.index == 0 {
+		e.wakeScheduler()
+	}
+}
+
+// unscheduleLocked removes run from the queue if it is still there.
+func (e *Engine) unscheduleLocked(run *lifecycleRun) bool {
+	if run.index < 0 {
+		return false
+	}
+	heap.Remove(&e.queue, run.index)
+	return true
+}
+
+func (e *Engine) earliestLocked() *lifecycleRun {
+	if len(e.queue) == 0 {
+		return nil
+	}
+	return e.queue[0]
+}
+
+func (e *Engine) wakeScheduler() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule is the single goroutine that hands due transitions to the worker
+// pool. It sleeps on one timer set for the earliest entry in the queue.
+func (e *Engine) schedule() {
+	defer e.done.Done()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		e.mu.Lock()
+		now := e.clock.Now()
+		for len(e.queue) > 0 && !e.queue[0].due.After(now) {
+			run := heap.Pop(&e.queue).(*lifecycleRun)
+			e.dispatched++
+			e.mu.Unlock()
+			// Blocks while every worker is busy, which bounds concurrency.
+			select {
+			case e.work <- run:
+			case <-e.ctx.Done():
+				return
+			}
+			e.mu.Lock()
+		}
+		wait := time.Duration(-1)
+		if len(e.queue) > 0 {
+			wait = e.queue[0].due.Sub(now)
+		}
+		e.mu.Unlock()
+
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-e.wake:
+			timer.Stop()
+		case <-e.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (e *Engine) worker() {
+	defer e.done.Done()
+	for {
+		var run *lifecycleRun
+		select {
+		case run = <-e.work:
+		case <-e.ctx.Done():
+			return
+		}
+		e.mu.Lock()
+		e.dispatched--
+		e.running++
+		e.mu.Unlock()
+
+		e.step(run)
+
+		e.mu.Lock()
+		e.running--
+		e.idle.Broadcast()
+		e.mu.Unlock()
+	}
+}
+
+// Stats returns a snapshot of the scheduler.
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Stats{
+		Pending:  len(e.queue) + e.dispatched + e.running,
+		Overdue:  e.queue.countDue(0, e.clock.Now()) + e.dispatched,
+		Running:  e.running,
+		Held:     e.held,
+		Executed: e.executed,
+		Workers:  e.workers,
+	}
+}
@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+)
+
+// ShutdownPolicy decides what happens to pending transitions on Shutdown.
+type ShutdownPolicy string
+
+const (
+	// ShutdownAbandon drops pending transitions, leaving resources at their
+	// current status.
+	ShutdownAbandon ShutdownPolicy = "abandon"
+	// ShutdownFastForward applies every pending transition immediately,
+	// ignoring step delays, so resources reach a terminal status.
+	ShutdownFastForward ShutdownPolicy = "fast_forward"
+)
+
+// ParseShutdownPolicy validates a policy name.
+func ParseShutdownPolicy(s string) (ShutdownPolicy, error) {
+	switch p := ShutdownPolicy(s); p {
+	case ShutdownAbandon, ShutdownFastForward:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown lifecycle shutdown policy %q", s)
+}
+
+// SetShutdownPolicy chooses how Shutdown treats pending transitions.
+// It must be called before the engine is used.
+func (e *Engine) SetShutdownPolicy(p ShutdownPolicy) {
+	e.policy = p
+}
+
+// Shutdown stops the engine from accepting new lifecycles, deals with pending
+// transitions according to the shutdown policy, waits for in-flight ones to
+// finish and stops the scheduler and workers. If ctx expires first the
+// remaining work is abandoned and ctx's error returned.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	queued := make([]*lifecycleRun, 0, len(e.queue))
+	for len(e.queue) > 0 {
+		queued = append(queued, heap.Pop(&e.queue).(*lifecycleRun))
+	}
+	var abandoned []Key
+	if e.policy == ShutdownAbandon && e.journal == nil {
+		// Nothing will resume them. Runs in flight are dropped once their
+		// transition is applied.
+		for _, run := range queued {
+			abandoned = append(abandoned, run.key)
+		}
+		for _, run := range e.runs {
+			if run.held {
+				abandoned = append(abandoned, run.key)
+			}
+		}
+	}
+	e.mu.Unlock()
+	for _, key := range abandoned {
+		e.dropped(key)
+	}
+	defer func() {
+		e.cancel()
+		e.mu.Lock()
+		e.idle.Broadcast()
+		e.mu.Unlock()
+		e.done.Wait()
+	}()
+
+	if e.policy == ShutdownFastForward {
+		for _, run := range queued {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// step carries on through the remaining steps once closed.
+			e.step(run)
+		}
+	}
+
+	idle := make(chan struct{})
+	go func() {
+		e.mu.Lock()
+		for e.dispatched+e.running > 0 && e.ctx.Err() == nil {
+			e.idle.Wait()
+		}
+		e.mu.Unlock()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,6 +1,9 @@
 package lifecycle
 
+import "github.com/nibble/mock-fps/internal/models"
+
 // StatusChain defines the sequence of statuses a resource transitions through.
+// The chains below are the happy paths of the built-in state machines.
 type StatusChain []string
 
 // PaymentSubmissionChain is the status lifecycle for payment submissions.
@@ -26,3 +29,42 @@ var SimpleSubmissionChain = StatusChain{
 	"accepted",
 	"delivery_confirmed",
 }
+
+// ExceptionChain is the status lifecycle for returns and reversals, which
+// move on as their submissions do.
+var ExceptionChain = StatusChain{
+	"pending",
+	"submitted",
+	"completed",
+}
+
+// RecallChain is the status lifecycle for recalls, which move on as their
+// submissions and decisions do.
+var RecallChain = StatusChain{
+	"pending",
+	"awaiting_decision",
+	"accepted",
+}
+
+// Outcome describes how a lifecycle ends. The zero value follows the state
+// machine to whichever terminal state it reaches.
+type Outcome struct {
+	// Status is the terminal status, e.g. "failed" or "delivery_failed".
+	Status string `json:"status"`
+	// At is the status after which the lifecycle diverts to Status. When
+	// empty, Status replaces the terminal status.
+	At string `json:"at,omitempty"`
+	// SchemeStatusCode is the scheme reason code reported with the outcome.
+	SchemeStatusCode string `json:"scheme_status_code,omitempty"`
+	// Reason explains the outcome in words, e.g. the reason given with a
+	// recall decision.
+	Reason string `json:"reason,omitempty"`
+}
+
+// OutcomeDelivered is the happy-path outcome.
+var OutcomeDelivered = Outcome{}
+
+// IsFailure reports whether the outcome ends in a failure status.
+func (o Outcome) IsFailure() bool {
+	return o.Status == models.StatusFailed || o.Status == models.StatusDeliveryFailed
+}
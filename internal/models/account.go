@@ -0,0 +1,19 @@
+package models
+
+// Account is a mock account at the simulated bank, identified by its sort
+// code and account number.
+type Account struct {
+	SortCode      string `json:"sort_code"`
+	AccountNumber string `json:"account_number"`
+	AccountName   string `json:"account_name,omitempty"`
+	State         string `json:"state"`
+}
+
+// Account states.
+const (
+	AccountStateOpen     = "open"
+	AccountStateClosed   = "closed"
+	AccountStateFrozen   = "frozen"
+	AccountStateDeceased = "deceased"
+	AccountStateSwitched = "switched"
+)
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DeadLetter is a webhook notification that could not be delivered to a
+// subscriber within the retry policy's attempts.
+type DeadLetter struct {
+	Resource
+	Attributes DeadLetterAttributes `json:"attributes"`
+}
+
+// DeadLetterAttributes holds the notification and how its delivery failed.
+type DeadLetterAttributes struct {
+	SubscriptionID string       `json:"subscription_id"`
+	CallbackURI    string       `json:"callback_uri"`
+	Notification   Notification `json:"notification"`
+	Attempts       int          `json:"attempts"`
+	LastAttemptOn  time.Time    `json:"last_attempt_on"`
+	// LastError is the transport error or response status of the last
+	// attempt.
+	LastError      string `json:"last_error"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeliveryAttempt records one attempt to deliver a webhook notification to a
+// subscriber.
+type DeliveryAttempt struct {
+	Resource
+	Attributes DeliveryAttemptAttributes `json:"attributes"`
+}
+
+// DeliveryAttemptAttributes holds the request sent and what came back.
+type DeliveryAttemptAttributes struct {
+	NotificationID string    `json:"notification_id"`
+	SubscriptionID string    `json:"subscription_id"`
+	CallbackURI    string    `json:"callback_uri"`
+	Attempt        int       `json:"attempt"`
+	Outcome        string    `json:"outcome"`
+	AttemptedOn    time.Time `json:"attempted_on"`
+	LatencyMs      int64     `json:"latency_ms"`
+
+	RequestHeaders map[string][]string `json:"request_headers,omitempty"`
+	RequestBody    json.RawMessage     `json:"request_body,omitempty"`
+	// ResponseBody is the start of the response body, if there was one.
+	ResponseStatusCode int    `json:"response_status_code,omitempty"`
+	ResponseBody       string `json:"response_body,omitempty"`
+	// Error is the transport error or response status of a failed attempt.
+	Error string `json:"error,omitempty"`
+}
+
+// Delivery attempt outcomes.
+const (
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// What caused a status transition.
+const (
+	TriggerEngine = "engine"
+	TriggerRule   = "rule"
+	TriggerAdmin  = "admin"
+)
+
+// StatusTransition is one entry in a resource's status history.
+type StatusTransition struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	At      time.Time `json:"at"`
+	Trigger string    `json:"trigger"`
+}
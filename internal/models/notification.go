@@ -17,5 +17,10 @@ type NotificationData struct {
 	RecordType string      `json:"record_type"`
 	EventType  string      `json:"event_type"`
 	ResourceID string      `json:"resource_id"`
+	// Status is the new status of a resource whose update changed it.
+	Status     string      `json:"status,omitempty"`
 	Payload    interface{} `json:"payload,omitempty"`
+	// PreviousPayload is the resource as it was in the last notification
+	// about it, for subscriptions that ask for it.
+	PreviousPayload interface{} `json:"previous_payload,omitempty"`
 }
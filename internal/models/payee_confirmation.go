@@ -0,0 +1,29 @@
+package models
+
+// PayeeConfirmation is a Confirmation of Payee check: the request is made
+// with the attributes up to AccountName, and the mock fills in the result.
+type PayeeConfirmation struct {
+	Resource
+	Attributes PayeeConfirmationAttributes `json:"attributes"`
+}
+
+// PayeeConfirmationAttributes holds the details checked and the result.
+type PayeeConfirmationAttributes struct {
+	SortCode      string `json:"sort_code"`
+	AccountNumber string `json:"account_number"`
+	AccountName   string `json:"account_name"`
+
+	Result string `json:"result,omitempty"`
+	// ReasonCode is the Pay.UK reason code for any result but a match.
+	ReasonCode string `json:"reason_code,omitempty"`
+	// SuggestedName is the name on the account, given for a close match.
+	SuggestedName string `json:"suggested_name,omitempty"`
+}
+
+// Confirmation of Payee results.
+const (
+	PayeeMatch           = "match"
+	PayeeCloseMatch      = "close_match"
+	PayeeNoMatch         = "no_match"
+	PayeeAccountNotFound = "account_not_found"
+)
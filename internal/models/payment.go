@@ -23,8 +23,22 @@ type PaymentAttributes struct {
 	DebtorParty          *AccountParty       `json:"debtor_party,omitempty"`
 	ChargesInformation   *ChargesInformation `json:"charges_information,omitempty"`
 	Fx                   *FxInfo             `json:"fx,omitempty"`
+	// Status is derived from the payment's children and cannot be set.
+	Status string `json:"status,omitempty"`
 }
 
+// Aggregate payment statuses, from least to most final.
+const (
+	PaymentStatusPending   = "pending"
+	PaymentStatusSubmitted = "submitted"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusDelivered = "delivered"
+	PaymentStatusReceived  = "received"
+	PaymentStatusRecalled  = "recalled"
+	PaymentStatusReturned  = "returned"
+	PaymentStatusReversed  = "reversed"
+)
+
 // PaymentRelationships holds relationships to submissions, admissions, etc.
 type PaymentRelationships struct {
 	PaymentSubmissions *Relationship `json:"payment_submissions,omitempty"`
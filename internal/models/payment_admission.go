@@ -8,8 +8,9 @@ type PaymentAdmission struct {
 
 // PaymentAdmissionAttributes holds admission data.
 type PaymentAdmissionAttributes struct {
-	Status        string `json:"status"`
-	AdmissionDate string `json:"admission_date,omitempty"`
+	Status           string `json:"status"`
+	AdmissionDate    string `json:"admission_date,omitempty"`
+	SchemeStatusCode string `json:"scheme_status_code,omitempty"`
 }
 
 // AdmissionTask represents a task on an admission.
@@ -23,4 +24,5 @@ type AdmissionTaskAttributes struct {
 	Status   string `json:"status"`
 	Assignee string `json:"assignee,omitempty"`
 	Name     string `json:"name,omitempty"`
+	Outcome  string `json:"outcome,omitempty"`
 }
@@ -8,9 +8,10 @@ type Recall struct {
 
 // RecallAttributes holds recall data.
 type RecallAttributes struct {
-	Amount       string `json:"amount,omitempty"`
-	Currency     string `json:"currency,omitempty"`
-	RecallReason string `json:"recall_reason,omitempty"`
-	RecallType   string `json:"recall_type,omitempty"`
-	Status       string `json:"status,omitempty"`
+	Amount         string `json:"amount,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	RecallReason   string `json:"recall_reason,omitempty"`
+	RecallType     string `json:"recall_type,omitempty"`
+	Status         string `json:"status,omitempty"`
+	DecisionReason string `json:"decision_reason,omitempty"`
 }
@@ -13,4 +13,5 @@ type ReturnPaymentAttributes struct {
 	ReturnCode    string `json:"return_code,omitempty"`
 	ReturnReason  string `json:"return_reason,omitempty"`
 	SchemeStatus  string `json:"scheme_status,omitempty"`
+	RecallID      string `json:"recall_id,omitempty"`
 }
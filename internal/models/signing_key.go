@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Signing key algorithms.
+const (
+	SigningHMACSHA256 = "hmac-sha256"
+	SigningEd25519    = "ed25519"
+)
+
+// SigningKey signs the notifications sent to a subscription. A subscription
+// signs with every key active at the time of sending, so during a rotation
+// the outgoing and incoming keys both sign until the outgoing one expires.
+// The secret and private key are only returned by the API when the key is
+// set.
+type SigningKey struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	// Secret is the shared secret of an HMAC key.
+	Secret string `json:"secret,omitempty"`
+	// PrivateKey and PublicKey are the base64 seed and public key of an
+	// Ed25519 key.
+	PrivateKey string     `json:"private_key,omitempty"`
+	PublicKey  string     `json:"public_key,omitempty"`
+	NotBefore  *time.Time `json:"not_before,omitempty"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+}
+
+// ActiveAt reports whether the key signs notifications sent at t.
+func (k SigningKey) ActiveAt(t time.Time) bool {
+	return (k.NotBefore == nil || !t.Before(*k.NotBefore)) && (k.NotAfter == nil || t.Before(*k.NotAfter))
+}
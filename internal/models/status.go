@@ -27,6 +27,7 @@ const (
 	ResourceTypePayment                  = "payments"
 	ResourceTypePaymentSubmission        = "payment_submissions"
 	ResourceTypePaymentAdmission         = "payment_admissions"
+	ResourceTypeAdmissionTask            = "admission_tasks"
 	ResourceTypeReturnPayment            = "return_payments"
 	ResourceTypeReturnSubmission         = "return_submissions"
 	ResourceTypeRecall                   = "recalls"
@@ -36,6 +37,9 @@ const (
 	ResourceTypeReversal                 = "reversals"
 	ResourceTypeReversalSubmission       = "reversal_submissions"
 	ResourceTypeSubscription             = "subscriptions"
+	ResourceTypePayeeConfirmation        = "payee_confirmations"
+	ResourceTypeDeadLetter               = "dead_letters"
+	ResourceTypeDeliveryAttempt          = "delivery_attempts"
 )
 
 // Event types for webhook notifications.
@@ -43,3 +47,27 @@ const (
 	EventCreated  = "created"
 	EventUpdated  = "updated"
 )
+
+// Return, recall and reversal statuses. They also use StatusPending,
+// StatusSubmitted, StatusAccepted and StatusFailed.
+const (
+	StatusAwaitingDecision = "awaiting_decision"
+	StatusCompleted        = "completed"
+	StatusRejected         = "rejected"
+)
+
+// StatusPendingTasks is the status of an admission waiting for its tasks.
+const StatusPendingTasks = "pending_tasks"
+
+// Admission task outcomes. A task is done once its status is StatusCompleted;
+// a completed task without an outcome has passed.
+const (
+	TaskOutcomePassed = "passed"
+	TaskOutcomeFailed = "failed"
+)
+
+// Recall decision answers.
+const (
+	RecallAnswerAccepted = "accepted"
+	RecallAnswerRejected = "rejected"
+)
@@ -14,4 +14,17 @@ type SubscriptionAttributes struct {
 	IsActive         bool   `json:"is_active"`
 	CallbackTransport string `json:"callback_transport,omitempty"`
 	UserID           string `json:"user_id,omitempty"`
+	SigningKeys      []SigningKey `json:"signing_keys,omitempty"`
+	// Payload is PayloadThin or PayloadFull; thin is the default.
+	Payload          string `json:"payload,omitempty"`
+	// IncludePrevious adds the resource as it was in the last notification
+	// about it to full payloads.
+	IncludePrevious  bool   `json:"include_previous,omitempty"`
 }
+
+// Notification payload formats. Thin notifications only identify the
+// resource; full ones carry its current representation.
+const (
+	PayloadThin = "thin"
+	PayloadFull = "full"
+)
@@ -0,0 +1,222 @@
+// Package modulus validates UK sort codes and account numbers with the
+// Vocalink modulus checking algorithm.
+//
+// The checks are driven by Vocalink's weight table (valacdos.txt) and sort
+// code substitution table (scsubtab.txt), which are loaded from file. Sort
+// codes the weight table does not cover cannot be checked and are taken to be
+// valid.
+package modulus
+
+import (
+	"errors"
+)
+
+// Errors returned by Check. Only ErrModulus means the details are well formed
+// but do not make a valid account.
+var (
+	ErrSortCode      = errors.New("sort code must be 6 digits")
+	ErrAccountNumber = errors.New("account number must be 8 digits")
+	ErrModulus       = errors.New("account number fails the modulus check for the sort code")
+)
+
+// Algorithms named in the weight table.
+const (
+	Mod10           = "MOD10"
+	Mod11           = "MOD11"
+	DoubleAlternate = "DBLAL"
+)
+
+// Positions of the 14 digits of a sort code followed by an account number,
+// named as in the Vocalink specification: uvwxyz abcdefgh.
+const (
+	posA = 6
+	posB = 7
+	posC = 8
+	posG = 12
+	posH = 13
+)
+
+// Sort codes that stand in for the real one under exceptions 8 and 9.
+const (
+	exception8SortCode = "090126"
+	exception9SortCode = "309634"
+)
+
+// exception2Weights replace a rule's weights under exception 2, depending on
+// whether g is 9.
+var exception2Weights = map[bool][14]int{
+	false: {0, 0, 1, 2, 5, 3, 6, 4, 8, 7, 10, 9, 3, 1},
+	true:  {0, 0, 0, 0, 0, 0, 0, 0, 8, 7, 10, 9, 3, 1},
+}
+
+// Rule is one row of the weight table: the check to run for a range of sort
+// codes.
+type Rule struct {
+	Start     string
+	End       string
+	Algorithm string
+	Weights   [14]int
+	Exception int
+}
+
+// Check validates an account. It returns ErrSortCode or ErrAccountNumber for
+// malformed details and ErrModulus if the account fails its checks.
+func (t *Table) Check(sortCode, accountNumber string) error {
+	if !digits(sortCode, 6) {
+		return ErrSortCode
+	}
+	if !digits(accountNumber, 8) {
+		return ErrAccountNumber
+	}
+	rules := t.rules(sortCode)
+	if len(rules) == 0 {
+		return nil
+	}
+	if valid(rules, t.substitute(sortCode, rules), accountNumber) {
+		return nil
+	}
+	return ErrModulus
+}
+
+// substitute returns the sort code to check with: under exception 5 a sort
+// code in the substitution table is replaced.
+func (t *Table) substitute(sortCode string, rules []Rule) string {
+	if rules[0].Exception != 5 {
+		return sortCode
+	}
+	if sub, ok := t.subs[sortCode]; ok {
+		return sub
+	}
+	return sortCode
+}
+
+// valid runs the one or two checks of rules against an account, combining
+// their results as the exceptions require.
+func valid(rules []Rule, sortCode, accountNumber string) bool {
+	n := number(sortCode + accountNumber)
+	for _, r := range rules {
+		// Foreign currency accounts cannot be checked.
+		if r.Exception == 6 && n[posA] >= 4 && n[posA] <= 8 && n[posG] == n[posH] {
+			return true
+		}
+	}
+
+	first := rules[0]
+	ok := check(first, sortCode, accountNumber)
+	if !ok && first.Exception == 14 {
+		ok = exception14(first, sortCode, accountNumber)
+	}
+	if len(rules) == 1 {
+		return ok
+	}
+
+	second := rules[1]
+	switch {
+	case first.Exception == 2 && second.Exception == 9:
+		return ok || check(second, exception9SortCode, accountNumber)
+	case first.Exception == 10 && second.Exception == 11,
+		first.Exception == 12 && second.Exception == 13:
+		return ok || check(second, sortCode, accountNumber)
+	}
+	if !ok {
+		return false
+	}
+	if second.Exception == 3 && (n[posC] == 6 || n[posC] == 9) {
+		return true
+	}
+	return check(second, sortCode, accountNumber)
+}
+
+// exception14 rechecks an account whose last digit is 0, 1 or 9 with that
+// digit dropped.
+func exception14(r Rule, sortCode, accountNumber string) bool {
+	switch accountNumber[7] {
+	case '0', '1', '9':
+		return check(r, sortCode, "0"+accountNumber[:7])
+	}
+	return false
+}
+
+// check runs a single rule against an account.
+func check(r Rule, sortCode, accountNumber string) bool {
+	if r.Exception == 8 {
+		sortCode = exception8SortCode
+	}
+	n := number(sortCode + accountNumber)
+	w := r.Weights
+	switch r.Exception {
+	case 2:
+		if n[posA] != 0 {
+			w = exception2Weights[n[posG] == 9]
+		}
+	case 7:
+		if n[posG] == 9 {
+			zeroSortCodeWeights(&w)
+		}
+	case 10:
+		if (n[posA] == 0 || n[posA] == 9) && n[posB] == 9 && n[posG] == 9 {
+			zeroSortCodeWeights(&w)
+		}
+	}
+
+	total := 0
+	for i := range n {
+		p := n[i] * w[i]
+		if r.Algorithm == DoubleAlternate {
+			p = p/10 + p%10
+		}
+		total += p
+	}
+	if r.Exception == 1 {
+		total += 27
+	}
+
+	switch r.Algorithm {
+	case Mod11:
+		rem := total % 11
+		switch r.Exception {
+		case 4:
+			return rem == n[posG]*10+n[posH]
+		case 5:
+			if rem == 1 {
+				return false
+			}
+			return (11-rem)%11 == n[posG]
+		}
+		return rem == 0
+	case Mod10, DoubleAlternate:
+		rem := total % 10
+		if r.Exception == 5 {
+			return (10-rem)%10 == n[posH]
+		}
+		return rem == 0
+	}
+	return false
+}
+
+// zeroSortCodeWeights zeroes the weights u to b, leaving only c to h.
+func zeroSortCodeWeights(w *[14]int) {
+	for i := 0; i <= posB; i++ {
+		w[i] = 0
+	}
+}
+
+func number(s string) [14]int {
+	var n [14]int
+	for i := range n {
+		n[i] = int(s[i] - '0')
+	}
+	return n
+}
+
+func digits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package modulus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testWeights = `
+100000 100099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1
+200000 200099 MOD10 0 0 0 0 0 0 7 5 8 3 4 6 2 1
+200000 200099 DBLAL 2 1 2 1 2 1 2 1 2 1 2 1 2 1
+300000 300099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 14
+400000 400099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 5
+400000 400099 DBLAL 2 1 2 1 2 1 2 1 2 1 2 1 2 1 5
+500000 500099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 10
+500000 500099 MOD11 0 0 0 0 0 0 1 2 3 4 5 6 7 8 11
+600000 600099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 6
+`
+
+func testTable(t *testing.T) *Table {
+	t.Helper()
+	rows, err := ParseWeights(strings.NewReader(testWeights))
+	if err != nil {
+		t.Fatalf("ParseWeights: %v", err)
+	}
+	subs, err := ParseSubstitutions(strings.NewReader("400010 400099\n"))
+	if err != nil {
+		t.Fatalf("ParseSubstitutions: %v", err)
+	}
+	table, err := NewTable(rows, subs)
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	return table
+}
+
+func TestCheck(t *testing.T) {
+	table := testTable(t)
+	for _, tc := range []struct {
+		name, sortCode, account string
+		want                    error
+	}{
+		{"standard pass", "100010", "18034063", nil},
+		{"standard fail", "100010", "87455328", ErrModulus},
+		{"both checks pass", "200010", "04105718", nil},
+		{"second check fails", "200010", "02996023", ErrModulus},
+		{"exception 14 drops the last digit", "300010", "25481199", nil},
+		{"exception 14 only for 0, 1 or 9", "300010", "40717432", ErrModulus},
+		{"exception 5 substitutes the sort code", "400010", "11605483", nil},
+		{"exception 11 passes alone", "500010", "58916432", nil},
+		{"exceptions 10 and 11 both fail", "500010", "89088064", ErrModulus},
+		{"exception 6 foreign currency", "600010", "50000011", nil},
+		{"sort code not in table", "900000", "12345678", nil},
+		{"short sort code", "10001", "18034063", ErrSortCode},
+		{"hyphenated sort code", "10-00-10", "18034063", ErrSortCode},
+		{"long account number", "100010", "180340631", ErrAccountNumber},
+		{"non-digit account number", "100010", "1803406X", ErrAccountNumber},
+	} {
+		if err := table.Check(tc.sortCode, tc.account); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Check(%s, %s) = %v, want %v", tc.name, tc.sortCode, tc.account, err, tc.want)
+		}
+	}
+
+	var formats Table
+	if err := formats.Check("100010", "87455328"); err != nil {
+		t.Errorf("empty table: expected formats only, got %v", err)
+	}
+}
+
+func TestParseWeightsErrors(t *testing.T) {
+	for _, in := range []string{
+		"100000 100099 MOD11 0 0 0",
+		"100000 100099 MOD12 0 0 0 0 0 0 8 7 6 5 4 3 2 1",
+		"100099 100000 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1",
+		"100000 100099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 x",
+		"100000 100099 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 15",
+	} {
+		if _, err := ParseWeights(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseWeights(%q): expected an error", in)
+		}
+	}
+}
+
+// vocalinkWeights holds the weight table rows for the sort codes in
+// vocalinkCases.
+const vocalinkWeights = `
+089999 089999 MOD10 0 0 0 0 0 0 7 1 3 7 1 3 7 1
+107999 107999 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1
+134020 134020 MOD11 0 0 0 7 5 9 8 4 6 3 5 2 0 0 4
+180002 180002 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 14
+772798 772798 MOD11 0 0 1 2 5 3 6 4 8 7 10 9 3 1 7
+871427 871427 MOD11 0 0 1 2 5 3 6 4 8 7 10 9 3 1 10
+938000 938696 MOD11 7 6 5 4 3 2 7 6 5 4 3 2 0 0 5
+938000 938696 DBLAL 2 1 2 1 2 1 2 1 2 1 2 1 2 0 5
+`
+
+// vocalinkCases are Vocalink's published modulus checking test cases.
+var vocalinkCases = []struct {
+	name, sortCode, account string
+	want                    error
+}{
+	{"modulus 10 passes", "089999", "66374958", nil},
+	{"modulus 10 fails", "089999", "66374959", ErrModulus},
+	{"modulus 11 passes", "107999", "88837491", nil},
+	{"modulus 11 fails", "107999", "88837493", ErrModulus},
+	{"exception 4 remainder equals the check digit", "134020", "63849203", nil},
+	{"exception 5 passes", "938611", "07806039", nil},
+	{"exception 5 passes with substitution", "938600", "42368003", nil},
+	{"exception 5 both remainders 0", "938063", "55065200", nil},
+	{"exception 5 second check digit wrong", "938063", "15764273", ErrModulus},
+	{"exception 5 first check digit wrong", "938063", "15764264", ErrModulus},
+	{"exception 5 remainder 1", "938063", "15763217", ErrModulus},
+	{"exception 7 passes where the standard check fails", "772798", "99345694", nil},
+	{"exception 10 first check passes", "871427", "46238510", nil},
+	{"exception 10 ab=09 and g=9", "871427", "09123496", nil},
+	{"exception 10 ab=99 and g=9", "871427", "99123496", nil},
+	{"exception 14 second check passes", "180002", "00000190", nil},
+}
+
+func TestVocalinkCases(t *testing.T) {
+	rows, err := ParseWeights(strings.NewReader(vocalinkWeights))
+	if err != nil {
+		t.Fatalf("ParseWeights: %v", err)
+	}
+	subs, err := ParseSubstitutions(strings.NewReader("938600 938611\n"))
+	if err != nil {
+		t.Fatalf("ParseSubstitutions: %v", err)
+	}
+	table, err := NewTable(rows, subs)
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+	for _, tc := range vocalinkCases {
+		if err := table.Check(tc.sortCode, tc.account); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Check(%s, %s) = %v, want %v", tc.name, tc.sortCode, tc.account, err, tc.want)
+		}
+	}
+}
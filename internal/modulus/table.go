@@ -0,0 +1,147 @@
+package modulus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Table holds the weight table and sort code substitutions that Check
+// validates accounts against. The zero value checks formats only.
+type Table struct {
+	rows []Rule
+	subs map[string]string
+}
+
+// NewTable creates a table from weight table rows, in file order, and sort
+// code substitutions keyed by the original sort code.
+func NewTable(rows []Rule, subs map[string]string) (*Table, error) {
+	for i, r := range rows {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	for from, to := range subs {
+		if !digits(from, 6) || !digits(to, 6) {
+			return nil, fmt.Errorf("substitution %s -> %s: %w", from, to, ErrSortCode)
+		}
+	}
+	return &Table{rows: rows, subs: subs}, nil
+}
+
+// LoadTable reads Vocalink's weight table and, if substitutionsFile is not
+// empty, its sort code substitution table.
+func LoadTable(weightsFile, substitutionsFile string) (*Table, error) {
+	rows, err := readFile(weightsFile, ParseWeights)
+	if err != nil {
+		return nil, err
+	}
+	var subs map[string]string
+	if substitutionsFile != "" {
+		if subs, err = readFile(substitutionsFile, ParseSubstitutions); err != nil {
+			return nil, err
+		}
+	}
+	return NewTable(rows, subs)
+}
+
+func readFile[T any](filename string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer f.Close()
+	v, err := parse(f)
+	if err != nil {
+		return v, fmt.Errorf("%s: %w", filename, err)
+	}
+	return v, nil
+}
+
+// ParseWeights parses a weight table in the valacdos.txt layout: per line a
+// start and end sort code, an algorithm, 14 weights and an optional exception
+// number, separated by spaces. Blank lines are skipped.
+func ParseWeights(r io.Reader) ([]Rule, error) {
+	var rows []Rule
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 17 && len(f) != 18 {
+			return nil, fmt.Errorf("line %d: expected 17 or 18 fields, got %d", line, len(f))
+		}
+		r := Rule{Start: f[0], End: f[1], Algorithm: f[2]}
+		for i := range r.Weights {
+			w, err := strconv.Atoi(f[3+i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: weight %d: %w", line, i+1, err)
+			}
+			r.Weights[i] = w
+		}
+		if len(f) == 18 {
+			ex, err := strconv.Atoi(f[17])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: exception: %w", line, err)
+			}
+			r.Exception = ex
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, r)
+	}
+	return rows, sc.Err()
+}
+
+// ParseSubstitutions parses a sort code substitution table in the
+// scsubtab.txt layout: per line a sort code and the one to check it as.
+func ParseSubstitutions(r io.Reader) (map[string]string, error) {
+	subs := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 2 || !digits(f[0], 6) || !digits(f[1], 6) {
+			return nil, fmt.Errorf("line %d: expected two sort codes", line)
+		}
+		subs[f[0]] = f[1]
+	}
+	return subs, sc.Err()
+}
+
+func (r Rule) validate() error {
+	if !digits(r.Start, 6) || !digits(r.End, 6) || r.Start > r.End {
+		return fmt.Errorf("invalid sort code range %s-%s", r.Start, r.End)
+	}
+	switch r.Algorithm {
+	case Mod10, Mod11, DoubleAlternate:
+	default:
+		return fmt.Errorf("unknown algorithm %q", r.Algorithm)
+	}
+	if r.Exception < 0 || r.Exception > 14 {
+		return fmt.Errorf("unknown exception %d", r.Exception)
+	}
+	return nil
+}
+
+// rules returns the rows covering sortCode: none, one or two.
+func (t *Table) rules(sortCode string) []Rule {
+	var out []Rule
+	for _, r := range t.rows {
+		if r.Start <= sortCode && sortCode <= r.End {
+			out = append(out, r)
+			if len(out) == 2 {
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+// Package payee matches the names given in Confirmation of Payee requests
+// against the names on accounts.
+package payee
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// Matcher compares names by the Jaro-Winkler similarity of their normalised
+// forms, which ranges from 0 for nothing in common to 1 for the same name.
+type Matcher struct {
+	// Match is the lowest similarity taken as a match.
+	Match float64 `json:"match"`
+	// CloseMatch is the lowest similarity taken as a close match.
+	CloseMatch float64 `json:"close_match"`
+}
+
+// DefaultMatcher takes names that are the same once normalised as a match,
+// and ones that differ by a typo or two as a close match.
+var DefaultMatcher = Matcher{Match: 1, CloseMatch: 0.85}
+
+// Validate checks that the thresholds are in order and within 0 to 1.
+func (m Matcher) Validate() error {
+	if m.CloseMatch <= 0 || m.CloseMatch > m.Match || m.Match > 1 {
+		return fmt.Errorf("payee thresholds must satisfy 0 < close match (%g) <= match (%g) <= 1", m.CloseMatch, m.Match)
+	}
+	return nil
+}
+
+// Compare returns how well name matches the best of candidates, as one of
+// models.PayeeMatch, PayeeCloseMatch or PayeeNoMatch, and that candidate.
+func (m Matcher) Compare(name string, candidates []string) (string, string) {
+	best, bestScore := "", -1.0
+	n := Normalize(name)
+	for _, c := range candidates {
+		if score := Similarity(n, Normalize(c)); score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	switch {
+	case best == "":
+		return models.PayeeNoMatch, ""
+	case bestScore >= m.Match:
+		return models.PayeeMatch, best
+	case bestScore >= m.CloseMatch:
+		return models.PayeeCloseMatch, best
+	}
+	return models.PayeeNoMatch, best
+}
+
+// titles are dropped from names before they are compared.
+var titles = map[string]bool{"mr": true, "mrs": true, "ms": true, "miss": true, "mx": true, "dr": true}
+
+// Normalize lower-cases name, drops punctuation and titles and collapses
+// whitespace.
+func Normalize(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	out := words[:0]
+	for _, w := range words {
+		w = strings.ReplaceAll(w, "'", "")
+		if w != "" && !titles[w] {
+			out = append(out, w)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Similarity returns the Jaro-Winkler similarity of a and b.
+func Similarity(a, b string) float64 {
+	s, t := []rune(a), []rune(b)
+	if len(s) == 0 && len(t) == 0 {
+		return 1
+	}
+	if len(s) == 0 || len(t) == 0 {
+		return 0
+	}
+
+	window := max(len(s), len(t))/2 - 1
+	window = max(window, 0)
+	sMatched, tMatched := make([]bool, len(s)), make([]bool, len(t))
+	matches := 0
+	for i := range s {
+		for j := max(0, i-window); j < min(len(t), i+window+1); j++ {
+			if !tMatched[j] && s[i] == t[j] {
+				sMatched[i], tMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range s {
+		if !sMatched[i] {
+			continue
+		}
+		for !tMatched[j] {
+			j++
+		}
+		if s[i] != t[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(s)) + m/float64(len(t)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(s), len(t)) && s[prefix] == t[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,66 @@
+package payee
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+func TestSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.840},
+		{"dixon", "dicksonx", 0.813},
+		{"walker", "clarke", 0.722}, // an odd number of half-transpositions
+		{"same", "same", 1},
+		{"abc", "xyz", 0},
+		{"", "", 1},
+	} {
+		if got := Similarity(tc.a, tc.b); math.Abs(got-tc.want) > 0.001 {
+			t.Errorf("Similarity(%q, %q) = %.3f, want %.3f", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"Mr. John  SMITH":  "john smith",
+		"O'Brien-Jones":    "obrien jones",
+		"  Dr Jane Doe  ":  "jane doe",
+		"ACME Widgets Ltd": "acme widgets ltd",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	candidates := []string{"Jonathan Smith", "Acme Widgets Ltd"}
+	for name, want := range map[string][2]string{
+		"MR JONATHAN SMITH": {models.PayeeMatch, "Jonathan Smith"},
+		"Jonathon Smith":    {models.PayeeCloseMatch, "Jonathan Smith"},
+		"Acme Widgets":      {models.PayeeCloseMatch, "Acme Widgets Ltd"},
+		"Peter Parker":      {models.PayeeNoMatch, ""},
+	} {
+		result, suggested := DefaultMatcher.Compare(name, candidates)
+		if result != want[0] || (want[1] != "" && suggested != want[1]) {
+			t.Errorf("Compare(%q) = %s, %q; want %s, %q", name, result, suggested, want[0], want[1])
+		}
+	}
+	if result, _ := DefaultMatcher.Compare("Anyone", nil); result != models.PayeeNoMatch {
+		t.Errorf("no candidates: got %s", result)
+	}
+
+	strict := Matcher{Match: 1, CloseMatch: 0.99}
+	if result, _ := strict.Compare("Jonathon Smith", candidates); result != models.PayeeNoMatch {
+		t.Errorf("strict thresholds: got %s", result)
+	}
+	if err := (Matcher{Match: 0.8, CloseMatch: 0.9}).Validate(); err == nil {
+		t.Error("expected an error for close match above match")
+	}
+}
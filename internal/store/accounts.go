@@ -0,0 +1,115 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nibble/mock-fps/internal/ledger"
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// ErrInvalidAccount is returned for an account without a sort code and
+// account number, or in an unknown state.
+var ErrInvalidAccount = fmt.Errorf("invalid account")
+
+// PutAccount adds a to the account registry, replacing any account with the
+// same sort code and account number.
+func (m *MemoryStore) PutAccount(a models.Account) error {
+	if err := validateAccount(a); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[key2(a.SortCode, a.AccountNumber)] = a
+	return nil
+}
+
+func (m *MemoryStore) GetAccount(sortCode, accountNumber string) (models.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.accounts[key2(sortCode, accountNumber)]
+	if !ok {
+		return a, ErrNotFound
+	}
+	return a, nil
+}
+
+// ListAccounts returns the registry ordered by sort code and account number.
+func (m *MemoryStore) ListAccounts() []models.Account {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]models.Account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return key2(out[i].SortCode, out[i].AccountNumber) < key2(out[j].SortCode, out[j].AccountNumber)
+	})
+	return out
+}
+
+func (m *MemoryStore) DeleteAccount(sortCode, accountNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key2(sortCode, accountNumber)
+	if _, ok := m.accounts[k]; !ok {
+		return ErrNotFound
+	}
+	delete(m.accounts, k)
+	return nil
+}
+
+// LoadAccountsFile adds the accounts in a fixture file of the form
+//
+//	{"accounts": [{"sort_code": "400300", "account_number": "12345678", "state": "closed"}]}
+//
+// to the registry and returns how many there were. Accounts without a state
+// are open. Nothing is added unless every account is valid.
+func (m *MemoryStore) LoadAccountsFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var file struct {
+		Accounts []models.Account `json:"accounts"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, a := range file.Accounts {
+		if a.State == "" {
+			a.State = models.AccountStateOpen
+			file.Accounts[i] = a
+		}
+		if err := validateAccount(a); err != nil {
+			return 0, fmt.Errorf("%s: account %d: %w", path, i, err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range file.Accounts {
+		m.accounts[key2(a.SortCode, a.AccountNumber)] = a
+	}
+	return len(file.Accounts), nil
+}
+
+// Ledger returns the balances and postings of the registry's accounts.
+func (m *MemoryStore) Ledger() *ledger.Ledger {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ledger
+}
+
+func validateAccount(a models.Account) error {
+	if a.SortCode == "" || a.AccountNumber == "" {
+		return fmt.Errorf("%w: sort code and account number are required", ErrInvalidAccount)
+	}
+	switch a.State {
+	case models.AccountStateOpen, models.AccountStateClosed, models.AccountStateFrozen,
+		models.AccountStateDeceased, models.AccountStateSwitched:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown state %q", ErrInvalidAccount, a.State)
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+func (m *MemoryStore) CreateDeadLetter(d models.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.deadLetters[d.ID]; exists {
+		return ErrConflict
+	}
+	m.deadLetters[d.ID] = d
+	return nil
+}
+
+func (m *MemoryStore) GetDeadLetter(id string) (models.DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, ok := m.deadLetters[id]
+	if !ok {
+		return d, ErrNotFound
+	}
+	return d, nil
+}
+
+// ListDeadLetters returns the dead letters, oldest first.
+func (m *MemoryStore) ListDeadLetters() []models.DeadLetter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]models.DeadLetter, 0, len(m.deadLetters))
+	for _, d := range m.deadLetters {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedOn.Equal(out[j].CreatedOn) {
+			return out[i].CreatedOn.Before(out[j].CreatedOn)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (m *MemoryStore) DeleteDeadLetter(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deadLetters[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.deadLetters, id)
+	return nil
+}
@@ -0,0 +1,25 @@
+package store
+
+import "github.com/nibble/mock-fps/internal/models"
+
+// DeliveryLogSize is the number of delivery attempts kept per subscription.
+const DeliveryLogSize = 500
+
+// RecordDeliveryAttempt adds an attempt to its subscription's delivery log,
+// dropping the oldest once the log holds DeliveryLogSize attempts.
+func (m *MemoryStore) RecordDeliveryAttempt(a models.DeliveryAttempt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := append(m.deliveries[a.Attributes.SubscriptionID], a)
+	if n := len(entries) - DeliveryLogSize; n > 0 {
+		entries = append(entries[:0:0], entries[n:]...)
+	}
+	m.deliveries[a.Attributes.SubscriptionID] = entries
+}
+
+// ListDeliveryAttempts returns a subscription's delivery log, oldest first.
+func (m *MemoryStore) ListDeliveryAttempts(subscriptionID string) []models.DeliveryAttempt {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]models.DeliveryAttempt(nil), m.deliveries[subscriptionID]...)
+}
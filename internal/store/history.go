@@ -0,0 +1,30 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+func historyKey(resourceType string, path []string) string {
+	return resourceType + ":" + strings.Join(path, ":")
+}
+
+// RecordTransition appends t to the history of the resource of the given
+// type whose key is made of path, parents first.
+func (m *MemoryStore) RecordTransition(resourceType string, path []string, t models.StatusTransition) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := historyKey(resourceType, path)
+	m.history[k] = append(m.history[k], t)
+}
+
+// ListTransitions returns a resource's status history, oldest first.
+func (m *MemoryStore) ListTransitions(resourceType string, path []string) []models.StatusTransition {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h := m.history[historyKey(resourceType, path)]
+	out := make([]models.StatusTransition, len(h))
+	copy(out, h)
+	return out
+}
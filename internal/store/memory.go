@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/nibble/mock-fps/internal/ledger"
 	"github.com/nibble/mock-fps/internal/models"
 )
 
@@ -30,6 +31,13 @@ type MemoryStore struct {
 	reversals                 map[string]models.Reversal                 // "paymentID:reversalID"
 	reversalSubmissions       map[string]models.ReversalSubmission       // "paymentID:reversalID:submissionID"
 	subscriptions             map[string]models.Subscription
+	history                   map[string][]models.StatusTransition // "resourceType:paymentID:...:id"
+	accounts                  map[string]models.Account            // "sortCode:accountNumber"
+	ledger                    *ledger.Ledger
+	deadLetters               map[string]models.DeadLetter
+	deliveries                map[string][]models.DeliveryAttempt // by subscription ID, oldest first
+
+	rule TransitionRule
 }
 
 // NewMemoryStore creates a new in-memory store.
@@ -48,6 +56,11 @@ func NewMemoryStore() *MemoryStore {
 		reversals:                 make(map[string]models.Reversal),
 		reversalSubmissions:       make(map[string]models.ReversalSubmission),
 		subscriptions:             make(map[string]models.Subscription),
+		history:                   make(map[string][]models.StatusTransition),
+		accounts:                  make(map[string]models.Account),
+		ledger:                    ledger.New(),
+		deadLetters:               make(map[string]models.DeadLetter),
+		deliveries:                make(map[string][]models.DeliveryAttempt),
 	}
 }
 
@@ -137,9 +150,13 @@ func (m *MemoryStore) UpdatePaymentSubmission(paymentID string, s models.Payment
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key2(paymentID, s.ID)
-	if _, ok := m.paymentSubmissions[k]; !ok {
+	prev, ok := m.paymentSubmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypePaymentSubmission, prev.Attributes.Status, s.Attributes.Status); err != nil {
+		return err
+	}
 	m.paymentSubmissions[k] = s
 	return nil
 }
@@ -184,9 +201,13 @@ func (m *MemoryStore) UpdatePaymentAdmission(paymentID string, a models.PaymentA
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key2(paymentID, a.ID)
-	if _, ok := m.paymentAdmissions[k]; !ok {
+	prev, ok := m.paymentAdmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypePaymentAdmission, prev.Attributes.Status, a.Attributes.Status); err != nil {
+		return err
+	}
 	m.paymentAdmissions[k] = a
 	return nil
 }
@@ -214,6 +235,19 @@ func (m *MemoryStore) GetAdmissionTask(paymentID, admissionID, taskID string) (m
 	return t, nil
 }
 
+func (m *MemoryStore) ListAdmissionTasks(paymentID, admissionID string) []models.AdmissionTask {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix := key2(paymentID, admissionID) + ":"
+	var out []models.AdmissionTask
+	for k, v := range m.admissionTasks {
+		if len(k) > len(prefix) && k[:len(prefix)] == prefix {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func (m *MemoryStore) UpdateAdmissionTask(paymentID, admissionID string, t models.AdmissionTask) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -261,6 +295,21 @@ func (m *MemoryStore) ListReturns(paymentID string) []models.ReturnPayment {
 	return out
 }
 
+func (m *MemoryStore) UpdateReturn(paymentID string, r models.ReturnPayment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key2(paymentID, r.ID)
+	prev, ok := m.returns[k]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := m.checkTransition(models.ResourceTypeReturnPayment, prev.Attributes.SchemeStatus, r.Attributes.SchemeStatus); err != nil {
+		return err
+	}
+	m.returns[k] = r
+	return nil
+}
+
 // --- Return Submissions ---
 
 func (m *MemoryStore) CreateReturnSubmission(paymentID, returnID string, s models.ReturnSubmission) error {
@@ -301,9 +350,13 @@ func (m *MemoryStore) UpdateReturnSubmission(paymentID, returnID string, s model
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key3(paymentID, returnID, s.ID)
-	if _, ok := m.returnSubmissions[k]; !ok {
+	prev, ok := m.returnSubmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypeReturnSubmission, prev.Attributes.Status, s.Attributes.Status); err != nil {
+		return err
+	}
 	m.returnSubmissions[k] = s
 	return nil
 }
@@ -344,6 +397,21 @@ func (m *MemoryStore) ListRecalls(paymentID string) []models.Recall {
 	return out
 }
 
+func (m *MemoryStore) UpdateRecall(paymentID string, r models.Recall) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key2(paymentID, r.ID)
+	prev, ok := m.recalls[k]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := m.checkTransition(models.ResourceTypeRecall, prev.Attributes.Status, r.Attributes.Status); err != nil {
+		return err
+	}
+	m.recalls[k] = r
+	return nil
+}
+
 // --- Recall Submissions ---
 
 func (m *MemoryStore) CreateRecallSubmission(paymentID, recallID string, s models.RecallSubmission) error {
@@ -384,9 +452,13 @@ func (m *MemoryStore) UpdateRecallSubmission(paymentID, recallID string, s model
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key3(paymentID, recallID, s.ID)
-	if _, ok := m.recallSubmissions[k]; !ok {
+	prev, ok := m.recallSubmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypeRecallSubmission, prev.Attributes.Status, s.Attributes.Status); err != nil {
+		return err
+	}
 	m.recallSubmissions[k] = s
 	return nil
 }
@@ -467,9 +539,13 @@ func (m *MemoryStore) UpdateRecallDecisionSubmission(paymentID, recallID, decisi
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key4(paymentID, recallID, decisionID, s.ID)
-	if _, ok := m.recallDecisionSubmissions[k]; !ok {
+	prev, ok := m.recallDecisionSubmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypeRecallDecisionSubmission, prev.Attributes.Status, s.Attributes.Status); err != nil {
+		return err
+	}
 	m.recallDecisionSubmissions[k] = s
 	return nil
 }
@@ -510,6 +586,21 @@ func (m *MemoryStore) ListReversals(paymentID string) []models.Reversal {
 	return out
 }
 
+func (m *MemoryStore) UpdateReversal(paymentID string, r models.Reversal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key2(paymentID, r.ID)
+	prev, ok := m.reversals[k]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := m.checkTransition(models.ResourceTypeReversal, prev.Attributes.Status, r.Attributes.Status); err != nil {
+		return err
+	}
+	m.reversals[k] = r
+	return nil
+}
+
 // --- Reversal Submissions ---
 
 func (m *MemoryStore) CreateReversalSubmission(paymentID, reversalID string, s models.ReversalSubmission) error {
@@ -550,9 +641,13 @@ func (m *MemoryStore) UpdateReversalSubmission(paymentID, reversalID string, s m
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	k := key3(paymentID, reversalID, s.ID)
-	if _, ok := m.reversalSubmissions[k]; !ok {
+	prev, ok := m.reversalSubmissions[k]
+	if !ok {
 		return ErrNotFound
 	}
+	if err := m.checkTransition(models.ResourceTypeReversalSubmission, prev.Attributes.Status, s.Attributes.Status); err != nil {
+		return err
+	}
 	m.reversalSubmissions[k] = s
 	return nil
 }
@@ -606,6 +701,7 @@ func (m *MemoryStore) DeleteSubscription(id string) error {
 		return ErrNotFound
 	}
 	delete(m.subscriptions, id)
+	delete(m.deliveries, id)
 	return nil
 }
 
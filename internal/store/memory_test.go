@@ -1,6 +1,9 @@
 package store
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -190,3 +193,147 @@ func TestNestedResourceKeys(t *testing.T) {
 		t.Errorf("expected accepted, got %s", gotDS.Attributes.Status)
 	}
 }
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := NewMemoryStore()
+	s.CreatePayment(newPayment("p1"))
+	s.CreatePaymentSubmission("p1", models.PaymentSubmission{
+		Resource:   models.Resource{ID: "s1", Type: models.ResourceTypePaymentSubmission},
+		Attributes: models.PaymentSubmissionAttributes{Status: "limit_check_pending"},
+	})
+
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := s.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile: %v", err)
+	}
+
+	restored := NewMemoryStore()
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if _, err := restored.GetPayment("p1"); err != nil {
+		t.Errorf("GetPayment after restore: %v", err)
+	}
+	sub, err := restored.GetPaymentSubmission("p1", "s1")
+	if err != nil {
+		t.Fatalf("GetPaymentSubmission after restore: %v", err)
+	}
+	if sub.Attributes.Status != "limit_check_pending" {
+		t.Errorf("expected limit_check_pending, got %s", sub.Attributes.Status)
+	}
+}
+
+func TestTransitionRuleAndFindResource(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetTransitionRule(func(resourceType, from, to string) bool {
+		return from == "accepted" && to == "validation_pending"
+	})
+	sub := models.PaymentSubmission{
+		Resource:   models.Resource{ID: "s1", Type: models.ResourceTypePaymentSubmission},
+		Attributes: models.PaymentSubmissionAttributes{Status: "accepted"},
+	}
+	s.CreatePaymentSubmission("p1", sub)
+
+	sub.Attributes.Status = "submitted"
+	if err := s.UpdatePaymentSubmission("p1", sub); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected ErrInvalidTransition, got %v", err)
+	}
+	sub.Attributes.Status = "validation_pending"
+	if err := s.UpdatePaymentSubmission("p1", sub); err != nil {
+		t.Fatalf("legal update: %v", err)
+	}
+	// Updates that leave the status alone are always allowed.
+	if err := s.UpdatePaymentSubmission("p1", sub); err != nil {
+		t.Errorf("same-status update: %v", err)
+	}
+
+	path, status, err := s.FindResource(models.ResourceTypePaymentSubmission, "s1")
+	if err != nil {
+		t.Fatalf("FindResource: %v", err)
+	}
+	if len(path) != 2 || path[0] != "p1" || path[1] != "s1" || status != "validation_pending" {
+		t.Errorf("unexpected lookup %v %s", path, status)
+	}
+	if _, _, err := s.FindResource(models.ResourceTypeReturnSubmission, "s1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the wrong type, got %v", err)
+	}
+	s.CreatePaymentSubmission("p2", sub)
+	if _, _, err := s.FindResource(models.ResourceTypePaymentSubmission, "s1"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("expected ErrAmbiguous for an ID under two payments, got %v", err)
+	}
+}
+
+func TestLoadAccountsFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "accounts.json")
+	os.WriteFile(fn, []byte(`{"accounts": [
+  {"sort_code": "400300", "account_number": "12345678", "state": "open"},
+  {"sort_code": "400300", "account_number": "87654321", "state": "frozen"},
+  {"sort_code": "400300", "account_number": "11223344"}
+]}`), 0o644)
+
+	s := NewMemoryStore()
+	n, err := s.LoadAccountsFile(fn)
+	if err != nil || n != 3 {
+		t.Fatalf("LoadAccountsFile: %d, %v", n, err)
+	}
+	a, err := s.GetAccount("400300", "87654321")
+	if err != nil || a.State != models.AccountStateFrozen {
+		t.Errorf("GetAccount: %+v, %v", a, err)
+	}
+	if a, err := s.GetAccount("400300", "11223344"); err != nil || a.State != models.AccountStateOpen {
+		t.Errorf("expected an account without a state to be open, got %+v, %v", a, err)
+	}
+
+	os.WriteFile(fn, []byte(`{"accounts": [{"sort_code": "400300", "account_number": "1", "state": "open"}, {"sort_code": "400300", "state": "open"}]}`), 0o644)
+	if _, err := s.LoadAccountsFile(fn); !errors.Is(err, ErrInvalidAccount) {
+		t.Errorf("expected ErrInvalidAccount, got %v", err)
+	}
+	if len(s.ListAccounts()) != 3 {
+		t.Errorf("invalid file must not add accounts, have %d", len(s.ListAccounts()))
+	}
+}
+
+func TestGetResource(t *testing.T) {
+	s := NewMemoryStore()
+	p := newPayment("p1")
+	p.OrganisationID = "org-1"
+	s.CreatePayment(p)
+	s.CreatePaymentSubmission("p1", models.PaymentSubmission{Resource: models.Resource{ID: "sub-1", OrganisationID: "org-2"}})
+	// The same submission ID under another payment must not be confused
+	// with the first.
+	s.CreatePayment(newPayment("p2"))
+	s.CreatePaymentSubmission("p2", models.PaymentSubmission{Resource: models.Resource{ID: "sub-1", OrganisationID: "org-3"}})
+
+	v, org, err := s.GetResource(models.ResourceTypePayment, []string{"p1"})
+	if err != nil || org != "org-1" || v.(models.Payment).ID != "p1" {
+		t.Errorf("payment: got %v, %q, %v", v, org, err)
+	}
+	for path, want := range map[[2]string]string{{"p1", "sub-1"}: "org-2", {"p2", "sub-1"}: "org-3"} {
+		v, org, err = s.GetResource(models.ResourceTypePaymentSubmission, path[:])
+		if err != nil || org != want || v.(models.PaymentSubmission).ID != "sub-1" {
+			t.Errorf("submission %v: got %v, %q, %v", path, v, org, err)
+		}
+	}
+	if _, _, err := s.GetResource(models.ResourceTypePaymentSubmission, []string{"sub-1"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound without the payment ID, got %v", err)
+	}
+	if _, _, err := s.GetResource(models.ResourceTypeRecall, []string{"p1", "sub-1"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeliveryLog(t *testing.T) {
+	s := NewMemoryStore()
+	s.CreateSubscription(models.Subscription{Resource: models.Resource{ID: "sub-1"}})
+	for i := range DeliveryLogSize + 2 {
+		s.RecordDeliveryAttempt(models.DeliveryAttempt{Attributes: models.DeliveryAttemptAttributes{SubscriptionID: "sub-1", Attempt: i}})
+	}
+	log := s.ListDeliveryAttempts("sub-1")
+	if len(log) != DeliveryLogSize || log[0].Attributes.Attempt != 2 {
+		t.Errorf("expected the newest %d attempts, got %d from attempt %d", DeliveryLogSize, len(log), log[0].Attributes.Attempt)
+	}
+	s.DeleteSubscription("sub-1")
+	if n := len(s.ListDeliveryAttempts("sub-1")); n != 0 {
+		t.Errorf("expected the log to go with the subscription, got %d attempts", n)
+	}
+}
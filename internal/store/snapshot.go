@@ -0,0 +1,109 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/nibble/mock-fps/internal/ledger"
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// snapshot is the on-disk form of a MemoryStore. Map keys are the store's
+// composite keys.
+type snapshot struct {
+	Payments                  map[string]models.Payment                  `json:"payments"`
+	PaymentSubmissions        map[string]models.PaymentSubmission        `json:"payment_submissions"`
+	PaymentAdmissions         map[string]models.PaymentAdmission         `json:"payment_admissions"`
+	AdmissionTasks            map[string]models.AdmissionTask            `json:"admission_tasks"`
+	Returns                   map[string]models.ReturnPayment            `json:"returns"`
+	ReturnSubmissions         map[string]models.ReturnSubmission         `json:"return_submissions"`
+	Recalls                   map[string]models.Recall                   `json:"recalls"`
+	RecallSubmissions         map[string]models.RecallSubmission         `json:"recall_submissions"`
+	RecallDecisions           map[string]models.RecallDecision           `json:"recall_decisions"`
+	RecallDecisionSubmissions map[string]models.RecallDecisionSubmission `json:"recall_decision_submissions"`
+	Reversals                 map[string]models.Reversal                 `json:"reversals"`
+	ReversalSubmissions       map[string]models.ReversalSubmission       `json:"reversal_submissions"`
+	Subscriptions             map[string]models.Subscription             `json:"subscriptions"`
+	History                   map[string][]models.StatusTransition       `json:"history"`
+	Accounts                  map[string]models.Account                  `json:"accounts"`
+	Ledger                    *ledger.Ledger                             `json:"ledger"`
+	DeadLetters               map[string]models.DeadLetter               `json:"dead_letters"`
+	Deliveries                map[string][]models.DeliveryAttempt        `json:"deliveries"`
+}
+
+// SaveFile writes the whole store to path, replacing it atomically.
+func (m *MemoryStore) SaveFile(path string) error {
+	m.mu.RLock()
+	data, err := json.Marshal(snapshot{
+		Payments:                  m.payments,
+		PaymentSubmissions:        m.paymentSubmissions,
+		PaymentAdmissions:         m.paymentAdmissions,
+		AdmissionTasks:            m.admissionTasks,
+		Returns:                   m.returns,
+		ReturnSubmissions:         m.returnSubmissions,
+		Recalls:                   m.recalls,
+		RecallSubmissions:         m.recallSubmissions,
+		RecallDecisions:           m.recallDecisions,
+		RecallDecisionSubmissions: m.recallDecisionSubmissions,
+		Reversals:                 m.reversals,
+		ReversalSubmissions:       m.reversalSubmissions,
+		Subscriptions:             m.subscriptions,
+		History:                   m.history,
+		Accounts:                  m.accounts,
+		Ledger:                    m.ledger,
+		DeadLetters:               m.deadLetters,
+		Deliveries:                m.deliveries,
+	})
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFile replaces the store's contents with a snapshot written by SaveFile.
+func (m *MemoryStore) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	load(m.payments, snap.Payments)
+	load(m.paymentSubmissions, snap.PaymentSubmissions)
+	load(m.paymentAdmissions, snap.PaymentAdmissions)
+	load(m.admissionTasks, snap.AdmissionTasks)
+	load(m.returns, snap.Returns)
+	load(m.returnSubmissions, snap.ReturnSubmissions)
+	load(m.recalls, snap.Recalls)
+	load(m.recallSubmissions, snap.RecallSubmissions)
+	load(m.recallDecisions, snap.RecallDecisions)
+	load(m.recallDecisionSubmissions, snap.RecallDecisionSubmissions)
+	load(m.reversals, snap.Reversals)
+	load(m.reversalSubmissions, snap.ReversalSubmissions)
+	load(m.subscriptions, snap.Subscriptions)
+	load(m.history, snap.History)
+	load(m.accounts, snap.Accounts)
+	load(m.deadLetters, snap.DeadLetters)
+	load(m.deliveries, snap.Deliveries)
+	if snap.Ledger == nil {
+		snap.Ledger = ledger.New()
+	}
+	m.ledger = snap.Ledger
+	return nil
+}
+
+func load[T any](dst, src map[string]T) {
+	clear(dst)
+	for k, v := range src {
+		dst[k] = v
+	}
+}
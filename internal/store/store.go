@@ -1,6 +1,9 @@
 package store
 
-import "github.com/nibble/mock-fps/internal/models"
+import (
+	"github.com/nibble/mock-fps/internal/ledger"
+	"github.com/nibble/mock-fps/internal/models"
+)
 
 // Store defines the storage interface for all resources.
 type Store interface {
@@ -25,12 +28,14 @@ type Store interface {
 	// Admission Tasks
 	CreateAdmissionTask(paymentID, admissionID string, t models.AdmissionTask) error
 	GetAdmissionTask(paymentID, admissionID, taskID string) (models.AdmissionTask, error)
+	ListAdmissionTasks(paymentID, admissionID string) []models.AdmissionTask
 	UpdateAdmissionTask(paymentID, admissionID string, t models.AdmissionTask) error
 
 	// Returns
 	CreateReturn(paymentID string, r models.ReturnPayment) error
 	GetReturn(paymentID, returnID string) (models.ReturnPayment, error)
 	ListReturns(paymentID string) []models.ReturnPayment
+	UpdateReturn(paymentID string, r models.ReturnPayment) error
 
 	// Return Submissions
 	CreateReturnSubmission(paymentID, returnID string, s models.ReturnSubmission) error
@@ -42,6 +47,7 @@ type Store interface {
 	CreateRecall(paymentID string, r models.Recall) error
 	GetRecall(paymentID, recallID string) (models.Recall, error)
 	ListRecalls(paymentID string) []models.Recall
+	UpdateRecall(paymentID string, r models.Recall) error
 
 	// Recall Submissions
 	CreateRecallSubmission(paymentID, recallID string, s models.RecallSubmission) error
@@ -64,6 +70,7 @@ type Store interface {
 	CreateReversal(paymentID string, r models.Reversal) error
 	GetReversal(paymentID, reversalID string) (models.Reversal, error)
 	ListReversals(paymentID string) []models.Reversal
+	UpdateReversal(paymentID string, r models.Reversal) error
 
 	// Reversal Submissions
 	CreateReversalSubmission(paymentID, reversalID string, s models.ReversalSubmission) error
@@ -78,4 +85,30 @@ type Store interface {
 	UpdateSubscription(s models.Subscription) error
 	DeleteSubscription(id string) error
 	MatchSubscriptions(recordType, eventType string) []models.Subscription
+
+	// Account registry
+	PutAccount(a models.Account) error
+	GetAccount(sortCode, accountNumber string) (models.Account, error)
+	ListAccounts() []models.Account
+	DeleteAccount(sortCode, accountNumber string) error
+	Ledger() *ledger.Ledger
+
+	// Webhook dead letters
+	CreateDeadLetter(d models.DeadLetter) error
+	GetDeadLetter(id string) (models.DeadLetter, error)
+	ListDeadLetters() []models.DeadLetter
+	DeleteDeadLetter(id string) error
+
+	// Webhook delivery log
+	RecordDeliveryAttempt(a models.DeliveryAttempt)
+	ListDeliveryAttempts(subscriptionID string) []models.DeliveryAttempt
+
+	// Lookup by ID alone
+	FindResource(resourceType, id string) ([]string, string, error)
+	GetResource(resourceType string, path []string) (any, string, error)
+	ResourceStatus(resourceType string, path []string) (string, error)
+
+	// Status history
+	RecordTransition(resourceType string, path []string, t models.StatusTransition)
+	ListTransitions(resourceType string, path []string) []models.StatusTransition
 }
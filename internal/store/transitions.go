@@ -0,0 +1,170 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// ErrInvalidTransition is returned when an update moves a resource to a
+// status its transition rule does not allow.
+var ErrInvalidTransition = fmt.Errorf("invalid status transition")
+
+// ErrAmbiguous is returned by FindResource when resources under different
+// parents share the ID.
+var ErrAmbiguous = fmt.Errorf("ambiguous resource ID")
+
+// TransitionRule reports whether a resource of the given type may move
+// from one status to another.
+type TransitionRule func(resourceType, from, to string) bool
+
+// SetTransitionRule makes status updates of resources with a lifecycle
+// subject to r. Without a rule any status change is accepted.
+func (m *MemoryStore) SetTransitionRule(r TransitionRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rule = r
+}
+
+// checkTransition must be called with m.mu held.
+func (m *MemoryStore) checkTransition(resourceType, from, to string) error {
+	if from == to || m.rule == nil || m.rule(resourceType, from, to) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s -> %s", ErrInvalidTransition, resourceType, from, to)
+}
+
+// FindResource looks up a resource with a lifecycle by its own ID. It returns
+// the IDs its key is made of, parents first, and its current status. IDs are
+// only unique under their parents, so ErrAmbiguous is returned if more than
+// one resource has the ID.
+func (m *MemoryStore) FindResource(resourceType, id string) ([]string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	switch resourceType {
+	case models.ResourceTypePaymentSubmission:
+		return find(m.paymentSubmissions, id, func(s models.PaymentSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypePaymentAdmission:
+		return find(m.paymentAdmissions, id, func(a models.PaymentAdmission) string { return a.Attributes.Status })
+	case models.ResourceTypeReturnSubmission:
+		return find(m.returnSubmissions, id, func(s models.ReturnSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeRecallSubmission:
+		return find(m.recallSubmissions, id, func(s models.RecallSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeRecallDecisionSubmission:
+		return find(m.recallDecisionSubmissions, id, func(s models.RecallDecisionSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeReversalSubmission:
+		return find(m.reversalSubmissions, id, func(s models.ReversalSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeReturnPayment:
+		return find(m.returns, id, func(r models.ReturnPayment) string { return r.Attributes.SchemeStatus })
+	case models.ResourceTypeRecall:
+		return find(m.recalls, id, func(r models.Recall) string { return r.Attributes.Status })
+	case models.ResourceTypeReversal:
+		return find(m.reversals, id, func(r models.Reversal) string { return r.Attributes.Status })
+	}
+	return nil, "", ErrNotFound
+}
+
+// ResourceStatus returns the current status of a resource with a lifecycle,
+// looked up by its type and key: the IDs of its parents and then its own.
+func (m *MemoryStore) ResourceStatus(resourceType string, path []string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id := strings.Join(path, ":")
+	switch resourceType {
+	case models.ResourceTypePaymentSubmission:
+		return statusOf(m.paymentSubmissions, id, func(s models.PaymentSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypePaymentAdmission:
+		return statusOf(m.paymentAdmissions, id, func(a models.PaymentAdmission) string { return a.Attributes.Status })
+	case models.ResourceTypeReturnSubmission:
+		return statusOf(m.returnSubmissions, id, func(s models.ReturnSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeRecallSubmission:
+		return statusOf(m.recallSubmissions, id, func(s models.RecallSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeRecallDecisionSubmission:
+		return statusOf(m.recallDecisionSubmissions, id, func(s models.RecallDecisionSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeReversalSubmission:
+		return statusOf(m.reversalSubmissions, id, func(s models.ReversalSubmission) string { return s.Attributes.Status })
+	case models.ResourceTypeReturnPayment:
+		return statusOf(m.returns, id, func(r models.ReturnPayment) string { return r.Attributes.SchemeStatus })
+	case models.ResourceTypeRecall:
+		return statusOf(m.recalls, id, func(r models.Recall) string { return r.Attributes.Status })
+	case models.ResourceTypeReversal:
+		return statusOf(m.reversals, id, func(r models.Reversal) string { return r.Attributes.Status })
+	}
+	return "", ErrNotFound
+}
+
+// GetResource looks up any resource by its type and key: the IDs of its
+// parents and then its own. It returns the resource and its organisation ID.
+func (m *MemoryStore) GetResource(resourceType string, path []string) (any, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id := strings.Join(path, ":")
+	switch resourceType {
+	case models.ResourceTypePayment:
+		return lookup(m.payments, id, func(p models.Payment) string { return p.OrganisationID })
+	case models.ResourceTypePaymentSubmission:
+		return lookup(m.paymentSubmissions, id, func(s models.PaymentSubmission) string { return s.OrganisationID })
+	case models.ResourceTypePaymentAdmission:
+		return lookup(m.paymentAdmissions, id, func(a models.PaymentAdmission) string { return a.OrganisationID })
+	case models.ResourceTypeAdmissionTask:
+		return lookup(m.admissionTasks, id, func(t models.AdmissionTask) string { return t.OrganisationID })
+	case models.ResourceTypeReturnPayment:
+		return lookup(m.returns, id, func(r models.ReturnPayment) string { return r.OrganisationID })
+	case models.ResourceTypeReturnSubmission:
+		return lookup(m.returnSubmissions, id, func(s models.ReturnSubmission) string { return s.OrganisationID })
+	case models.ResourceTypeRecall:
+		return lookup(m.recalls, id, func(r models.Recall) string { return r.OrganisationID })
+	case models.ResourceTypeRecallSubmission:
+		return lookup(m.recallSubmissions, id, func(s models.RecallSubmission) string { return s.OrganisationID })
+	case models.ResourceTypeRecallDecision:
+		return lookup(m.recallDecisions, id, func(d models.RecallDecision) string { return d.OrganisationID })
+	case models.ResourceTypeRecallDecisionSubmission:
+		return lookup(m.recallDecisionSubmissions, id, func(s models.RecallDecisionSubmission) string { return s.OrganisationID })
+	case models.ResourceTypeReversal:
+		return lookup(m.reversals, id, func(r models.Reversal) string { return r.OrganisationID })
+	case models.ResourceTypeReversalSubmission:
+		return lookup(m.reversalSubmissions, id, func(s models.ReversalSubmission) string { return s.OrganisationID })
+	case models.ResourceTypeSubscription:
+		return lookup(m.subscriptions, id, func(s models.Subscription) string { return s.OrganisationID })
+	}
+	return nil, "", ErrNotFound
+}
+
+// lookup returns the entry of items under key.
+func lookup[T any](items map[string]T, key string, org func(T) string) (any, string, error) {
+	v, ok := items[key]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	return v, org(v), nil
+}
+
+// statusOf returns the status of the entry of items under key.
+func statusOf[T any](items map[string]T, key string, status func(T) string) (string, error) {
+	v, ok := items[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return status(v), nil
+}
+
+// find scans a map keyed by "parentID:...:id" for the entry ending in id.
+func find[T any](items map[string]T, id string, status func(T) string) ([]string, string, error) {
+	suffix := ":" + id
+	var path []string
+	var current string
+	for k, v := range items {
+		if !strings.HasSuffix(k, suffix) {
+			continue
+		}
+		if path != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrAmbiguous, id)
+		}
+		path, current = strings.Split(k, ":"), status(v)
+	}
+	if path == nil {
+		return nil, "", ErrNotFound
+	}
+	return path, current, nil
+}
@@ -2,101 +2,509 @@ package webhook
 
 import (
 	"bytes"
+	"container/list"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/clock"
 	"github.com/nibble/mock-fps/internal/models"
 	"github.com/nibble/mock-fps/internal/store"
 )
 
+// ErrClosed is returned when redriving a dead letter after Close.
+var ErrClosed = errors.New("webhook: dispatcher closed")
+
+// responseSnippet is how much of a response body the delivery log keeps.
+const responseSnippet = 1024
+
+// rememberedResources is how many resources the dispatcher keeps the last
+// notified version of, for notifications that include the previous one.
+const rememberedResources = 10000
+
 type notification struct {
 	resourceType string
-	resourceID   string
+	path         []string // the resource's key, parents first
 	eventType    string
+	status       string // set for updates that changed the status
+	byStatus     bool   // also notify subscriptions to the status
+	seq          uint64 // order in which Notify was called
+}
+
+// notified is the version of a resource sent in its latest notification.
+type notified struct {
+	key      string
+	seq      uint64
+	resource any
+}
+
+// delivery is a notification on its way to one subscriber. The notification
+// keeps its ID across attempts so that subscribers can drop duplicates.
+type delivery struct {
+	sub      models.Subscription
+	payload  models.Notification
+	body     []byte
+	attempts int
+
+	lastErr    string
+	lastStatus int
+	due        time.Time // of the next attempt, on the dispatcher's clock
 }
 
-// Dispatcher handles webhook notification delivery.
+// Dispatcher handles webhook notification delivery. Deliveries that fail are
+// retried according to its RetryPolicy, timed by its clock; once the attempts
+// run out the notification is parked in the store as a dead letter.
 type Dispatcher struct {
 	store  store.Store
+	clock  clock.Clock
 	ch     chan notification
 	client *http.Client
+
+	mu           sync.RWMutex // guards closed against sends on a closed channel, and retries
+	closed       bool
+	policy       RetryPolicy
+	statusEvents bool
+	retries      map[*delivery]bool // waiting for their next attempt
+	wake         chan struct{}
+	workers      sync.WaitGroup // workers and the retry scheduler
+	inflight     sync.WaitGroup // retries and redrives being attempted
+
+	lastMu sync.Mutex
+	seq    uint64
+	last   map[string]*list.Element // of *notified, by "type:path"
+	recent *list.List               // most recently notified first
 }
 
-// NewDispatcher creates a new webhook dispatcher.
-func NewDispatcher(s store.Store, bufferSize, workers int) *Dispatcher {
+// NewDispatcher creates a new webhook dispatcher that retries with
+// DefaultRetryPolicy.
+func NewDispatcher(s store.Store, clk clock.Clock, bufferSize, workers int) *Dispatcher {
 	d := &Dispatcher{
 		store: s,
+		clock: clk,
 		ch:    make(chan notification, bufferSize),
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		policy:  DefaultRetryPolicy,
+		retries: make(map[*delivery]bool),
+		wake:    make(chan struct{}, 1),
+		last:    make(map[string]*list.Element),
+		recent:  list.New(),
 	}
+	d.workers.Add(workers + 1)
+	go d.schedule()
 	for i := 0; i < workers; i++ {
 		go d.worker()
 	}
 	return d
 }
 
-// Notify enqueues a notification for delivery.
-func (d *Dispatcher) Notify(resourceType, resourceID, eventType string) {
+// ClockChanged must be called after the dispatcher's clock is frozen,
+// unfrozen or moved, so that retries are timed by the new reading.
+func (d *Dispatcher) ClockChanged() {
 	select {
-	case d.ch <- notification{resourceType: resourceType, resourceID: resourceID, eventType: eventType}:
+	case d.wake <- struct{}{}:
 	default:
-		log.Printf("webhook: notification buffer full, dropping %s %s %s", resourceType, resourceID, eventType)
+	}
+}
+
+// SetRetryPolicy replaces the retry policy for attempts scheduled from now on.
+func (d *Dispatcher) SetRetryPolicy(p RetryPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policy = p
+	return nil
+}
+
+// SetStatusEventTypes makes status changes notified from now on also go to
+// subscriptions whose event_type is the new status, as a notification with
+// that event type. This is how notifications worked before there were
+// created and updated events.
+func (d *Dispatcher) SetStatusEventTypes(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statusEvents = on
+}
+
+// Notify enqueues a notification of a created or updated resource for
+// delivery. The resource is identified by its key, path, of which its own ID
+// is the last element. For updates that changed the resource's status, status
+// is the new status; it is sent in the notification. Notifications sent after
+// Close are dropped.
+func (d *Dispatcher) Notify(resourceType string, path []string, eventType, status string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		log.Printf("webhook: dispatcher closed, dropping %s %v %s", resourceType, path, eventType)
+		return
+	}
+	d.lastMu.Lock()
+	d.seq++
+	seq := d.seq
+	d.lastMu.Unlock()
+	n := notification{resourceType: resourceType, path: path, eventType: eventType, status: status, byStatus: d.statusEvents && status != "", seq: seq}
+	select {
+	case d.ch <- n:
+	default:
+		log.Printf("webhook: notification buffer full, dropping %s %v %s", resourceType, path, eventType)
 	}
 }
 
 func (d *Dispatcher) worker() {
+	defer d.workers.Done()
 	for n := range d.ch {
 		d.deliver(n)
 	}
 }
 
+// variant is one form of a notification: the event type it is sent as and
+// what it carries.
+type variant struct {
+	eventType    string
+	full         bool
+	withPrevious bool
+}
+
 func (d *Dispatcher) deliver(n notification) {
-	subs := d.store.MatchSubscriptions(n.resourceType, n.eventType)
-	if len(subs) == 0 {
+	// Subscriptions by the event type they are notified with.
+	subs := map[string][]models.Subscription{n.eventType: d.store.MatchSubscriptions(n.resourceType, n.eventType)}
+	if n.byStatus {
+		subs[n.status] = d.store.MatchSubscriptions(n.resourceType, n.status)
+	}
+	if len(subs[n.eventType]) == 0 && len(subs[n.status]) == 0 {
 		return
 	}
 
-	payload := models.Notification{
-		ID:        uuid.New().String(),
-		Type:      "notifications",
-		Version:   0,
-		CreatedOn: time.Now().UTC(),
+	resource, orgID, previous := d.read(n)
+
+	thin := models.Notification{
+		ID:             uuid.New().String(),
+		OrganisationID: orgID,
+		Type:           "notifications",
+		Version:        0,
+		CreatedOn:      d.clock.Now().UTC(),
 		Data: models.NotificationData{
 			RecordType: n.resourceType,
-			EventType:  n.eventType,
-			ResourceID: n.resourceID,
+			ResourceID: n.path[len(n.path)-1],
+			Status:     n.status,
 		},
 	}
 
-	body, err := json.Marshal(payload)
+	// Subscriptions get one of a few variants of the same notification.
+	bodies := make(map[variant][]byte)
+	for eventType, matched := range subs {
+		for _, sub := range matched {
+			v := variant{eventType: eventType, full: sub.Attributes.Payload == models.PayloadFull}
+			v.withPrevious = v.full && sub.Attributes.IncludePrevious
+			payload := thin
+			payload.Data.EventType = eventType
+			if v.full {
+				payload.Data.Payload = resource
+			}
+			if v.withPrevious {
+				payload.Data.PreviousPayload = previous
+			}
+			body, ok := bodies[v]
+			if !ok {
+				var err error
+				if body, err = json.Marshal(payload); err != nil {
+					log.Printf("webhook: marshal error: %v", err)
+					return
+				}
+				bodies[v] = body
+			}
+			d.attempt(&delivery{sub: sub, payload: payload, body: body})
+		}
+	}
+}
+
+// read returns the resource n is about, its organisation ID and the version
+// of it sent in the notification before, if that is still remembered. The
+// resource is read now rather than when the change happened, so a
+// notification that waited in the queue carries the latest version. A
+// notification overtaken by a later one of the same resource, on another
+// worker, carries no previous version rather than one newer than its own.
+func (d *Dispatcher) read(n notification) (resource any, orgID string, previous any) {
+	key := n.resourceType + ":" + strings.Join(n.path, ":")
+	d.lastMu.Lock()
+	defer d.lastMu.Unlock()
+	resource, orgID, err := d.store.GetResource(n.resourceType, n.path)
 	if err != nil {
-		log.Printf("webhook: marshal error: %v", err)
+		resource = nil
+	}
+	e, ok := d.last[key]
+	if ok {
+		last := e.Value.(*notified)
+		if last.seq > n.seq {
+			return resource, orgID, nil
+		}
+		previous = last.resource
+		if resource == nil {
+			d.recent.Remove(e)
+			delete(d.last, key)
+			return resource, orgID, previous
+		}
+		last.seq, last.resource = n.seq, resource
+		d.recent.MoveToFront(e)
+		return resource, orgID, previous
+	}
+	if resource != nil {
+		d.last[key] = d.recent.PushFront(&notified{key: key, seq: n.seq, resource: resource})
+		if d.recent.Len() > rememberedResources {
+			oldest := d.recent.Back()
+			d.recent.Remove(oldest)
+			delete(d.last, oldest.Value.(*notified).key)
+		}
+	}
+	return resource, orgID, nil
+}
+
+// attempt posts a delivery once, and on failure schedules the next attempt
+// or dead-letters it.
+func (d *Dispatcher) attempt(del *delivery) {
+	del.attempts++
+	// Sign with the subscription's keys as they are now, in case they have
+	// been rotated since the first attempt.
+	if sub, err := d.store.GetSubscription(del.sub.ID); err == nil {
+		del.sub.Attributes.SigningKeys = sub.Attributes.SigningKeys
+	}
+	ex, err := d.post(del.sub, del.body)
+	d.record(del, ex, err)
+	if err == nil {
 		return
 	}
+	del.lastErr, del.lastStatus = err.Error(), ex.status
+	log.Printf("webhook: delivery %d of %s to %s failed: %v", del.attempts, del.payload.ID, del.sub.Attributes.CallbackURI, err)
 
-	for _, sub := range subs {
-		req, err := http.NewRequest(http.MethodPost, sub.Attributes.CallbackURI, bytes.NewReader(body))
-		if err != nil {
-			log.Printf("webhook: request build error for %s: %v", sub.Attributes.CallbackURI, err)
-			continue
+	d.mu.Lock()
+	if d.closed || del.attempts >= d.policy.MaxAttempts {
+		d.mu.Unlock()
+		d.deadLetter(del)
+		return
+	}
+	del.due = d.clock.Now().Add(d.policy.Backoff(del.attempts))
+	d.retries[del] = true
+	d.mu.Unlock()
+	d.ClockChanged()
+}
+
+// schedule is the goroutine that makes the next attempt of each delivery
+// whose backoff has passed on the dispatcher's clock. It sleeps on one timer
+// set for the earliest of them, and stops once the dispatcher is closed.
+func (d *Dispatcher) schedule() {
+	defer d.workers.Done()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		d.mu.Lock()
+		if d.closed {
+			d.mu.Unlock()
+			timer.Stop()
+			return
+		}
+		now := d.clock.Now()
+		wait := time.Duration(-1)
+		for del := range d.retries {
+			if left := del.due.Sub(now); left > 0 {
+				if wait < 0 || left < wait {
+					wait = left
+				}
+				continue
+			}
+			delete(d.retries, del)
+			d.inflight.Add(1)
+			go func() {
+				defer d.inflight.Done()
+				d.attempt(del)
+			}()
 		}
-		req.Header.Set("Content-Type", "application/json")
+		d.mu.Unlock()
 
-		resp, err := d.client.Do(req)
-		if err != nil {
-			log.Printf("webhook: delivery error to %s: %v", sub.Attributes.CallbackURI, err)
-			continue
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-d.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// exchange is what passed between the dispatcher and a subscriber in one
+// attempt, as far as it got.
+type exchange struct {
+	header   http.Header
+	status   int
+	response []byte // the first responseSnippet bytes of the body
+	latency  time.Duration
+}
+
+// post sends body to a subscriber, signed with its keys. Transport errors,
+// timeouts and non-2xx responses are failures.
+func (d *Dispatcher) post(sub models.Subscription, body []byte) (exchange, error) {
+	var ex exchange
+	req, err := http.NewRequest(http.MethodPost, sub.Attributes.CallbackURI, bytes.NewReader(body))
+	if err != nil {
+		return ex, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := Sign(req, body, sub.Attributes.SigningKeys, d.clock.Now()); err != nil {
+		return ex, err
+	}
+	ex.header = req.Header.Clone()
+
+	// Latency is measured in wall time, whatever the dispatcher's clock.
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		ex.latency = time.Since(start)
+		return ex, err
+	}
+	ex.response, _ = io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	ex.latency = time.Since(start)
+	ex.status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ex, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ex, nil
+}
+
+// record adds an attempt to the subscription's delivery log.
+func (d *Dispatcher) record(del *delivery, ex exchange, err error) {
+	now := d.clock.Now().UTC()
+	a := models.DeliveryAttempt{
+		Resource: models.Resource{
+			Type:           models.ResourceTypeDeliveryAttempt,
+			ID:             uuid.New().String(),
+			OrganisationID: del.sub.OrganisationID,
+			CreatedOn:      now,
+			ModifiedOn:     now,
+		},
+		Attributes: models.DeliveryAttemptAttributes{
+			NotificationID:     del.payload.ID,
+			SubscriptionID:     del.sub.ID,
+			CallbackURI:        del.sub.Attributes.CallbackURI,
+			Attempt:            del.attempts,
+			Outcome:            models.DeliverySucceeded,
+			AttemptedOn:        now,
+			LatencyMs:          ex.latency.Milliseconds(),
+			RequestHeaders:     ex.header,
+			RequestBody:        del.body,
+			ResponseStatusCode: ex.status,
+			ResponseBody:       string(ex.response),
+		},
+	}
+	if err != nil {
+		a.Attributes.Outcome = models.DeliveryFailed
+		a.Attributes.Error = err.Error()
+	}
+	d.store.RecordDeliveryAttempt(a)
+}
+
+// deadLetter parks a delivery that will not be attempted again.
+func (d *Dispatcher) deadLetter(del *delivery) {
+	now := d.clock.Now().UTC()
+	dl := models.DeadLetter{
+		Resource: models.Resource{
+			Type:           models.ResourceTypeDeadLetter,
+			ID:             uuid.New().String(),
+			OrganisationID: del.sub.OrganisationID,
+			CreatedOn:      now,
+			ModifiedOn:     now,
+		},
+		Attributes: models.DeadLetterAttributes{
+			SubscriptionID: del.sub.ID,
+			CallbackURI:    del.sub.Attributes.CallbackURI,
+			Notification:   del.payload,
+			Attempts:       del.attempts,
+			LastAttemptOn:  now,
+			LastError:      del.lastErr,
+			LastStatusCode: del.lastStatus,
+		},
+	}
+	if err := d.store.CreateDeadLetter(dl); err != nil {
+		log.Printf("webhook: failed to dead-letter %s: %v", del.payload.ID, err)
+		return
+	}
+	log.Printf("webhook: dead-lettered %s to %s after %d attempts", del.payload.ID, dl.Attributes.CallbackURI, del.attempts)
+}
+
+// Redrive takes a dead letter out of the store and delivers its notification
+// again, with a fresh set of attempts. It goes to the subscription's current
+// callback URI if the subscription still exists.
+func (d *Dispatcher) Redrive(id string) error {
+	dl, err := d.store.GetDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	sub, err := d.store.GetSubscription(dl.Attributes.SubscriptionID)
+	if err != nil {
+		sub = models.Subscription{
+			Resource:   models.Resource{ID: dl.Attributes.SubscriptionID, OrganisationID: dl.OrganisationID},
+			Attributes: models.SubscriptionAttributes{CallbackURI: dl.Attributes.CallbackURI},
 		}
-		resp.Body.Close()
 	}
+	body, err := json.Marshal(dl.Attributes.Notification)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	if err := d.store.DeleteDeadLetter(id); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	d.inflight.Add(1)
+	d.mu.Unlock()
+
+	go func() {
+		defer d.inflight.Done()
+		d.attempt(&delivery{sub: sub, payload: dl.Attributes.Notification, body: body})
+	}()
+	return nil
 }
 
-// Close shuts down the dispatcher.
+// Close stops accepting notifications and waits for queued ones to be
+// delivered. Deliveries still waiting to be retried, and ones that fail from
+// now on, are dead-lettered rather than retried.
 func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
 	close(d.ch)
+	d.mu.Unlock()
+	d.ClockChanged() // stops the retry scheduler
+	d.workers.Wait()
+	d.inflight.Wait()
+
+	d.mu.Lock()
+	pending := make([]*delivery, 0, len(d.retries))
+	for del := range d.retries {
+		pending = append(pending, del)
+	}
+	clear(d.retries)
+	d.mu.Unlock()
+	for _, del := range pending {
+		d.deadLetter(del)
+	}
 }
@@ -0,0 +1,339 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/clock"
+	"github.com/nibble/mock-fps/internal/models"
+	"github.com/nibble/mock-fps/internal/store"
+)
+
+// receiver is a subscriber that fails the first failures requests and
+// records the notification IDs it is sent.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	ids      []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var n models.Notification
+	json.NewDecoder(r.Body).Decode(&n)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.ids = append(rc.ids, n.ID)
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (rc *receiver) received() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]string(nil), rc.ids...)
+}
+
+func setup(t *testing.T, rc *receiver) (*store.MemoryStore, *Dispatcher) {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	s := store.NewMemoryStore()
+	s.CreateSubscription(models.Subscription{
+		Resource:   models.Resource{ID: "sub-1"},
+		Attributes: models.SubscriptionAttributes{CallbackURI: srv.URL, RecordType: "payments", EventType: "created", IsActive: true},
+	})
+	d := NewDispatcher(s, clock.Real{}, 10, 1)
+	if err := d.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}); err != nil {
+		t.Fatalf("SetRetryPolicy: %v", err)
+	}
+	return s, d
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	rc := &receiver{failures: 2}
+	s, d := setup(t, rc)
+	d.Notify("payments", []string{"p1"}, "created", "")
+	waitFor(t, "three attempts", func() bool { return len(rc.received()) == 3 })
+	d.Close()
+
+	ids := rc.received()
+	if ids[0] == "" || ids[1] != ids[0] || ids[2] != ids[0] {
+		t.Errorf("expected the same notification on every attempt, got %v", ids)
+	}
+	if dl := s.ListDeadLetters(); len(dl) != 0 {
+		t.Errorf("expected no dead letters, got %+v", dl)
+	}
+}
+
+func TestRetriesFollowClock(t *testing.T) {
+	rc := &receiver{failures: 1}
+	s, d := setup(t, rc)
+	vc := clock.NewVirtual()
+	vc.Freeze()
+	d.mu.Lock()
+	d.clock = vc
+	d.mu.Unlock()
+	d.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute, Multiplier: 2})
+	defer d.Close()
+	d.Notify("payments", []string{"p1"}, "created", "")
+	waitFor(t, "the first attempt", func() bool { return len(rc.received()) == 1 })
+
+	time.Sleep(20 * time.Millisecond)
+	if n := len(rc.received()); n != 1 {
+		t.Fatalf("expected no retry before the clock moves, got %d attempts", n)
+	}
+	vc.Advance(time.Minute)
+	d.ClockChanged()
+	waitFor(t, "the retry", func() bool { return len(rc.received()) == 2 })
+	if dl := s.ListDeadLetters(); len(dl) != 0 {
+		t.Errorf("expected no dead letters, got %+v", dl)
+	}
+}
+
+func TestDeadLetterAndRedrive(t *testing.T) {
+	rc := &receiver{failures: 3}
+	s, d := setup(t, rc)
+	defer d.Close()
+	d.Notify("payments", []string{"p1"}, "created", "")
+	waitFor(t, "a dead letter", func() bool { return len(s.ListDeadLetters()) == 1 })
+
+	dl := s.ListDeadLetters()[0]
+	if dl.Attributes.Attempts != 3 || dl.Attributes.LastStatusCode != http.StatusServiceUnavailable || dl.Attributes.SubscriptionID != "sub-1" {
+		t.Errorf("unexpected dead letter %+v", dl.Attributes)
+	}
+	if dl.Attributes.Notification.Data.ResourceID != "p1" {
+		t.Errorf("expected the notification for p1, got %+v", dl.Attributes.Notification)
+	}
+
+	if err := d.Redrive(dl.ID); err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	waitFor(t, "the redrive", func() bool { return len(rc.received()) == 4 })
+	if ids := rc.received(); ids[3] != dl.Attributes.Notification.ID {
+		t.Errorf("expected the redrive to resend %s, got %s", dl.Attributes.Notification.ID, ids[3])
+	}
+	if n := len(s.ListDeadLetters()); n != 0 {
+		t.Errorf("expected the dead letter to be gone, got %d", n)
+	}
+	if err := d.Redrive(dl.ID); err == nil {
+		t.Error("expected an error redriving a dead letter twice")
+	}
+}
+
+func TestCloseDeadLettersPendingRetries(t *testing.T) {
+	rc := &receiver{failures: 1}
+	s, d := setup(t, rc)
+	d.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2})
+	d.Notify("payments", []string{"p1"}, "created", "")
+	waitFor(t, "the first attempt", func() bool { return len(rc.received()) == 1 })
+	d.Close()
+	if dl := s.ListDeadLetters(); len(dl) != 1 || dl[0].Attributes.Attempts != 1 {
+		t.Errorf("expected the pending retry to be dead-lettered, got %+v", dl)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if got := p.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.Backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Backoff with jitter = %s, want within 1s-3s", got)
+		}
+	}
+	if err := (RetryPolicy{MaxAttempts: 0}).Validate(); err == nil {
+		t.Error("expected an error for no attempts")
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]models.Notification{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n models.Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		got[r.URL.Path] = append(got[r.URL.Path], n)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := store.NewMemoryStore()
+	for _, sub := range []models.SubscriptionAttributes{
+		{CallbackURI: srv.URL + "/thin"},
+		{CallbackURI: srv.URL + "/full", Payload: models.PayloadFull},
+		{CallbackURI: srv.URL + "/previous", Payload: models.PayloadFull, IncludePrevious: true},
+	} {
+		sub.RecordType, sub.EventType, sub.IsActive = "payments", "updated", true
+		s.CreateSubscription(models.Subscription{Resource: models.Resource{ID: sub.CallbackURI}, Attributes: sub})
+	}
+	p := models.Payment{
+		Resource:   models.Resource{Type: models.ResourceTypePayment, ID: "p1", OrganisationID: "org-1"},
+		Attributes: models.PaymentAttributes{Amount: "1.00", Status: models.PaymentStatusPending},
+	}
+	s.CreatePayment(p)
+
+	d := NewDispatcher(s, clock.Real{}, 10, 1)
+	d.Notify("payments", []string{"p1"}, "updated", "")
+	waitFor(t, "the first notifications", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got["/thin"])+len(got["/full"])+len(got["/previous"]) == 3
+	})
+	p.Attributes.Status = models.PaymentStatusDelivered
+	s.UpdatePayment(p)
+	d.Notify("payments", []string{"p1"}, "updated", "")
+	d.Close()
+
+	status := func(v any) string {
+		m, _ := v.(map[string]any)
+		attrs, _ := m["attributes"].(map[string]any)
+		s, _ := attrs["status"].(string)
+		return s
+	}
+	thin, full, previous := got["/thin"], got["/full"], got["/previous"]
+	if len(thin) != 2 || len(full) != 2 || len(previous) != 2 {
+		t.Fatalf("expected two notifications each, got %d/%d/%d", len(thin), len(full), len(previous))
+	}
+	if thin[1].Data.Payload != nil || thin[1].OrganisationID != "org-1" {
+		t.Errorf("thin: expected no payload and org-1, got %+v", thin[1])
+	}
+	if status(full[1].Data.Payload) != models.PaymentStatusDelivered || full[1].Data.PreviousPayload != nil {
+		t.Errorf("full: unexpected payload %+v", full[1].Data)
+	}
+	if previous[0].Data.PreviousPayload != nil {
+		t.Errorf("previous: expected nothing before the first notification, got %+v", previous[0].Data.PreviousPayload)
+	}
+	if status(previous[1].Data.PreviousPayload) != models.PaymentStatusPending || status(previous[1].Data.Payload) != models.PaymentStatusDelivered {
+		t.Errorf("previous: unexpected payloads %+v", previous[1].Data)
+	}
+	if thin[1].ID != full[1].ID || full[1].ID != previous[1].ID {
+		t.Error("expected every variant to share the notification ID")
+	}
+}
+
+func TestRememberedVersions(t *testing.T) {
+	s := store.NewMemoryStore()
+	d := NewDispatcher(s, clock.Real{}, 10, 1)
+	defer d.Close()
+	p := models.Payment{Resource: models.Resource{Type: models.ResourceTypePayment, ID: "p1"}}
+	s.CreatePayment(p)
+	n := func(seq uint64, id string) notification {
+		return notification{resourceType: models.ResourceTypePayment, path: []string{id}, seq: seq}
+	}
+
+	d.read(n(1, "p1"))
+	if _, _, previous := d.read(n(3, "p1")); previous == nil {
+		t.Error("expected the version sent first")
+	}
+	// Overtaken by the notification with sequence number 3.
+	if _, _, previous := d.read(n(2, "p1")); previous != nil {
+		t.Errorf("expected no previous version for a late notification, got %+v", previous)
+	}
+
+	for i := range rememberedResources + 1 {
+		p.ID = fmt.Sprintf("q%d", i)
+		s.CreatePayment(p)
+		d.read(n(uint64(10+i), p.ID))
+	}
+	if len(d.last) != rememberedResources || d.recent.Len() != rememberedResources {
+		t.Errorf("expected %d resources remembered, got %d", rememberedResources, len(d.last))
+	}
+	if _, ok := d.last["payments:p1"]; ok {
+		t.Error("expected the least recently notified resource to be forgotten")
+	}
+}
+
+func TestStatusEventTypes(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]models.Notification{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n models.Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		mu.Lock()
+		got[r.URL.Path] = append(got[r.URL.Path], n)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := store.NewMemoryStore()
+	for _, eventType := range []string{models.EventUpdated, models.StatusDeliveryConfirmed} {
+		s.CreateSubscription(models.Subscription{
+			Resource:   models.Resource{ID: eventType},
+			Attributes: models.SubscriptionAttributes{CallbackURI: srv.URL + "/" + eventType, RecordType: "payment_submissions", EventType: eventType, IsActive: true},
+		})
+	}
+
+	d := NewDispatcher(s, clock.Real{}, 10, 1)
+	d.Notify("payment_submissions", []string{"p1", "s1"}, models.EventUpdated, models.StatusDeliveryConfirmed)
+	d.SetStatusEventTypes(true)
+	d.Notify("payment_submissions", []string{"p1", "s1"}, models.EventUpdated, models.StatusDeliveryConfirmed)
+	d.Notify("payment_submissions", []string{"p1", "s1"}, models.EventUpdated, "")
+	d.Close()
+
+	updated, legacy := got["/updated"], got["/"+models.StatusDeliveryConfirmed]
+	if len(updated) != 3 {
+		t.Fatalf("expected three updated notifications, got %d", len(updated))
+	}
+	if n := updated[0].Data; n.EventType != models.EventUpdated || n.Status != models.StatusDeliveryConfirmed {
+		t.Errorf("expected an updated event with the status, got %+v", n)
+	}
+	if len(legacy) != 1 {
+		t.Fatalf("expected one notification by status once enabled, got %d", len(legacy))
+	}
+	if n := legacy[0].Data; n.EventType != models.StatusDeliveryConfirmed {
+		t.Errorf("expected the status as the event type, got %+v", n)
+	}
+}
+
+func TestDeliveryLog(t *testing.T) {
+	rc := &receiver{failures: 1}
+	s, d := setup(t, rc)
+	d.Notify("payments", []string{"p1"}, "created", "")
+	waitFor(t, "two attempts", func() bool { return len(rc.received()) == 2 })
+	d.Close()
+
+	log := s.ListDeliveryAttempts("sub-1")
+	if len(log) != 2 {
+		t.Fatalf("expected two logged attempts, got %d", len(log))
+	}
+	failed, succeeded := log[0].Attributes, log[1].Attributes
+	if failed.Outcome != models.DeliveryFailed || failed.Attempt != 1 || failed.ResponseStatusCode != http.StatusServiceUnavailable || failed.Error == "" {
+		t.Errorf("unexpected failed attempt %+v", failed)
+	}
+	if succeeded.Outcome != models.DeliverySucceeded || succeeded.Attempt != 2 || succeeded.ResponseStatusCode != http.StatusOK || succeeded.Error != "" {
+		t.Errorf("unexpected succeeded attempt %+v", succeeded)
+	}
+	if failed.NotificationID != rc.received()[0] || succeeded.NotificationID != failed.NotificationID {
+		t.Errorf("expected both attempts of %s, got %s and %s", rc.received()[0], failed.NotificationID, succeeded.NotificationID)
+	}
+	var n models.Notification
+	if err := json.Unmarshal(succeeded.RequestBody, &n); err != nil || n.ID != succeeded.NotificationID {
+		t.Errorf("expected the notification as the request body, got %s (%v)", succeeded.RequestBody, err)
+	}
+	if got := http.Header(succeeded.RequestHeaders).Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected the request headers, got %v", succeeded.RequestHeaders)
+	}
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how failed deliveries are retried. The wait before
+// attempt n+1 is InitialBackoff * Multiplier^(n-1), capped at MaxBackoff, then
+// moved up or down at random by up to Jitter of itself.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; 1 disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is a fraction between 0 and 1.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes five attempts over about half a minute.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Validate checks that the policy makes at least one attempt and that its
+// backoff is well formed.
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("webhook: max attempts must be at least 1, got %d", p.MaxAttempts)
+	case p.InitialBackoff < 0 || p.MaxBackoff < p.InitialBackoff:
+		return fmt.Errorf("webhook: backoff must satisfy 0 <= initial (%s) <= max (%s)", p.InitialBackoff, p.MaxBackoff)
+	case p.Multiplier < 1:
+		return fmt.Errorf("webhook: backoff multiplier must be at least 1, got %g", p.Multiplier)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("webhook: jitter must be between 0 and 1, got %g", p.Jitter)
+	}
+	return nil
+}
+
+// Backoff returns how long to wait after the given number of failed attempts.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	wait := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempts-1))
+	wait = min(wait, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		wait *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(wait)
+}
@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+// Headers set on signed notifications, besides Date.
+const (
+	// HeaderBodySignature carries one "key_id=<id>,sha256=<hex>" value per
+	// active HMAC key: the HMAC-SHA256 of the body.
+	HeaderBodySignature = "X-Webhook-Signature"
+	// HeaderContentDigest is the RFC 9530 SHA-256 digest of the body.
+	HeaderContentDigest = "Content-Digest"
+	// HeaderSignatureInput and HeaderSignature are the RFC 9421 message
+	// signatures, labelled sig1, sig2, ... one per active key.
+	HeaderSignatureInput = "Signature-Input"
+	HeaderSignature      = "Signature"
+)
+
+// signedComponents are the message components covered by the message
+// signatures.
+var signedComponents = []string{"@method", "@target-uri", "content-digest", "content-type", "date"}
+
+// ErrInvalidKey is returned by PrepareKey for unusable key material.
+var ErrInvalidKey = errors.New("invalid signing key")
+
+// PrepareKey checks a signing key supplied through the API and fills in what
+// was left out: a key ID, a random HMAC secret or Ed25519 key pair, and the
+// Ed25519 public key.
+func PrepareKey(k models.SigningKey) (models.SigningKey, error) {
+	if k.KeyID == "" {
+		k.KeyID = uuid.New().String()
+	}
+	if k.NotBefore != nil && k.NotAfter != nil && !k.NotBefore.Before(*k.NotAfter) {
+		return k, fmt.Errorf("%w: %s: not_before must be before not_after", ErrInvalidKey, k.KeyID)
+	}
+	switch k.Algorithm {
+	case models.SigningHMACSHA256:
+		if k.Secret == "" {
+			secret := make([]byte, 32)
+			rand.Read(secret)
+			k.Secret = base64.RawURLEncoding.EncodeToString(secret)
+		}
+	case models.SigningEd25519:
+		if k.PrivateKey == "" {
+			seed := make([]byte, ed25519.SeedSize)
+			rand.Read(seed)
+			k.PrivateKey = base64.StdEncoding.EncodeToString(seed)
+		}
+		priv, err := privateKey(k)
+		if err != nil {
+			return k, err
+		}
+		k.PublicKey = base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+	default:
+		return k, fmt.Errorf("%w: %s: unknown algorithm %q", ErrInvalidKey, k.KeyID, k.Algorithm)
+	}
+	return k, nil
+}
+
+// PrepareKeys runs PrepareKey over keys and checks that their IDs are unique.
+func PrepareKeys(keys []models.SigningKey) ([]models.SigningKey, error) {
+	seen := make(map[string]bool, len(keys))
+	out := make([]models.SigningKey, len(keys))
+	for i, k := range keys {
+		k, err := PrepareKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if seen[k.KeyID] {
+			return nil, fmt.Errorf("%w: duplicate key ID %s", ErrInvalidKey, k.KeyID)
+		}
+		seen[k.KeyID] = true
+		out[i] = k
+	}
+	return out, nil
+}
+
+// RotateKeys adds next to keys, active from now. Keys active now stay active
+// for the overlap window and then expire; keys that have already expired are
+// dropped.
+func RotateKeys(keys []models.SigningKey, next models.SigningKey, now time.Time, overlap time.Duration) ([]models.SigningKey, error) {
+	next.NotBefore = &now
+	expiry := now.Add(overlap)
+	out := make([]models.SigningKey, 0, len(keys)+1)
+	for _, k := range keys {
+		if k.NotAfter != nil && !now.Before(*k.NotAfter) {
+			continue
+		}
+		if k.ActiveAt(now) && (k.NotAfter == nil || k.NotAfter.After(expiry)) {
+			k.NotAfter = &expiry
+		}
+		out = append(out, k)
+	}
+	return PrepareKeys(append(out, next))
+}
+
+// Sign signs a notification request with the keys active at now. It sets
+// Date and Content-Digest, an HMAC body signature per HMAC key, and an
+// RFC 9421 message signature per key. Without active keys the request is
+// left unsigned.
+func Sign(req *http.Request, body []byte, keys []models.SigningKey, now time.Time) error {
+	var active []models.SigningKey
+	for _, k := range keys {
+		if k.ActiveAt(now) {
+			active = append(active, k)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	digest := sha256.Sum256(body)
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set(HeaderContentDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+
+	var inputs, signatures []string
+	for i, k := range active {
+		label := "sig" + strconv.Itoa(i+1)
+		params := signatureParams(k, now)
+		sig, err := signBytes(k, []byte(signatureBase(req, params)))
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, label+"="+params)
+		signatures = append(signatures, label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+		if k.Algorithm == models.SigningHMACSHA256 {
+			mac := hmac.New(sha256.New, []byte(k.Secret))
+			mac.Write(body)
+			req.Header.Add(HeaderBodySignature, "key_id="+k.KeyID+",sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+	}
+	req.Header.Set(HeaderSignatureInput, strings.Join(inputs, ", "))
+	req.Header.Set(HeaderSignature, strings.Join(signatures, ", "))
+	return nil
+}
+
+// signatureParams returns the @signature-params value for a key.
+func signatureParams(k models.SigningKey, now time.Time) string {
+	quoted := make([]string, len(signedComponents))
+	for i, c := range signedComponents {
+		quoted[i] = strconv.Quote(c)
+	}
+	return fmt.Sprintf("(%s);created=%d;keyid=%q;alg=%q", strings.Join(quoted, " "), now.Unix(), k.KeyID, k.Algorithm)
+}
+
+// signatureBase builds the RFC 9421 signature base of req.
+func signatureBase(req *http.Request, params string) string {
+	var b strings.Builder
+	for _, c := range signedComponents {
+		var v string
+		switch c {
+		case "@method":
+			v = req.Method
+		case "@target-uri":
+			v = req.URL.String()
+		default:
+			v = req.Header.Get(c)
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, v)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", params)
+	return b.String()
+}
+
+func signBytes(k models.SigningKey, data []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case models.SigningHMACSHA256:
+		mac := hmac.New(sha256.New, []byte(k.Secret))
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case models.SigningEd25519:
+		priv, err := privateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.Sign(priv, data), nil
+	}
+	return nil, fmt.Errorf("%w: %s: unknown algorithm %q", ErrInvalidKey, k.KeyID, k.Algorithm)
+}
+
+func privateKey(k models.SigningKey) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: %s: private key must be a base64 %d-byte Ed25519 seed", ErrInvalidKey, k.KeyID, ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
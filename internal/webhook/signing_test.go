@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nibble/mock-fps/internal/models"
+)
+
+func signedRequest(t *testing.T, body []byte, keys []models.SigningKey, now time.Time) *http.Request {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "http://consumer.example/hooks?x=1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if err := Sign(req, body, keys, now); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return req
+}
+
+func TestSign(t *testing.T) {
+	keys, err := PrepareKeys([]models.SigningKey{
+		{KeyID: "hmac-1", Algorithm: models.SigningHMACSHA256, Secret: "s3cret"},
+		{KeyID: "ed-1", Algorithm: models.SigningEd25519},
+	})
+	if err != nil {
+		t.Fatalf("PrepareKeys: %v", err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"n1"}`)
+	req := signedRequest(t, body, keys, now)
+
+	if got := req.Header.Get("Date"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("unexpected Date %q", got)
+	}
+	digest := sha256.Sum256(body)
+	if got, want := req.Header.Get(HeaderContentDigest), "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":"; got != want {
+		t.Errorf("Content-Digest = %q, want %q", got, want)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := req.Header.Values(HeaderBodySignature), []string{"key_id=hmac-1,sha256=" + hex.EncodeToString(mac.Sum(nil))}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("body signature = %v, want %v", got, want)
+	}
+
+	wantInput := `sig2=("@method" "@target-uri" "content-digest" "content-type" "date");created=1709294400;keyid="ed-1";alg="ed25519"`
+	if got := req.Header.Get(HeaderSignatureInput); !strings.Contains(got, wantInput) || !strings.HasPrefix(got, "sig1=") {
+		t.Fatalf("Signature-Input = %q, want it to include %q", got, wantInput)
+	}
+	base := strings.Join([]string{
+		`"@method": POST`,
+		`"@target-uri": http://consumer.example/hooks?x=1`,
+		`"content-digest": ` + req.Header.Get(HeaderContentDigest),
+		`"content-type": application/json`,
+		`"date": Fri, 01 Mar 2024 12:00:00 GMT`,
+		`"@signature-params": ` + strings.TrimPrefix(wantInput, "sig2="),
+	}, "\n")
+	var sig []byte
+	for _, s := range strings.Split(req.Header.Get(HeaderSignature), ", ") {
+		if v, ok := strings.CutPrefix(s, "sig2=:"); ok {
+			sig, _ = base64.StdEncoding.DecodeString(strings.TrimSuffix(v, ":"))
+		}
+	}
+	pub, _ := base64.StdEncoding.DecodeString(keys[1].PublicKey)
+	if !ed25519.Verify(pub, []byte(base), sig) {
+		t.Error("Ed25519 message signature does not verify")
+	}
+
+	unsigned := signedRequest(t, body, nil, now)
+	if unsigned.Header.Get(HeaderSignature) != "" || unsigned.Header.Get("Date") != "" {
+		t.Error("expected a request without keys to be left unsigned")
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	keys, _ := PrepareKeys([]models.SigningKey{{KeyID: "old", Algorithm: models.SigningHMACSHA256}})
+	keys, err := RotateKeys(keys, models.SigningKey{KeyID: "new", Algorithm: models.SigningHMACSHA256}, start, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	signers := func(at time.Time) string {
+		return signedRequest(t, []byte("{}"), keys, at).Header.Get(HeaderSignatureInput)
+	}
+	during := signers(start.Add(30 * time.Minute))
+	if !strings.Contains(during, `keyid="old"`) || !strings.Contains(during, `keyid="new"`) {
+		t.Errorf("expected both keys to sign during the overlap, got %q", during)
+	}
+	after := signers(start.Add(2 * time.Hour))
+	if strings.Contains(after, `keyid="old"`) || !strings.Contains(after, `keyid="new"`) {
+		t.Errorf("expected only the new key to sign after the overlap, got %q", after)
+	}
+
+	keys, _ = RotateKeys(keys, models.SigningKey{KeyID: "newer", Algorithm: models.SigningHMACSHA256}, start.Add(2*time.Hour), 0)
+	if len(keys) != 2 || keys[0].KeyID != "new" {
+		t.Errorf("expected the expired key to be dropped, got %+v", keys)
+	}
+	if _, err := RotateKeys(keys, models.SigningKey{KeyID: "new", Algorithm: models.SigningHMACSHA256}, start, 0); err == nil {
+		t.Error("expected an error for a duplicate key ID")
+	}
+	if _, err := PrepareKey(models.SigningKey{Algorithm: "rsa"}); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}